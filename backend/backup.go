@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"backend/config"
+	"backend/service/backup"
+	"backend/service/storage"
+)
+
+const backupUsage = `usage: backend backup [file]
+
+writes a tarball of the database and the stored files it refers to,
+to backup-<timestamp>.tar.gz unless a file is given`
+
+const restoreUsage = `usage: backend restore <file> <directory>
+
+unpacks a backup into a directory that is empty or does not exist yet`
+
+// newFileStorage creates the file storage selected by the configuration
+func newFileStorage() (*storage.FileStorage, error) {
+	backend, err := storage.NewBackend(&config.AppConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing storage backend: %v", err)
+	}
+	signer := storage.NewSigner(config.AppConfig.MediaSigningKey, time.Duration(config.AppConfig.MediaURLTTL)*time.Second)
+	return storage.NewFileStorage(config.AppConfig.UploadDir, backend, signer)
+}
+
+// runBackup writes a backup of the configured database and storage to a file
+func runBackup(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("%s", backupUsage)
+	}
+	outPath := "backup-" + time.Now().Format("20060102-150405") + ".tar.gz"
+	if len(args) == 1 {
+		outPath = args[0]
+	}
+
+	f, err := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating backup file: %v", err)
+	}
+	manifest, err := backup.Create(context.Background(), snapshots, fileStorage, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outPath)
+		return err
+	}
+
+	fmt.Printf("wrote %s: schema version %d, %d files\n", outPath, manifest.SchemaVersion, len(manifest.Files))
+	for _, key := range manifest.Missing {
+		fmt.Printf("missing from storage: %s\n", key)
+	}
+	return nil
+}
+
+// runRestore unpacks a backup into a fresh data directory
+func runRestore(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("%s", restoreUsage)
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("error opening backup file: %v", err)
+	}
+	defer f.Close()
+
+	manifest, err := backup.Restore(f, args[1])
+	if err != nil {
+		return fmt.Errorf("error restoring backup: %v", err)
+	}
+
+	fmt.Printf("restored backup of %s: schema version %d, %d files\n",
+		manifest.CreatedAt.Format(time.RFC3339), manifest.SchemaVersion, len(manifest.Files))
+	for _, key := range manifest.Missing {
+		fmt.Printf("missing when backed up: %s\n", key)
+	}
+	fmt.Printf("run the server with DB_PATH=%s UPLOAD_DIR=%s STORAGE_BACKEND=local\n",
+		filepath.Join(args[1], backup.DatabaseFile), filepath.Join(args[1], backup.UploadsDir))
+	return nil
+}
+
+// backupHandler streams a backup of the database and stored files. The
+// archive is built in a temporary file first so that a failure part way
+// through is reported as an error rather than a truncated download.
+func backupHandler(w http.ResponseWriter, r *http.Request) {
+	tmp, err := os.CreateTemp("", "ereader-backup-*.tar.gz")
+	if err != nil {
+		log.Printf("[Backup] Error creating temporary file: %v", err)
+		http.Error(w, "Error creating backup", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	manifest, err := backup.Create(r.Context(), snapshots, fileStorage, tmp)
+	if err != nil {
+		log.Printf("[Backup] Error creating backup: %v", err)
+		http.Error(w, "Error creating backup", http.StatusInternalServerError)
+		return
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		log.Printf("[Backup] Error reading backup: %v", err)
+		http.Error(w, "Error creating backup", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[Backup] Created backup with %d files (%d bytes), %d missing", len(manifest.Files), size, len(manifest.Missing))
+
+	filename := "backup-" + manifest.CreatedAt.Format("20060102-150405") + ".tar.gz"
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Length", fmt.Sprint(size))
+	io.Copy(w, tmp)
+}
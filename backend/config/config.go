@@ -17,13 +17,45 @@ type Config struct {
 	Env        string
 
 	// Database
-	DBPath string
+	DBPath          string
+	DBAutoMigrate   bool
+	DBJournalMode   string
+	DBSynchronous   string
+	DBBusyTimeoutMs int
+	DBForeignKeys   bool
+	DBMaxReaders    int
 
 	// File Storage
 	UploadDir     string
 	PDFDir        string
 	CoverDir      string
+	HLSDir        string
 	MaxUploadSize int64
+	MediaMaxAge   int
+
+	// Cover thumbnail widths in pixels
+	ThumbnailSizes []int
+
+	// Signed media URLs
+	MediaSigningKey string
+	MediaURLTTL     int
+
+	// Orphaned file collection
+	GCIntervalHours int
+	GCGraceMinutes  int
+	GCDryRun        bool
+
+	// Storage backend: local, s3 or uploadthing
+	StorageBackend string
+
+	// S3-compatible storage
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PathStyle bool
+	S3PublicURL string
 
 	// Replicate API
 	ReplicateAPIToken  string
@@ -32,6 +64,7 @@ type Config struct {
 
 	// UploadThing
 	UploadThingURL    string
+	UploadThingAPIURL string
 	UploadThingToken  string
 	UploadThingSecret string
 	UploadThingAppID  string
@@ -45,6 +78,29 @@ type Config struct {
 	TTSTopP           float64
 	TTSTemperature    float64
 
+	// Audio processing
+	FFmpegPath            string
+	AudioProcessing       bool
+	AudioTargetLUFS       float64
+	AudioPeakCeiling      float64
+	AudioSilenceThreshold float64
+	AudioParagraphPauseMs int
+	AudioSectionPauseMs   int
+	AudioChapterPauseMs   int
+	AudioProfile          string
+	AudioProfiles         string
+
+	// Events
+	EventLogSize int
+
+	// Per-user quotas, 0 for unlimited
+	QuotaStorageBytes      int64
+	QuotaBooks             int64
+	QuotaMonthlyCharacters int64
+
+	// Admin
+	AdminToken string
+
 	// CORS
 	AllowedOrigins []string
 }
@@ -62,18 +118,46 @@ func LoadConfig() error {
 		BackendURL: getEnv("BACKEND_URL", "http://localhost:8080"),
 		Env:        getEnv("ENV", "development"),
 
-		DBPath: getEnv("DB_PATH", "./ereader.db"),
+		DBPath:          getEnv("DB_PATH", "./ereader.db"),
+		DBAutoMigrate:   getEnvBool("DB_AUTO_MIGRATE", true),
+		DBJournalMode:   getEnv("DB_JOURNAL_MODE", "WAL"),
+		DBSynchronous:   getEnv("DB_SYNCHRONOUS", "NORMAL"),
+		DBBusyTimeoutMs: getEnvInt("DB_BUSY_TIMEOUT_MS", 5000),
+		DBForeignKeys:   getEnvBool("DB_FOREIGN_KEYS", true),
+		DBMaxReaders:    getEnvInt("DB_MAX_READERS", 4),
 
 		UploadDir:     getEnv("UPLOAD_DIR", "./uploads"),
 		PDFDir:        getEnv("PDF_DIR", "./uploads/pdfs"),
 		CoverDir:      getEnv("COVER_DIR", "./uploads/covers"),
+		HLSDir:        getEnv("HLS_DIR", "./uploads/hls"),
 		MaxUploadSize: getEnvInt64("MAX_UPLOAD_SIZE", 10<<20), // 10MB default
+		MediaMaxAge:   getEnvInt("MEDIA_MAX_AGE", 86400),      // 1 day default
+
+		ThumbnailSizes: getEnvIntList("THUMBNAIL_SIZES", []int{160, 320, 640}),
+
+		MediaSigningKey: getEnv("MEDIA_SIGNING_KEY", ""),  // empty serves media unsigned
+		MediaURLTTL:     getEnvInt("MEDIA_URL_TTL", 3600), // 1 hour default
+
+		GCIntervalHours: getEnvInt("GC_INTERVAL_HOURS", 24), // 0 disables scheduled collection
+		GCGraceMinutes:  getEnvInt("GC_GRACE_MINUTES", 60),
+		GCDryRun:        getEnvBool("GC_DRY_RUN", false),
+
+		StorageBackend: getEnv("STORAGE_BACKEND", "local"),
+
+		S3Endpoint:  getEnv("S3_ENDPOINT", "https://s3.amazonaws.com"),
+		S3Region:    getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:    getEnv("S3_BUCKET", ""),
+		S3AccessKey: getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey: getEnv("S3_SECRET_KEY", ""),
+		S3PathStyle: getEnvBool("S3_PATH_STYLE", true), // required by MinIO
+		S3PublicURL: getEnv("S3_PUBLIC_URL", ""),
 
 		ReplicateAPIToken:  getEnv("REPLICATE_API_TOKEN", ""),
 		ReplicateAPIURL:    getEnv("REPLICATE_API_URL", "https://api.replicate.com/v1"),
 		KokoroModelVersion: getEnv("KOKORO_MODEL_VERSION", ""),
 
 		UploadThingURL:    getEnv("UPLOADTHING_URL", ""),
+		UploadThingAPIURL: getEnv("UPLOADTHING_API_URL", "https://api.uploadthing.com"),
 		UploadThingToken:  getEnv("UPLOADTHING_TOKEN", ""),
 		UploadThingSecret: getEnv("UPLOADTHING_SECRET", ""),
 		UploadThingAppID:  getEnv("UPLOADTHING_APP_ID", ""),
@@ -86,6 +170,25 @@ func LoadConfig() error {
 		TTSTopP:           getEnvFloat64("TTS_TOP_P", 0.8),
 		TTSTemperature:    getEnvFloat64("TTS_TEMPERATURE", 0.8),
 
+		FFmpegPath:            getEnv("FFMPEG_PATH", "ffmpeg"),
+		AudioProcessing:       getEnvBool("AUDIO_PROCESSING", true),
+		AudioTargetLUFS:       getEnvFloat64("AUDIO_TARGET_LUFS", -16),
+		AudioPeakCeiling:      getEnvFloat64("AUDIO_PEAK_CEILING", -1.5),
+		AudioSilenceThreshold: getEnvFloat64("AUDIO_SILENCE_THRESHOLD", -50),
+		AudioParagraphPauseMs: getEnvInt("AUDIO_PARAGRAPH_PAUSE_MS", 600),
+		AudioSectionPauseMs:   getEnvInt("AUDIO_SECTION_PAUSE_MS", 1200),
+		AudioChapterPauseMs:   getEnvInt("AUDIO_CHAPTER_PAUSE_MS", 2000),
+		AudioProfile:          getEnv("AUDIO_PROFILE", "mp3-128"),
+		AudioProfiles:         getEnv("AUDIO_PROFILES", ""),
+
+		EventLogSize: getEnvInt("EVENT_LOG_SIZE", 200), // events kept per book for replay
+
+		QuotaStorageBytes:      getEnvInt64("QUOTA_STORAGE_BYTES", 0),
+		QuotaBooks:             getEnvInt64("QUOTA_BOOKS", 0),
+		QuotaMonthlyCharacters: getEnvInt64("QUOTA_MONTHLY_CHARACTERS", 0),
+
+		AdminToken: getEnv("ADMIN_TOKEN", ""),
+
 		AllowedOrigins: strings.Split(getEnv("ALLOWED_ORIGINS", "*"), ","),
 	}
 
@@ -117,6 +220,21 @@ func getEnvInt64(key string, fallback int64) int64 {
 	return fallback
 }
 
+func getEnvIntList(key string, fallback []int) []int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+
+	var list []int
+	for _, part := range strings.Split(value, ",") {
+		if intVal, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && intVal > 0 {
+			list = append(list, intVal)
+		}
+	}
+	return list
+}
+
 func getEnvFloat64(key string, fallback float64) float64 {
 	if value, exists := os.LookupEnv(key); exists {
 		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
@@ -125,3 +243,12 @@ func getEnvFloat64(key string, fallback float64) float64 {
 	}
 	return fallback
 }
+
+func getEnvBool(key string, fallback bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+	}
+	return fallback
+}
@@ -4,15 +4,50 @@ import (
 	"time"
 )
 
+// Audio segment statuses
+const (
+	SegmentStatusPending    = "pending"
+	SegmentStatusProcessing = "processing"
+	SegmentStatusCompleted  = "completed"
+	SegmentStatusError      = "error"
+)
+
 // AudioSegment represents a segment of text and its corresponding audio
 type AudioSegment struct {
+	ID            string    `json:"id"`
+	BookID        string    `json:"bookId"`
+	SegmentNumber int       `json:"segmentNumber"`
+	PageNumber    int       `json:"pageNumber"`
+	Content       string    `json:"content"`
+	AudioURL      string    `json:"audioUrl"`
+	AudioKey      string    `json:"-"`
+	AudioSize     int64     `json:"-"`
+	Container     string    `json:"container"`
+	Codec         string    `json:"codec"`
+	MimeType      string    `json:"mimeType"`
+	Duration      float64   `json:"duration"`
+	Status        string    `json:"status"`
+	LastError     string    `json:"lastError,omitempty"`
+	Skip          bool      `json:"skip"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// Segment revision sources
+const (
+	RevisionSourceExtracted = "extracted"
+	RevisionSourceEdit      = "edit"
+	RevisionSourceReplace   = "replace"
+)
+
+// SegmentRevision is a saved version of a segment's text
+type SegmentRevision struct {
 	ID        string    `json:"id"`
-	BookID    string    `json:"bookId"`
+	SegmentID string    `json:"segmentId"`
+	Revision  int       `json:"revision"`
 	Content   string    `json:"content"`
-	AudioURL  string    `json:"audioUrl"`
-	Status    string    `json:"status"`
+	Source    string    `json:"source"`
 	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
 }
 
 // TTSRequest represents a request to the Replicate API
@@ -4,21 +4,110 @@ import (
 	"time"
 )
 
+// Book statuses
+const (
+	BookStatusProcessing = "processing"
+	BookStatusReady      = "ready"
+	BookStatusError      = "error"
+	BookStatusPaused     = "paused"
+	BookStatusCanceled   = "canceled"
+)
+
 // Book represents a PDF book in the system
 type Book struct {
-	ID          string    `json:"id"`
-	Title       string    `json:"title"`
-	Author      string    `json:"author"`
-	CoverURL    string    `json:"coverUrl"`
-	FileURL     string    `json:"fileUrl"`
-	PageCount   int       `json:"pageCount"`
-	CurrentPage int       `json:"currentPage"`
-	Language    string    `json:"language"`
-	Status      string    `json:"status"`
-	CreatedAt   time.Time `json:"createdAt"`
-	UpdatedAt   time.Time `json:"updatedAt"`
-	Categories  []string  `json:"categories,omitempty"`
-	Tags        []string  `json:"tags,omitempty"`
+	ID              string           `json:"id"`
+	Title           string           `json:"title"`
+	Author          string           `json:"author"`
+	Description     string           `json:"description"`
+	Series          string           `json:"series"`
+	ISBN            string           `json:"isbn"`
+	CoverURL        string           `json:"coverUrl"`
+	FileURL         string           `json:"fileUrl"`
+	DocumentURL     string           `json:"documentUrl,omitempty"` // set when returned to clients
+	FileKey         string           `json:"-"`
+	CoverKey        string           `json:"-"`
+	CoverSize       int64            `json:"-"`
+	UserID          string           `json:"userId,omitempty"`
+	FileSize        int64            `json:"-"`
+	ContentHash     string           `json:"contentHash,omitempty"` // SHA-256 of the source file
+	TextFingerprint string           `json:"-"`                     // SHA-256 of the normalized text
+	PageCount       int              `json:"pageCount"`
+	CurrentPage     int              `json:"currentPage"`
+	Language        string           `json:"language"`
+	Status          string           `json:"status"`
+	CreatedAt       time.Time        `json:"createdAt"`
+	UpdatedAt       time.Time        `json:"updatedAt"`
+	Categories      []string         `json:"categories,omitempty"`
+	Tags            []string         `json:"tags,omitempty"`
+	Thumbnails      []CoverThumbnail `json:"thumbnails,omitempty"`
+}
+
+// CoverThumbnail is a resized copy of a book's cover
+type CoverThumbnail struct {
+	BookID string `json:"-"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Key    string `json:"-"`
+	Size   int64  `json:"-"`
+	URL    string `json:"url"` // set when returned to clients
+}
+
+// Library sort orders
+const (
+	BookSortTitle    = "title"
+	BookSortAuthor   = "author"
+	BookSortAdded    = "added"
+	BookSortLastRead = "lastRead"
+)
+
+// IsBookSort reports whether sort is a known library sort order
+func IsBookSort(sort string) bool {
+	switch sort {
+	case BookSortTitle, BookSortAuthor, BookSortAdded, BookSortLastRead:
+		return true
+	}
+	return false
+}
+
+// Reading states of a book for a user
+const (
+	ReadingStateUnread   = "unread"
+	ReadingStateReading  = "reading"
+	ReadingStateFinished = "finished"
+)
+
+// BookFilter selects and orders a page of the library
+type BookFilter struct {
+	UserID       string   // whose reading progress gives the reading state and last-read order
+	Statuses     []string // any of
+	Languages    []string // any of
+	Author       string   // case-insensitive substring
+	Categories   []string // names or IDs, all required
+	Tags         []string // names or IDs, all required
+	ReadingState string
+	Sort         string
+	Descending   bool
+	Limit        int // 0 returns every match
+	Cursor       string
+}
+
+// Processing stages
+const (
+	StageDownloading  = "downloading"
+	StageExtracting   = "extracting"
+	StageSegmenting   = "segmenting"
+	StageSynthesizing = "synthesizing"
+)
+
+// BookStage is one stage of a book's processing timeline. EndedAt is nil
+// while the stage is in progress.
+type BookStage struct {
+	ID        string     `json:"id"`
+	BookID    string     `json:"bookId"`
+	Stage     string     `json:"stage"`
+	StartedAt time.Time  `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt"`
+	Error     string     `json:"error,omitempty"`
 }
 
 // ReadingProgress tracks a user's reading progress for a book
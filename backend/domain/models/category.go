@@ -9,6 +9,7 @@ type Category struct {
 	ID          string    `json:"id"`
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
+	BookCount   int       `json:"bookCount"`
 	CreatedAt   time.Time `json:"createdAt"`
 }
 
@@ -16,5 +17,6 @@ type Category struct {
 type Tag struct {
 	ID        string    `json:"id"`
 	Name      string    `json:"name"`
+	BookCount int       `json:"bookCount"`
 	CreatedAt time.Time `json:"createdAt"`
 }
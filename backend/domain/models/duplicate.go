@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Reasons books are reported as duplicates of each other
+const (
+	DuplicateSameFile  = "sameFile"  // identical source files
+	DuplicateSameText  = "sameText"  // different files with the same normalized text
+	DuplicateSameTitle = "sameTitle" // same title and author, possibly distinct editions
+)
+
+// DuplicateGroup is a set of one user's books that look like copies of each other
+type DuplicateGroup struct {
+	Reason string `json:"reason"`
+	UserID string `json:"userId,omitempty"`
+	Books  []Book `json:"books"` // oldest first
+}
+
+// DuplicateReport lists the duplicate groups for review. Nothing is deleted
+// automatically.
+type DuplicateReport struct {
+	Groups []DuplicateGroup `json:"groups"`
+	// UnhashedBooks have no content hash yet and cannot be matched by file
+	UnhashedBooks int       `json:"unhashedBooks"`
+	GeneratedAt   time.Time `json:"generatedAt"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// BookEvent is a processing event recorded in a book's event log
+type BookEvent struct {
+	ID        int64           `json:"id"`
+	BookID    string          `json:"bookId"`
+	Type      string          `json:"type"`
+	Version   int             `json:"version"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
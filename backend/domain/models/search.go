@@ -0,0 +1,29 @@
+package models
+
+// BookHit is a book whose title or author matched a search
+type BookHit struct {
+	Book            Book   `json:"book"`
+	TitleHighlight  string `json:"titleHighlight"`
+	AuthorHighlight string `json:"authorHighlight"`
+}
+
+// SegmentHit is a segment whose text matched a search. AudioOffset is the
+// segment's start, in seconds, within the book's playlist and is nil until
+// the segment has audio.
+type SegmentHit struct {
+	SegmentID     string   `json:"segmentId"`
+	BookID        string   `json:"bookId"`
+	BookTitle     string   `json:"bookTitle"`
+	SegmentNumber int      `json:"segmentNumber"`
+	PageNumber    int      `json:"pageNumber"`
+	Snippet       string   `json:"snippet"`
+	AudioOffset   *float64 `json:"audioOffset"`
+}
+
+// SearchResults are the books and segments matching a query
+type SearchResults struct {
+	Query    string       `json:"query"`
+	Engine   string       `json:"engine"` // fts5, or like when FTS5 is unavailable
+	Books    []BookHit    `json:"books"`
+	Segments []SegmentHit `json:"segments"`
+}
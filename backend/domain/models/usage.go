@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// SynthesisUsage records the characters sent for speech synthesis on behalf of a user
+type SynthesisUsage struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"userId"`
+	BookID     string    `json:"bookId"`
+	SegmentID  string    `json:"segmentId"`
+	Characters int64     `json:"characters"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// UserQuota overrides the configured quota limits for one user. A nil limit
+// falls back to the default and 0 means unlimited.
+type UserQuota struct {
+	UserID            string    `json:"userId"`
+	StorageBytes      *int64    `json:"storageBytes"`
+	Books             *int64    `json:"books"`
+	MonthlyCharacters *int64    `json:"monthlyCharacters"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+}
@@ -2,20 +2,41 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"backend/config"
 	"backend/domain/models"
+	"backend/repository"
 	"backend/repository/sqlite"
+	"backend/service/audio"
+	"backend/service/cover"
+	"backend/service/events"
+	"backend/service/gc"
+	"backend/service/hls"
+	"backend/service/jobs"
+	"backend/service/media"
+	"backend/service/metadata"
 	"backend/service/pdf"
+	"backend/service/progress"
+	"backend/service/quota"
 	"backend/service/storage"
 	"backend/service/tts"
 
@@ -25,58 +46,138 @@ import (
 )
 
 var (
-	db          *sqlite.DB
+	// db stores the books, segments, progress, bookmarks, taxonomy and users
+	// that handlers work with. The interfaces after it reach the features
+	// only the SQLite database has.
+	db          repository.Store
+	stages      repository.Stages
+	searchIndex repository.Searcher
+	duplicates  repository.Duplicates
+	snapshots   repository.Snapshots
+
 	fileStorage *storage.FileStorage
 	ttsGen      *tts.Generator
+	hlsPackager *hls.Packager
+	audioProc   *audio.Processor
+	transcoder  *audio.Transcoder
+	eventHub    *events.Hub
+	collector   *gc.Collector
+	quotas      *quota.Enforcer
+	jobManager  = jobs.NewManager()
 )
 
 // Add WebSocket upgrader
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for now
+		return r.Header.Get("Origin") == "" || allowedOrigin(r) != ""
 	},
 }
 
-// Add WebSocket connections map
-var wsConnections = make(map[string][]*websocket.Conn)
-
 func main() {
 	// Load configuration
 	if err := config.LoadConfig(); err != nil {
 		log.Fatal("Error loading configuration:", err)
 	}
 
+	// Restoring writes a fresh data directory, so it runs before any database is opened
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		if err := runRestore(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Initialize database
-	var err error
-	db, err = sqlite.NewDB(config.AppConfig.DBPath)
+	database, err := sqlite.NewDB(config.AppConfig.DBPath, sqlite.Options{
+		JournalMode: config.AppConfig.DBJournalMode,
+		Synchronous: config.AppConfig.DBSynchronous,
+		BusyTimeout: time.Duration(config.AppConfig.DBBusyTimeoutMs) * time.Millisecond,
+		ForeignKeys: config.AppConfig.DBForeignKeys,
+		MaxReaders:  config.AppConfig.DBMaxReaders,
+	})
 	if err != nil {
 		log.Fatal("Error opening database:", err)
 	}
-	defer db.Close()
+	defer database.Close()
+	db, stages, searchIndex, duplicates, snapshots = database, database, database, database, database
 
-	// Create tables
-	if err := db.InitDB(); err != nil {
-		log.Fatal("Error initializing database:", err)
-	}
-
-	// Clean up any duplicate books
-	if err := db.CleanupDuplicateBooks(); err != nil {
-		log.Printf("Warning: Error cleaning up duplicates: %v", err)
+	// Schema maintenance runs instead of the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(database, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
 	// Initialize file storage
-	fileStorage, err = storage.NewFileStorage(config.AppConfig.UploadDir)
+	fileStorage, err = newFileStorage()
 	if err != nil {
 		log.Fatal("Error initializing file storage:", err)
 	}
 
+	// Backups run instead of the server
+	if len(os.Args) > 1 && os.Args[1] == "backup" {
+		if err := runBackup(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Bring the schema up to date, or make sure it already is
+	if config.AppConfig.DBAutoMigrate {
+		err = database.InitDB()
+	} else {
+		err = database.CheckSchema()
+	}
+	if err != nil {
+		log.Fatal("Error initializing database:", err)
+	}
+	if err := database.InitSearch(); err != nil {
+		log.Fatal("Error initializing search index:", err)
+	}
+	if config.AppConfig.DBForeignKeys {
+		violations, err := database.ForeignKeyViolations()
+		if err != nil {
+			log.Printf("[DB] %v", err)
+		}
+		for table, n := range violations {
+			log.Printf("[DB] Warning: %d rows of %s refer to rows that no longer exist", n, table)
+		}
+	}
+
+	// Initialize the event hub, logging events so reconnecting clients can catch up
+	eventHub = events.NewHub(events.NewDBLog(database, config.AppConfig.EventLogSize), presentEvent)
+
 	// Initialize TTS generator
-	ttsGen = tts.NewGenerator(&config.AppConfig, db)
+	ttsGen = tts.NewGenerator(&config.AppConfig)
+
+	// Initialize post-synthesis audio processing
+	audioProc = audio.NewProcessor(&config.AppConfig)
+	transcoder, err = audio.NewTranscoder(&config.AppConfig)
+	if err != nil {
+		log.Fatal("Error initializing audio transcoder:", err)
+	}
+
+	// Initialize HLS packager
+	hlsPackager, err = hls.NewPackager(config.AppConfig.HLSDir, config.AppConfig.FFmpegPath)
+	if err != nil {
+		log.Fatal("Error initializing HLS packager:", err)
+	}
+
+	// Initialize per-user quotas
+	quotas = quota.NewEnforcer(database, quota.Limits{
+		StorageBytes:      config.AppConfig.QuotaStorageBytes,
+		Books:             config.AppConfig.QuotaBooks,
+		MonthlyCharacters: config.AppConfig.QuotaMonthlyCharacters,
+	})
 
-	// Create audio directory if it doesn't exist
-	audioDir := filepath.Join(config.AppConfig.UploadDir, "audio")
-	if err := os.MkdirAll(audioDir, 0755); err != nil {
-		log.Fatal("Error creating audio directory:", err)
+	// Initialize orphaned file collection
+	collector = gc.NewCollector(database, fileStorage, hlsPackager, time.Duration(config.AppConfig.GCGraceMinutes)*time.Minute)
+
+	// Hash books stored before content hashes were recorded, then report duplicates
+	go hashStoredBooks(context.Background())
+	if config.AppConfig.GCIntervalHours > 0 {
+		go collector.Schedule(context.Background(), time.Duration(config.AppConfig.GCIntervalHours)*time.Hour, config.AppConfig.GCDryRun)
 	}
 
 	// Initialize router
@@ -86,9 +187,13 @@ func main() {
 	router.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Set CORS headers for all responses
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-User-ID")
+			if origin := allowedOrigin(r); origin != "" {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			w.Header().Add("Vary", "Origin")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-User-ID, Range, If-None-Match, If-Range, Last-Event-ID")
+			w.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Range, Accept-Ranges, ETag, Link, X-Next-Cursor")
 			w.Header().Set("Access-Control-Max-Age", "3600")
 
 			// Handle preflight requests
@@ -101,9 +206,11 @@ func main() {
 		})
 	})
 
-	// Serve static audio files
-	audioDir = filepath.Join(config.AppConfig.UploadDir, "audio")
-	router.PathPrefix("/audio/").Handler(http.StripPrefix("/audio/", http.FileServer(http.Dir(audioDir))))
+	// Serve stored audio, covers and packaged HLS segments
+	router.PathPrefix("/audio/").HandlerFunc(serveStoredFileHandler).Methods("GET", "HEAD")
+	router.PathPrefix("/covers/").HandlerFunc(serveStoredFileHandler).Methods("GET", "HEAD")
+	router.PathPrefix(storage.MediaPrefix).HandlerFunc(serveSignedMediaHandler).Methods("GET", "HEAD")
+	router.HandleFunc("/hls/{bookId}/{segmentId}.ts", serveHLSSegmentHandler).Methods("GET", "HEAD")
 
 	// File upload routes
 	router.HandleFunc("/api/upload", uploadPDFHandler).Methods("POST", "OPTIONS")
@@ -112,10 +219,17 @@ func main() {
 
 	// Book routes
 	router.HandleFunc("/api/books/{id}", getBookHandler).Methods("GET")
+	router.HandleFunc("/api/books/{id}", patchBookHandler).Methods("PATCH")
+	router.HandleFunc("/api/books/{id}", deleteBookHandler).Methods("DELETE")
 	router.HandleFunc("/api/books", getBooksHandler).Methods("GET")
 	router.HandleFunc("/api/books/{id}/status", getBookStatusHandler).Methods("GET")
+	router.HandleFunc("/api/books/{id}/file", getBookFileHandler).Methods("GET", "HEAD")
+	router.HandleFunc("/api/books/{id}/cover", updateBookCoverHandler).Methods("PUT")
 	router.HandleFunc("/api/books/{id}/update-url", updateBookURLHandler).Methods("POST")
 	router.HandleFunc("/api/books/{id}/process", processBookHandler).Methods("POST")
+	router.HandleFunc("/api/books/{id}/pause", pauseBookHandler).Methods("POST")
+	router.HandleFunc("/api/books/{id}/resume", resumeBookHandler).Methods("POST")
+	router.HandleFunc("/api/books/{id}/cancel", cancelBookHandler).Methods("POST")
 
 	// Reading progress routes
 	router.HandleFunc("/api/progress", updateProgressHandler).Methods("POST")
@@ -129,15 +243,52 @@ func main() {
 
 	// Audio segment routes
 	router.HandleFunc("/api/books/{id}/audio-segments", getAudioSegmentsHandler).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/books/{id}/audio-segments/replace", replaceSegmentTextHandler).Methods("POST")
+	router.HandleFunc("/api/books/{id}/audio-segments/{segmentId}", updateAudioSegmentHandler).Methods("PATCH")
+	router.HandleFunc("/api/books/{id}/audio-segments/{segmentId}", deleteAudioSegmentHandler).Methods("DELETE")
+	router.HandleFunc("/api/books/{id}/audio-segments/{segmentId}/revisions", getSegmentRevisionsHandler).Methods("GET")
+	router.HandleFunc("/api/books/{id}/audio-segments/{segmentId}/audio", getSegmentAudioHandler).Methods("GET", "HEAD")
 	router.HandleFunc("/api/books/{id}/generate-audio", generateBookAudioHandler).Methods("POST")
+	router.HandleFunc("/api/books/{id}/regenerate", regenerateBookPagesHandler).Methods("POST")
+	router.HandleFunc("/api/books/{id}/audio-segments/{segmentId}/regenerate", regenerateSegmentHandler).Methods("POST")
+	router.HandleFunc("/api/books/{id}/playlist.m3u8", getBookPlaylistHandler).Methods("GET")
 	router.HandleFunc("/api/audio/generate", generateAudioHandler).Methods("POST")
+	router.HandleFunc("/api/audio/profiles", getAudioProfilesHandler).Methods("GET")
+
+	// Search routes
+	router.HandleFunc("/api/search", searchHandler).Methods("GET")
 
 	// Category and tag routes
 	router.HandleFunc("/api/categories", getCategoriesHandler).Methods("GET")
+	router.HandleFunc("/api/categories", createCategoryHandler).Methods("POST")
+	router.HandleFunc("/api/categories/{id}", getCategoryHandler).Methods("GET")
+	router.HandleFunc("/api/categories/{id}", updateCategoryHandler).Methods("PUT")
+	router.HandleFunc("/api/categories/{id}", deleteCategoryHandler).Methods("DELETE")
+	router.HandleFunc("/api/books/{id}/categories/{categoryId}", setBookCategoryHandler).Methods("PUT", "DELETE")
 	router.HandleFunc("/api/tags", getTagsHandler).Methods("GET")
+	router.HandleFunc("/api/tags", createTagHandler).Methods("POST")
+	router.HandleFunc("/api/tags/{id}", getTagHandler).Methods("GET")
+	router.HandleFunc("/api/tags/{id}", renameTagHandler).Methods("PUT")
+	router.HandleFunc("/api/tags/{id}", deleteTagHandler).Methods("DELETE")
+	router.HandleFunc("/api/tags/{id}/merge", mergeTagsHandler).Methods("POST")
+	router.HandleFunc("/api/tags/{id}/books", bulkTagHandler).Methods("POST", "DELETE")
+	router.HandleFunc("/api/books/{id}/tags/{tagId}", setBookTagHandler).Methods("PUT", "DELETE")
+
+	// Usage routes
+	router.HandleFunc("/api/me/usage", getUsageHandler).Methods("GET")
+
+	// Admin routes
+	router.HandleFunc("/api/admin/gc", requireAdmin(collectGarbageHandler)).Methods("GET", "POST")
+	router.HandleFunc("/api/admin/duplicates", requireAdmin(duplicateReportHandler)).Methods("GET")
+	router.HandleFunc("/api/admin/backup", requireAdmin(backupHandler)).Methods("GET")
+	router.HandleFunc("/api/admin/users/{id}/quota", requireAdmin(updateUserQuotaHandler)).Methods("PUT")
+	if config.AppConfig.AdminToken == "" {
+		log.Printf("[Admin] ADMIN_TOKEN is not set, admin routes are disabled")
+	}
 
 	// WebSocket routes
 	router.HandleFunc("/ws/books/{id}", wsHandler)
+	router.HandleFunc("/api/books/{id}/events", bookEventsHandler).Methods("GET")
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -163,19 +314,70 @@ func uploadPDFHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("[Upload] Received request for title: %s, URL: %s", req.Title, req.FileURL)
 
+	userID := r.Header.Get("X-User-ID")
+
 	// Create initial book record
 	book := &models.Book{
 		ID:        uuid.New().String(),
 		Title:     req.Title,
 		FileURL:   req.FileURL,
-		Status:    "processing",
+		UserID:    userID,
+		Status:    models.BookStatusProcessing,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
+
+	// Fetch the file now so that a copy of a book the user already has is
+	// recognized by its content hash before a new book is created
+	pdfKey, err := fetchBookPDF(r.Context(), book)
+	if err != nil {
+		log.Printf("[Upload] Error downloading PDF: %v", err)
+		if errors.Is(err, errFileTooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	existing, err := db.FindBookByContentHash(userID, book.ContentHash)
+	if err != nil {
+		discardUpload(pdfKey)
+		log.Printf("[Upload] Error checking for duplicates: %v", err)
+		http.Error(w, "Error checking for duplicates", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		log.Printf("[Upload] File is a duplicate of book %s, returning it", existing.ID)
+		discardUpload(pdfKey)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":        existing.ID,
+			"status":    existing.Status,
+			"duplicate": true,
+		})
+		return
+	}
+
+	// A duplicate costs nothing, so the quota is only checked for new books
+	if err := quotas.CheckUpload(userID, book.FileSize); err != nil {
+		discardUpload(pdfKey)
+		writeQuotaError(w, err)
+		return
+	}
+
+	// Claim the job before the book exists so that a failure leaves nothing behind
+	job, err := jobManager.Start(book.ID, jobs.KindProcessing)
+	if err != nil {
+		discardUpload(pdfKey)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	log.Printf("[Upload] Created book record with ID: %s", book.ID)
 
 	// Save initial book record
 	if err := db.SaveBook(book); err != nil {
+		jobManager.Finish(job)
+		discardUpload(pdfKey)
 		log.Printf("[Upload] Error saving book: %v", err)
 		http.Error(w, fmt.Sprintf("Error saving book: %v", err), http.StatusInternalServerError)
 		return
@@ -183,149 +385,26 @@ func uploadPDFHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[Upload] Successfully saved book to database")
 
 	// Start processing in background immediately
-	go func() {
-		log.Printf("[Processing] Starting background processing for book: %s", book.ID)
-
-		// Download the PDF file
-		resp, err := http.Get(book.FileURL)
-		if err != nil {
-			log.Printf("[PDF] Error downloading PDF: %v", err)
-			book.Status = "error"
-			db.UpdateBook(book)
-			return
-		}
-		defer resp.Body.Close()
-
-		// Process PDF
-		processedBook, err := pdf.ProcessPDF(resp.Body, filepath.Base(book.FileURL))
-		if err != nil {
-			log.Printf("[PDF] Error processing PDF: %v", err)
-			book.Status = "error"
-			db.UpdateBook(book)
-			return
-		}
-
-		// Update book with processed information
-		book.PageCount = processedBook.PageCount
-		book.Author = processedBook.Author
-		book.Language = processedBook.Language
-		if err := db.UpdateBook(book); err != nil {
-			log.Printf("[PDF] Error updating book: %v", err)
-			return
-		}
-
-		// Create temporary file for PDF processing
-		tmpFile, err := os.CreateTemp("", "book-*.pdf")
-		if err != nil {
-			log.Printf("[PDF] Error creating temp file: %v", err)
-			book.Status = "error"
-			db.UpdateBook(book)
-			return
-		}
-		defer os.Remove(tmpFile.Name())
-
-		// Copy PDF to temporary file
-		if _, err := io.Copy(tmpFile, resp.Body); err != nil {
-			log.Printf("[PDF] Error copying to temp file: %v", err)
-			book.Status = "error"
-			db.UpdateBook(book)
-			return
-		}
-
-		// Extract text segments
-		textSegments, err := pdf.ExtractText(tmpFile.Name())
-		if err != nil {
-			log.Printf("[PDF] Error extracting text: %v", err)
-			book.Status = "error"
-			db.UpdateBook(book)
-			return
-		}
-
-		// Create audio segments
-		for i, text := range textSegments {
-			segment := &models.AudioSegment{
-				ID:        uuid.New().String(),
-				BookID:    book.ID,
-				Content:   text,
-				Status:    "pending",
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
-			}
-			if err := db.SaveAudioSegment(segment); err != nil {
-				log.Printf("[PDF] Error saving segment %d: %v", i+1, err)
-				continue
-			}
-		}
-
-		// Update book status
-		book.Status = "ready"
-		book.UpdatedAt = time.Now()
-		if err := db.UpdateBook(book); err != nil {
-			log.Printf("[PDF] Error updating book status: %v", err)
-			return
-		}
-
-		// Get audio segments from the book
-		audioSegments, err := db.GetAudioSegments(book.ID)
-		if err != nil {
-			log.Printf("[Processing] Error getting segments: %v", err)
-			return
-		}
-
-		// Process each segment
-		for _, segment := range audioSegments {
-			if segment.Status != "pending" {
-				continue
-			}
-
-			// Generate audio for the segment
-			audioData, err := ttsGen.ProcessAudioSegment(&segment)
-			if err != nil {
-				log.Printf("[Processing] Error generating audio for segment %s: %v", segment.ID, err)
-				segment.Status = "error"
-				db.UpdateAudioSegment(&segment)
-				continue
-			}
-
-			// Save audio to file
-			audioFileName := fmt.Sprintf("%s.mp3", segment.ID)
-			audioPath := filepath.Join("audio", audioFileName)
-			if err := os.WriteFile(audioPath, audioData, 0644); err != nil {
-				log.Printf("[Processing] Error saving audio file for segment %s: %v", segment.ID, err)
-				segment.Status = "error"
-				db.UpdateAudioSegment(&segment)
-				continue
-			}
-
-			// Update segment with audio URL and status
-			segment.AudioURL = audioPath
-			segment.Status = "ready"
-			segment.UpdatedAt = time.Now()
-			if err := db.UpdateAudioSegment(&segment); err != nil {
-				log.Printf("[Processing] Error updating segment %s: %v", segment.ID, err)
-				continue
-			}
-		}
-
-		// Update book status to ready
-		book.Status = "ready"
-		book.UpdatedAt = time.Now()
-		if err := db.UpdateBook(book); err != nil {
-			log.Printf("[Processing] Error updating book status: %v", err)
-		}
-		log.Printf("[Processing] Book status updated to ready: %s", book.ID)
-	}()
+	go processBook(job, book)
 
 	log.Printf("[Upload] Returning response for book: %s", book.ID)
 	// Return immediate response with book ID
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"id":     book.ID,
-		"status": book.Status,
+		"id":        book.ID,
+		"status":    book.Status,
+		"duplicate": false,
 	})
 }
 
-// Add WebSocket handler
+// discardUpload deletes the file of an upload that did not become a book
+func discardUpload(key string) {
+	if err := fileStorage.Delete(context.Background(), key); err != nil {
+		log.Printf("[Upload] Error deleting unused file %s: %v", key, err)
+	}
+}
+
+// wsHandler streams a book's processing events to a WebSocket client
 func wsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	bookID := vars["id"]
@@ -336,25 +415,18 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Add connection to the map
-	wsConnections[bookID] = append(wsConnections[bookID], conn)
-	log.Printf("[WS] New connection established for book: %s", bookID)
-
-	// Clean up on disconnect
-	go func() {
-		<-r.Context().Done()
-		wsConnections[bookID] = removeConn(wsConnections[bookID], conn)
-		log.Printf("[WS] Connection closed for book: %s", bookID)
-	}()
+	events.ServeWebSocket(eventHub, conn, bookID, events.LastEventID(r))
 }
 
-func removeConn(conns []*websocket.Conn, conn *websocket.Conn) []*websocket.Conn {
-	for i, c := range conns {
-		if c == conn {
-			return append(conns[:i], conns[i+1:]...)
-		}
+// bookEventsHandler streams a book's processing events as Server-Sent Events
+func bookEventsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, err := db.GetBookByID(vars["id"]); err != nil {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
 	}
-	return conns
+
+	events.ServeSSE(eventHub, w, r, vars["id"])
 }
 
 func uploadCoverHandler(w http.ResponseWriter, r *http.Request) {
@@ -370,13 +442,71 @@ func uploadCoverHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	coverURL, err := fileStorage.SaveCover(file, header.Filename)
+	if err := quotas.CheckStorage(r.Header.Get("X-User-ID"), header.Size); err != nil {
+		writeQuotaError(w, err)
+		return
+	}
+
+	coverKey, err := fileStorage.SaveCover(r.Context(), file, header.Filename)
+	if err != nil {
+		http.Error(w, "Error saving cover", http.StatusInternalServerError)
+		return
+	}
+
+	// coverUrl is the stable reference to store; signedUrl can be displayed right away
+	response := map[string]string{"coverUrl": fileStorage.URL(coverKey)}
+	if fileStorage.Signing() {
+		response["signedUrl"] = mediaURL(coverKey)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// updateBookCoverHandler replaces a book's cover with an uploaded image
+func updateBookCoverHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	book, err := db.GetBookByID(vars["id"])
+	if err != nil {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		http.Error(w, "File too large", http.StatusBadRequest)
+		return
+	}
+	file, _, err := r.FormFile("cover")
+	if err != nil {
+		http.Error(w, "Error retrieving file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
 	if err != nil {
+		http.Error(w, "Error reading file", http.StatusBadRequest)
+		return
+	}
+	if err := quotas.CheckStorage(book.UserID, int64(len(data))); err != nil {
+		writeQuotaError(w, err)
+		return
+	}
+
+	if err := attachCover(r.Context(), book, data); err != nil {
+		if errors.Is(err, cover.ErrUnsupportedImage) {
+			http.Error(w, "Cover must be a JPEG, PNG or GIF image", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, cover.ErrImageTooLarge) {
+			http.Error(w, "Cover image is too large", http.StatusBadRequest)
+			return
+		}
+		log.Printf("[Cover] Error attaching cover to book %s: %v", book.ID, err)
 		http.Error(w, "Error saving cover", http.StatusInternalServerError)
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]string{"coverUrl": coverURL})
+	presentBook(book)
+	json.NewEncoder(w).Encode(book)
 }
 
 func getBookHandler(w http.ResponseWriter, r *http.Request) {
@@ -387,19 +517,155 @@ func getBookHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	presentBook(book)
 	json.NewEncoder(w).Encode(book)
 }
 
+// patchBookHandler edits a book's metadata. Only the fields present in the
+// body are changed.
+func patchBookHandler(w http.ResponseWriter, r *http.Request) {
+	book, err := db.GetBookByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+
+	var patch metadata.Patch
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patch); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := patch.Apply(book); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := db.SetBookMetadata(book); err != nil {
+		log.Printf("[Library] Error updating book %s: %v", book.ID, err)
+		http.Error(w, "Error updating book", http.StatusInternalServerError)
+		return
+	}
+
+	book, err = db.GetBookByID(book.ID)
+	if err != nil {
+		http.Error(w, "Error retrieving book", http.StatusInternalServerError)
+		return
+	}
+	presentBook(book)
+	json.NewEncoder(w).Encode(book)
+}
+
+// deleteBookHandler deletes a book with its segments, progress, bookmarks
+// and stored files. Books being processed must be canceled first.
+func deleteBookHandler(w http.ResponseWriter, r *http.Request) {
+	book, err := db.GetBookByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+	if _, running := jobManager.Get(book.ID); running {
+		http.Error(w, "Book is being processed, cancel it first", http.StatusConflict)
+		return
+	}
+
+	if err := collector.DeleteBook(r.Context(), book.ID); err != nil {
+		log.Printf("[Library] Error deleting book %s: %v", book.ID, err)
+		http.Error(w, "Error deleting book", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[Library] Deleted book %s (%s)", book.ID, book.Title)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getBooksHandler lists the library, filtered and sorted by the query
+// parameters. With a limit, the cursor of the next page is returned in the
+// X-Next-Cursor and Link headers.
 func getBooksHandler(w http.ResponseWriter, r *http.Request) {
-	books, err := db.GetBooks()
+	query := r.URL.Query()
+	filter := models.BookFilter{
+		UserID:       r.Header.Get("X-User-ID"),
+		Statuses:     queryList(query, "status"),
+		Languages:    queryList(query, "language"),
+		Author:       strings.TrimSpace(query.Get("author")),
+		Categories:   query["category"],
+		Tags:         query["tag"],
+		ReadingState: query.Get("reading"),
+		Sort:         query.Get("sort"),
+		Cursor:       query.Get("cursor"),
+	}
+
+	if filter.Sort == "" {
+		filter.Sort = models.BookSortAdded
+	}
+	if !models.IsBookSort(filter.Sort) {
+		http.Error(w, "sort must be one of title, author, added or lastRead", http.StatusBadRequest)
+		return
+	}
+	switch query.Get("order") {
+	case "":
+		// Newest first for dates, alphabetical otherwise
+		filter.Descending = filter.Sort == models.BookSortAdded || filter.Sort == models.BookSortLastRead
+	case "asc":
+	case "desc":
+		filter.Descending = true
+	default:
+		http.Error(w, "order must be asc or desc", http.StatusBadRequest)
+		return
+	}
+	switch filter.ReadingState {
+	case "", models.ReadingStateUnread, models.ReadingStateReading, models.ReadingStateFinished:
+	default:
+		http.Error(w, "reading must be one of unread, reading or finished", http.StatusBadRequest)
+		return
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 200 {
+			http.Error(w, "limit must be an integer from 1 to 200", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	books, next, err := db.ListBooks(filter)
 	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		log.Printf("[Library] Error listing books: %v", err)
 		http.Error(w, "Error retrieving books", http.StatusInternalServerError)
 		return
 	}
 
+	if next != "" {
+		query.Set("cursor", next)
+		w.Header().Set("X-Next-Cursor", next)
+		w.Header().Set("Link", fmt.Sprintf("<%s?%s>; rel=\"next\"", r.URL.Path, query.Encode()))
+	}
+	for i := range books {
+		presentBook(&books[i])
+	}
 	json.NewEncoder(w).Encode(books)
 }
 
+// queryList returns the values of a query parameter that may be repeated or
+// given as a comma-separated list
+func queryList(query url.Values, name string) []string {
+	var values []string
+	for _, v := range query[name] {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+	return values
+}
+
 func updateProgressHandler(w http.ResponseWriter, r *http.Request) {
 	var progress models.ReadingProgress
 	if err := json.NewDecoder(r.Body).Decode(&progress); err != nil {
@@ -412,6 +678,11 @@ func updateProgressHandler(w http.ResponseWriter, r *http.Request) {
 		progress.ID = uuid.New().String()
 	}
 
+	if _, err := db.GetBookByID(progress.BookID); err != nil {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+
 	if err := db.UpdateReadingProgress(&progress); err != nil {
 		http.Error(w, "Error updating progress", http.StatusInternalServerError)
 		return
@@ -450,6 +721,11 @@ func createBookmarkHandler(w http.ResponseWriter, r *http.Request) {
 		bookmark.ID = uuid.New().String()
 	}
 
+	if _, err := db.GetBookByID(bookmark.BookID); err != nil {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+
 	if err := db.CreateBookmark(&bookmark); err != nil {
 		http.Error(w, "Error creating bookmark", http.StatusInternalServerError)
 		return
@@ -498,6 +774,28 @@ func deleteBookmarkHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// deleteAudioSegmentHandler removes a segment along with its audio files
+func deleteAudioSegmentHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	segment, err := db.GetAudioSegmentByID(vars["segmentId"])
+	if err != nil || segment.BookID != vars["id"] {
+		http.Error(w, "Audio segment not found", http.StatusNotFound)
+		return
+	}
+	if _, running := jobManager.Get(segment.BookID); running {
+		http.Error(w, "Book is being processed", http.StatusConflict)
+		return
+	}
+
+	if err := collector.DeleteSegment(r.Context(), segment); err != nil {
+		log.Printf("[GC] Error deleting segment %s: %v", segment.ID, err)
+		http.Error(w, "Error deleting audio segment", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func generateAudioHandler(w http.ResponseWriter, r *http.Request) {
 	var segment models.AudioSegment
 	if err := json.NewDecoder(r.Body).Decode(&segment); err != nil {
@@ -510,8 +808,19 @@ func generateAudioHandler(w http.ResponseWriter, r *http.Request) {
 		segment.ID = uuid.New().String()
 	}
 
+	// Segments belong to a book, which foreign keys enforce
+	if _, err := db.GetBookByID(segment.BookID); err != nil {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+
+	if err := quotas.CheckSynthesis(bookOwner(segment.BookID), segmentCharacters(&segment)); err != nil {
+		writeQuotaError(w, err)
+		return
+	}
+
 	// Set initial status
-	segment.Status = "pending"
+	segment.Status = models.SegmentStatusPending
 	segment.CreatedAt = time.Now()
 	segment.UpdatedAt = time.Now()
 
@@ -521,35 +830,13 @@ func generateAudioHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Start TTS processing in background
-	go func() {
-		audioData, err := ttsGen.GenerateAudio(segment.Content)
-		if err != nil {
+	go func(segment models.AudioSegment) {
+		if _, err := synthesizeSegment(context.Background(), &segment, ttsGen.DefaultVoiceSettings(), fmt.Sprintf("tts-%s", segment.ID)); err != nil {
 			log.Printf("[TTS] Error generating audio: %v", err)
-			segment.Status = "error"
-			db.UpdateAudioSegment(&segment)
-			return
-		}
-
-		// Save audio file
-		audioFileName := fmt.Sprintf("tts-%s.mp3", segment.ID)
-		audioPath := filepath.Join(config.AppConfig.UploadDir, "audio", audioFileName)
-		if err := os.WriteFile(audioPath, audioData, 0644); err != nil {
-			log.Printf("[TTS] Error saving audio file: %v", err)
-			segment.Status = "error"
-			db.UpdateAudioSegment(&segment)
-			return
-		}
-
-		// Update segment
-		segment.AudioURL = "/audio/" + audioFileName
-		segment.Status = "completed"
-		segment.UpdatedAt = time.Now()
-		if err := db.UpdateAudioSegment(&segment); err != nil {
-			log.Printf("[TTS] Error updating segment: %v", err)
-			return
 		}
-	}()
+	}(segment)
 
+	presentSegment(&segment)
 	json.NewEncoder(w).Encode(segment)
 }
 
@@ -567,367 +854,2205 @@ func getAudioSegmentsHandler(w http.ResponseWriter, r *http.Request) {
 	if segments == nil {
 		segments = []models.AudioSegment{}
 	}
+	for i := range segments {
+		presentSegment(&segments[i])
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(segments)
 }
 
-func getCategoriesHandler(w http.ResponseWriter, r *http.Request) {
-	categories, err := db.GetCategories()
+func getBookPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	book, err := db.GetBookByID(vars["id"])
+	if err != nil {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+
+	// Segment audio is not in a format HLS players accept until it is re-muxed
+	if !hlsPackager.Enabled() {
+		http.Error(w, "HLS playback needs ffmpeg", http.StatusServiceUnavailable)
+		return
+	}
+
+	segments, err := db.GetAudioSegments(book.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get audio segments: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Only a contiguous run of finished segments is published, so a segment
+	// that finishes later is appended instead of inserted. Segments being
+	// regenerated keep serving their previous audio.
+	playlist := &hls.Playlist{}
+	finished := true
+	for _, segment := range segments {
+		if segment.Skip {
+			continue
+		}
+		if segment.AudioURL == "" {
+			finished = false
+			break
+		}
+		// Neither condition changes until the segment is regenerated
+		if segment.Duration <= 0 {
+			log.Printf("[HLS] Skipping segment %s with unknown duration", segment.ID)
+			continue
+		}
+		if !hlsPackager.Exists(book.ID, segment.ID) {
+			log.Printf("[HLS] Skipping segment %s that was not packaged", segment.ID)
+			continue
+		}
+
+		uri := fmt.Sprintf("/hls/%s/%s.ts", book.ID, segment.ID)
+		playlist.Entries = append(playlist.Entries, hls.Entry{
+			URI:      fileStorage.SignedPath(uri),
+			Duration: segment.Duration,
+		})
+	}
+
+	// Processing finishes segments in order, so the playlist only grows while
+	// it runs. Otherwise listed segments may still be edited or regenerated.
+	job, running := jobManager.Get(book.ID)
+	switch {
+	case finished && !running && book.Status != models.BookStatusProcessing:
+		playlist.Type = hls.TypeVOD
+		playlist.Complete = true
+	case running && job.Kind == jobs.KindProcessing:
+		playlist.Type = hls.TypeEvent
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	// Signed segment URIs expire, so a signed playlist is never cached
+	if playlist.Complete && !fileStorage.Signing() {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if err := playlist.Write(w); err != nil {
+		log.Printf("[HLS] Error writing playlist for book %s: %v", book.ID, err)
+	}
+}
+
+// mediaCacheControl returns the Cache-Control policy for stored media files
+func mediaCacheControl() string {
+	return fmt.Sprintf("public, max-age=%d", config.AppConfig.MediaMaxAge)
+}
+
+// serveStoredFileHandler serves files referenced by their storage URL, such
+// as /audio/x.mp3. Once media signing is enabled only signed URLs are served.
+func serveStoredFileHandler(w http.ResponseWriter, r *http.Request) {
+	if fileStorage.Signing() {
+		http.Error(w, "Signed URL required", http.StatusForbidden)
+		return
+	}
+
+	key, err := fileStorage.KeyFor(r.URL.Path)
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	serveStoredObject(w, r, key, mediaCacheControl())
+}
+
+// serveSignedMediaHandler serves a stored file through a signed URL such as
+// /media/audio/x.mp3?expires=...&sig=..., letting clients cache it until the
+// URL expires
+func serveSignedMediaHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, storage.MediaPrefix)
+	expires, ok := verifyMediaRequest(w, r, key)
+	if !ok {
+		return
+	}
+	serveStoredObject(w, r, key, signedCacheControl(expires))
+}
+
+// verifyMediaRequest checks the signature of a request for key, which is a
+// storage key or a route path signed with SignedPath, and responds with 403
+// when it is missing, invalid or expired
+func verifyMediaRequest(w http.ResponseWriter, r *http.Request, key string) (time.Time, bool) {
+	expires, err := fileStorage.VerifyURL(key, r.URL.Query())
+	if err != nil {
+		if errors.Is(err, storage.ErrExpiredURL) {
+			http.Error(w, "Link expired", http.StatusForbidden)
+			return time.Time{}, false
+		}
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return time.Time{}, false
+	}
+	return expires, true
+}
+
+// signedCacheControl lets clients cache media fetched through a signed URL
+// until the URL expires
+func signedCacheControl(expires time.Time) string {
+	maxAge := int(time.Until(expires).Seconds())
+	if maxAge > config.AppConfig.MediaMaxAge {
+		maxAge = config.AppConfig.MediaMaxAge
+	}
+	return fmt.Sprintf("private, max-age=%d", maxAge)
+}
+
+// mediaRouteCacheControl verifies a request for a media route served by
+// book or segment ID once media signing is enabled, and returns the
+// Cache-Control policy for the response
+func mediaRouteCacheControl(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if !fileStorage.Signing() {
+		return mediaCacheControl(), true
+	}
+	expires, ok := verifyMediaRequest(w, r, r.URL.Path)
+	if !ok {
+		return "", false
+	}
+	return signedCacheControl(expires), true
+}
+
+// serveStoredObject writes a stored file to the response, streaming local
+// files from disk and buffering objects read from remote backends
+func serveStoredObject(w http.ResponseWriter, r *http.Request, key string, cacheControl string) {
+	if localPath, ok := fileStorage.LocalFile(key); ok {
+		media.ServeFile(w, r, localPath, cacheControl)
+		return
+	}
+
+	rc, obj, err := fileStorage.Open(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[Media] Error reading %s from storage: %v", key, err)
+		http.Error(w, "Error retrieving file", http.StatusBadGateway)
+		return
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		log.Printf("[Media] Error reading %s from storage: %v", key, err)
+		http.Error(w, "Error retrieving file", http.StatusBadGateway)
+		return
+	}
+
+	media.ServeContent(w, r, path.Base(key), obj.ModTime, obj.ETag, cacheControl, bytes.NewReader(data))
+}
+
+// mediaURL returns the URL clients use to fetch a stored file, signed when
+// media signing is enabled
+func mediaURL(key string) string {
+	u, _ := fileStorage.SignedURL(key, 0)
+	return u
+}
+
+// presentSegment replaces a segment's audio URL with a signed one before it
+// is sent to clients
+func presentSegment(segment *models.AudioSegment) {
+	if !fileStorage.Signing() || segment.AudioURL == "" {
+		return
+	}
+	if key, err := segmentAudioKey(segment); err == nil {
+		segment.AudioURL = mediaURL(key)
+	}
+}
+
+// presentBook fills in the URLs clients use for a book's cover, its
+// thumbnails and source document, signing them when media signing is enabled
+func presentBook(book *models.Book) {
+	for i := range book.Thumbnails {
+		book.Thumbnails[i].URL = mediaURL(book.Thumbnails[i].Key)
+	}
+
+	if book.FileKey != "" {
+		book.DocumentURL = fmt.Sprintf("/api/books/%s/file", book.ID)
+		if fileStorage.Signing() {
+			book.DocumentURL = mediaURL(book.FileKey)
+		}
+	}
+
+	if !fileStorage.Signing() || book.CoverURL == "" {
+		return
+	}
+	key := book.CoverKey
+	if key == "" {
+		key, _ = fileStorage.KeyFor(book.CoverURL)
+	}
+	if key != "" {
+		book.CoverURL = mediaURL(key)
+	}
+}
+
+// segmentAudioKey returns the storage key of a segment's audio. Segments
+// written before keys were recorded are looked up by their audio URL.
+func segmentAudioKey(segment *models.AudioSegment) (string, error) {
+	if segment.AudioKey != "" {
+		return segment.AudioKey, nil
+	}
+	return fileStorage.KeyFor(segment.AudioURL)
+}
+
+func serveHLSSegmentHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := mediaRouteCacheControl(w, r); !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	if !hlsPackager.Exists(vars["bookId"], vars["segmentId"]) {
+		http.Error(w, "Segment not found", http.StatusNotFound)
+		return
+	}
+
+	// Packaged segments are rewritten in place when audio is regenerated, so always revalidate
+	media.ServeFile(w, r, hlsPackager.SegmentPath(vars["bookId"], vars["segmentId"]), "no-cache")
+}
+
+func getSegmentAudioHandler(w http.ResponseWriter, r *http.Request) {
+	cacheControl, ok := mediaRouteCacheControl(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	segment, err := db.GetAudioSegmentByID(vars["segmentId"])
+	if err != nil || segment.BookID != vars["id"] {
+		http.Error(w, "Audio segment not found", http.StatusNotFound)
+		return
+	}
+
+	key, err := segmentAudioKey(segment)
+	if errors.Is(err, storage.ErrRemoteFile) {
+		http.Redirect(w, r, segment.AudioURL, http.StatusFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Audio not available", http.StatusNotFound)
+		return
+	}
+
+	if segment.MimeType != "" {
+		w.Header().Set("Content-Type", segment.MimeType)
+	}
+	serveStoredObject(w, r, key, cacheControl)
+}
+
+func getBookFileHandler(w http.ResponseWriter, r *http.Request) {
+	cacheControl, ok := mediaRouteCacheControl(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	book, err := db.GetBookByID(vars["id"])
+	if err != nil {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+
+	key := book.FileKey
+	if key == "" {
+		// Fall back to the book's file reference, storing remote PDFs on first request
+		key, err = fileStorage.KeyFor(book.FileURL)
+		if errors.Is(err, storage.ErrRemoteFile) {
+			key, err = downloadBookPDF(r.Context(), book)
+			if err != nil {
+				log.Printf("[Media] Error storing PDF for book %s: %v", book.ID, err)
+				http.Error(w, "Error retrieving file", http.StatusBadGateway)
+				return
+			}
+		}
+		if err != nil {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	serveStoredObject(w, r, key, cacheControl)
+}
+
+func getAudioProfilesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"default":  transcoder.Default().Name,
+		"profiles": transcoder.Profiles(),
+	})
+}
+
+// searchHandler finds books by title or author and segments by their text
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			http.Error(w, "limit must be an integer from 1 to 100", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	offset := 0
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	results, err := searchIndex.Search(query, r.URL.Query().Get("bookId"), limit, offset)
+	if err != nil {
+		log.Printf("[Search] Error searching for %q: %v", query, err)
+		http.Error(w, "Error searching", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range results.Books {
+		presentBook(&results.Books[i].Book)
+	}
+	json.NewEncoder(w).Encode(results)
+}
+
+func getCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	categories, err := db.GetCategories()
 	if err != nil {
 		http.Error(w, "Error retrieving categories", http.StatusInternalServerError)
 		return
 	}
 
-	json.NewEncoder(w).Encode(categories)
+	json.NewEncoder(w).Encode(categories)
+}
+
+func getCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	category, err := db.GetCategoryByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(category)
+}
+
+func createCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	var category models.Category
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	category.ID = uuid.New().String()
+	category.CreatedAt = time.Now()
+	if err := db.CreateCategory(&category); err != nil {
+		writeNameError(w, err, "Error creating category")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(category)
+}
+
+// updateCategoryHandler renames a category and replaces its description
+func updateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	category, err := db.GetCategoryByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Name != nil {
+		category.Name = strings.TrimSpace(*req.Name)
+		if category.Name == "" {
+			http.Error(w, "Name must not be empty", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Description != nil {
+		category.Description = *req.Description
+	}
+
+	if err := db.UpdateCategory(category); err != nil {
+		writeNameError(w, err, "Error updating category")
+		return
+	}
+
+	json.NewEncoder(w).Encode(category)
+}
+
+// deleteCategoryHandler deletes a category. Its books are kept.
+func deleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, err := db.GetCategoryByID(id); err != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	if err := db.DeleteCategory(id); err != nil {
+		log.Printf("[Library] Error deleting category %s: %v", id, err)
+		http.Error(w, "Error deleting category", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setBookCategoryHandler adds a book to a category on PUT and removes it on DELETE
+func setBookCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, err := db.GetBookByID(vars["id"]); err != nil {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+	if _, err := db.GetCategoryByID(vars["categoryId"]); err != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	var err error
+	if r.Method == http.MethodDelete {
+		err = db.RemoveBookFromCategory(vars["id"], vars["categoryId"])
+	} else {
+		err = db.AddBookToCategory(vars["id"], vars["categoryId"])
+	}
+	if err != nil {
+		log.Printf("[Library] Error updating categories of book %s: %v", vars["id"], err)
+		http.Error(w, "Error updating book categories", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := db.GetTags()
+	if err != nil {
+		http.Error(w, "Error retrieving tags", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tags)
+}
+
+func getTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag, err := db.GetTagByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tag)
+}
+
+func createTagHandler(w http.ResponseWriter, r *http.Request) {
+	var tag models.Tag
+	if err := json.NewDecoder(r.Body).Decode(&tag); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	tag.Name = strings.TrimSpace(tag.Name)
+	if tag.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	tag.ID = uuid.New().String()
+	tag.CreatedAt = time.Now()
+	if err := db.CreateTag(&tag); err != nil {
+		writeNameError(w, err, "Error creating tag")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tag)
+}
+
+// renameTagHandler renames a tag. Renaming to another tag's name is refused;
+// merge the tags instead.
+func renameTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag, err := db.GetTagByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.RenameTag(tag.ID, name); err != nil {
+		writeNameError(w, err, "Error renaming tag")
+		return
+	}
+
+	tag.Name = name
+	json.NewEncoder(w).Encode(tag)
+}
+
+// deleteTagHandler deletes a tag, removing it from every book
+func deleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, err := db.GetTagByID(id); err != nil {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+
+	if err := db.DeleteTag(id); err != nil {
+		log.Printf("[Library] Error deleting tag %s: %v", id, err)
+		http.Error(w, "Error deleting tag", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// mergeTagsHandler moves the books of the tags listed in the body to the tag
+// in the path and deletes the listed tags
+func mergeTagsHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, err := db.GetTagByID(id); err != nil {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		TagIDs []string `json:"tagIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.TagIDs) == 0 {
+		http.Error(w, "tagIds is required", http.StatusBadRequest)
+		return
+	}
+	for _, sourceID := range req.TagIDs {
+		if _, err := db.GetTagByID(sourceID); err != nil {
+			http.Error(w, fmt.Sprintf("Tag %s not found", sourceID), http.StatusNotFound)
+			return
+		}
+	}
+
+	if err := db.MergeTags(id, req.TagIDs); err != nil {
+		log.Printf("[Library] Error merging tags into %s: %v", id, err)
+		http.Error(w, "Error merging tags", http.StatusInternalServerError)
+		return
+	}
+
+	tag, err := db.GetTagByID(id)
+	if err != nil {
+		http.Error(w, "Error retrieving tag", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(tag)
+}
+
+// bulkTagHandler adds a tag to many books on POST and removes it from them
+// on DELETE. Unknown book IDs are ignored.
+func bulkTagHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, err := db.GetTagByID(id); err != nil {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		BookIDs []string `json:"bookIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.BookIDs) == 0 {
+		http.Error(w, "bookIds is required", http.StatusBadRequest)
+		return
+	}
+
+	var changed int
+	var err error
+	if r.Method == http.MethodDelete {
+		changed, err = db.UntagBooks(id, req.BookIDs)
+	} else {
+		changed, err = db.TagBooks(id, req.BookIDs)
+	}
+	if err != nil {
+		log.Printf("[Library] Error updating books tagged %s: %v", id, err)
+		http.Error(w, "Error updating tagged books", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]int{"changed": changed})
+}
+
+// setBookTagHandler tags a book on PUT and untags it on DELETE
+func setBookTagHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, err := db.GetBookByID(vars["id"]); err != nil {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+	if _, err := db.GetTagByID(vars["tagId"]); err != nil {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+
+	var err error
+	if r.Method == http.MethodDelete {
+		_, err = db.UntagBooks(vars["tagId"], []string{vars["id"]})
+	} else {
+		_, err = db.TagBooks(vars["tagId"], []string{vars["id"]})
+	}
+	if err != nil {
+		log.Printf("[Library] Error updating tags of book %s: %v", vars["id"], err)
+		http.Error(w, "Error updating book tags", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeNameError reports a name clash as a conflict and anything else as a server error
+func writeNameError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, repository.ErrNameTaken) {
+		http.Error(w, "Name is already taken", http.StatusConflict)
+		return
+	}
+	log.Printf("[Library] %s: %v", message, err)
+	http.Error(w, message, http.StatusInternalServerError)
+}
+
+// getBookStatusHandler reports a book's processing status, progress and timeline
+func getBookStatusHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	book, err := db.GetBookByID(vars["id"])
+	if err != nil {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+
+	segments, err := db.GetAudioSegments(book.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get audio segments: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	stages, err := stages.GetBookStages(book.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get processing stages: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(progress.Summarize(book, segments, stages, time.Now()))
+}
+
+func updateBookURLHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var req struct {
+		CloudURL string `json:"cloudUrl"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	book, err := db.GetBookByID(vars["id"])
+	if err != nil {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+	if _, running := jobManager.Get(book.ID); running {
+		http.Error(w, "Book is being processed, cancel it first", http.StatusConflict)
+		return
+	}
+
+	// The stored file came from the old URL, so it is downloaded again when
+	// the book is next processed
+	if err := db.SetBookURL(book.ID, req.CloudURL); err != nil {
+		http.Error(w, "Error updating book", http.StatusInternalServerError)
+		return
+	}
+	if err := collector.ReleaseBookFile(r.Context(), book.ID, book.FileKey); err != nil {
+		log.Printf("[Library] Error releasing old file of book %s: %v", book.ID, err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func generateBookAudioHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bookID := vars["id"]
+
+	// Get the book
+	book, err := db.GetBookByID(bookID)
+	if err != nil {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+
+	// Get segments from the book
+	segments, err := db.GetAudioSegments(book.ID)
+	if err != nil {
+		log.Printf("[Processing] Error getting segments: %v", err)
+		http.Error(w, "Error getting audio segments", http.StatusInternalServerError)
+		return
+	}
+
+	var characters int64
+	for i := range segments {
+		if segments[i].Status == models.SegmentStatusPending && !segments[i].Skip {
+			characters += segmentCharacters(&segments[i])
+		}
+	}
+	if err := quotas.CheckSynthesis(book.UserID, characters); err != nil {
+		writeQuotaError(w, err)
+		return
+	}
+
+	job, err := jobManager.Start(book.ID, jobs.KindProcessing)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	// Restarting generation undoes an earlier cancel
+	if book.Status == models.BookStatusCanceled {
+		if err := setJobStatus(job, book, models.BookStatusReady); err != nil {
+			log.Printf("[TTS] Error updating book status: %v", err)
+		}
+	}
+
+	// Start TTS processing in background
+	go generateBookAudio(job, book, segments)
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "processing",
+		"message": "Audio generation started",
+	})
+}
+
+// generateBookAudio generates audio for a book's pending segments
+func generateBookAudio(job *jobs.Job, book *models.Book, segments []models.AudioSegment) {
+	defer jobManager.Finish(job)
+
+	// Process each segment
+	enterStage(book.ID, models.StageSynthesizing)
+	stageErr := ""
+	for _, segment := range segments {
+		if segment.Status != models.SegmentStatusPending || segment.Skip {
+			continue
+		}
+
+		// Stop here while paused, and for good once canceled
+		if err := job.Wait(); err != nil {
+			stopCanceled(book.ID)
+			return
+		}
+
+		// Other jobs of the same user may have used up the quota meanwhile
+		if err := quotas.CheckSynthesis(book.UserID, segmentCharacters(&segment)); err != nil {
+			log.Printf("[Quota] Stopping synthesis for book %s: %v", book.ID, err)
+			stageErr = err.Error()
+			break
+		}
+
+		if _, err := synthesizeSegment(job.Context(), &segment, ttsGen.DefaultVoiceSettings(), segment.ID); err != nil {
+			log.Printf("[TTS] Error generating audio: %v", err)
+		}
+	}
+
+	leaveStage(book.ID, stageErr)
+}
+
+// segmentPatch is the body of a segment edit; omitted fields are left unchanged
+type segmentPatch struct {
+	Content *string `json:"content"`
+	Skip    *bool   `json:"skip"`
+}
+
+// markSegmentStale resets a segment whose text changed so its audio is
+// generated again. Existing audio keeps playing until it is replaced.
+func markSegmentStale(segment *models.AudioSegment) {
+	if segment.Status == models.SegmentStatusCompleted || segment.Status == models.SegmentStatusError {
+		segment.Status = models.SegmentStatusPending
+	}
+}
+
+func updateAudioSegmentHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	segment, err := db.GetAudioSegmentByID(vars["segmentId"])
+	if err != nil || segment.BookID != vars["id"] {
+		http.Error(w, "Audio segment not found", http.StatusNotFound)
+		return
+	}
+
+	var patch segmentPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if patch.Content == nil && patch.Skip == nil {
+		http.Error(w, "Nothing to update", http.StatusBadRequest)
+		return
+	}
+	if patch.Content != nil && strings.TrimSpace(*patch.Content) == "" {
+		http.Error(w, "Content cannot be empty", http.StatusBadRequest)
+		return
+	}
+	if segment.Status == models.SegmentStatusProcessing {
+		http.Error(w, "Segment is being generated", http.StatusConflict)
+		return
+	}
+
+	if patch.Skip != nil {
+		segment.Skip = *patch.Skip
+	}
+
+	if patch.Content != nil && *patch.Content != segment.Content {
+		previous := segment.Content
+		segment.Content = *patch.Content
+		markSegmentStale(segment)
+		if _, err := db.ReviseAudioSegment(segment, previous, models.RevisionSourceEdit); err != nil {
+			http.Error(w, "Error updating audio segment", http.StatusInternalServerError)
+			return
+		}
+	} else if err := db.UpdateAudioSegment(segment); err != nil {
+		http.Error(w, "Error updating audio segment", http.StatusInternalServerError)
+		return
+	}
+
+	presentSegment(segment)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(segment)
+}
+
+func getSegmentRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	segment, err := db.GetAudioSegmentByID(vars["segmentId"])
+	if err != nil || segment.BookID != vars["id"] {
+		http.Error(w, "Audio segment not found", http.StatusNotFound)
+		return
+	}
+
+	revisions, err := db.GetSegmentRevisions(segment.ID)
+	if err != nil {
+		http.Error(w, "Error retrieving revisions", http.StatusInternalServerError)
+		return
+	}
+	if revisions == nil {
+		revisions = []models.SegmentRevision{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+func replaceSegmentTextHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var req struct {
+		Find          string `json:"find"`
+		Replace       string `json:"replace"`
+		Regex         bool   `json:"regex"`
+		CaseSensitive bool   `json:"caseSensitive"`
+		DryRun        bool   `json:"dryRun"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Find == "" {
+		http.Error(w, "find is required", http.StatusBadRequest)
+		return
+	}
+
+	pattern := req.Find
+	if !req.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if !req.CaseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid pattern: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	segments, err := db.GetAudioSegments(vars["id"])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get audio segments: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	type replacement struct {
+		ID            string `json:"id"`
+		SegmentNumber int    `json:"segmentNumber"`
+		PageNumber    int    `json:"pageNumber"`
+		Matches       int    `json:"matches"`
+		Content       string `json:"content"`
+		Skipped       string `json:"skipped,omitempty"`
+	}
+	results := []replacement{}
+	total := 0
+
+	for _, segment := range segments {
+		matches := len(re.FindAllStringIndex(segment.Content, -1))
+		if matches == 0 {
+			continue
+		}
+
+		replaced := segment.Content
+		if req.Regex {
+			replaced = re.ReplaceAllString(replaced, req.Replace)
+		} else {
+			replaced = re.ReplaceAllLiteralString(replaced, req.Replace)
+		}
+
+		result := replacement{
+			ID:            segment.ID,
+			SegmentNumber: segment.SegmentNumber,
+			PageNumber:    segment.PageNumber,
+			Matches:       matches,
+			Content:       replaced,
+		}
+
+		switch {
+		case segment.Status == models.SegmentStatusProcessing:
+			result.Skipped = "segment is being generated"
+		case strings.TrimSpace(replaced) == "":
+			result.Skipped = "replacement would leave the segment empty"
+		case !req.DryRun && replaced != segment.Content:
+			previous := segment.Content
+			segment.Content = replaced
+			markSegmentStale(&segment)
+			if _, err := db.ReviseAudioSegment(&segment, previous, models.RevisionSourceReplace); err != nil {
+				log.Printf("[Segments] Error replacing text in segment %s: %v", segment.ID, err)
+				result.Skipped = "error saving segment"
+			}
+		}
+
+		if result.Skipped == "" {
+			total += matches
+		}
+		results = append(results, result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dryRun":   req.DryRun,
+		"matches":  total,
+		"segments": results,
+	})
+}
+
+// regenerateRequest carries optional overrides for regenerating audio
+type regenerateRequest struct {
+	Content string `json:"content"`
+	tts.VoiceSettings
+}
+
+// decodeRegenerateRequest reads an optional regenerate request body
+func decodeRegenerateRequest(r *http.Request) (*regenerateRequest, error) {
+	req := &regenerateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if req.Language == "" {
+		req.Language = ttsGen.DefaultVoiceSettings().Language
+	}
+	return req, nil
+}
+
+func regenerateSegmentHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	segment, err := db.GetAudioSegmentByID(vars["segmentId"])
+	if err != nil || segment.BookID != vars["id"] {
+		http.Error(w, "Audio segment not found", http.StatusNotFound)
+		return
+	}
+
+	req, err := decodeRegenerateRequest(r)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if segment.Status == models.SegmentStatusProcessing {
+		http.Error(w, "Segment is already being generated", http.StatusConflict)
+		return
+	}
+	if segment.Skip {
+		http.Error(w, "Segment is excluded from narration", http.StatusConflict)
+		return
+	}
+
+	characters := segmentCharacters(segment)
+	if strings.TrimSpace(req.Content) != "" {
+		characters = int64(utf8.RuneCountInString(req.Content))
+	}
+	if err := quotas.CheckSynthesis(bookOwner(segment.BookID), characters); err != nil {
+		writeQuotaError(w, err)
+		return
+	}
+
+	// Regeneration runs as the book's job so it can be paused or canceled,
+	// and never alongside processing of the same book. It leaves the book's
+	// status alone, since the book stays readable throughout.
+	job, err := jobManager.Start(segment.BookID, jobs.KindRegeneration)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	segment.Status = models.SegmentStatusProcessing
+	if strings.TrimSpace(req.Content) != "" && req.Content != segment.Content {
+		previous := segment.Content
+		segment.Content = req.Content
+		if _, err := db.ReviseAudioSegment(segment, previous, models.RevisionSourceEdit); err != nil {
+			jobManager.Finish(job)
+			http.Error(w, "Error updating audio segment", http.StatusInternalServerError)
+			return
+		}
+	} else if err := db.UpdateAudioSegment(segment); err != nil {
+		jobManager.Finish(job)
+		http.Error(w, "Error updating audio segment", http.StatusInternalServerError)
+		return
+	}
+
+	response := *segment
+	go regenerateSegments(job, []models.AudioSegment{*segment}, req.VoiceSettings)
+
+	presentSegment(&response)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+func regenerateBookPagesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	book, err := db.GetBookByID(vars["id"])
+	if err != nil {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+
+	fromPage, err := strconv.Atoi(r.URL.Query().Get("fromPage"))
+	if err != nil || fromPage < 1 {
+		http.Error(w, "fromPage must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	toPage := fromPage
+	if v := r.URL.Query().Get("toPage"); v != "" {
+		toPage, err = strconv.Atoi(v)
+		if err != nil || toPage < fromPage {
+			http.Error(w, "toPage must be an integer no less than fromPage", http.StatusBadRequest)
+			return
+		}
+	}
+
+	req, err := decodeRegenerateRequest(r)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	segments, err := db.GetAudioSegments(book.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get audio segments: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var candidates []models.AudioSegment
+	var characters int64
+	for _, segment := range segments {
+		// Segments created before page numbers were recorded map one-to-one onto pages
+		page := segment.PageNumber
+		if page == 0 {
+			page = segment.SegmentNumber
+		}
+		if page < fromPage || page > toPage || segment.Skip || segment.Status == models.SegmentStatusProcessing {
+			continue
+		}
+		candidates = append(candidates, segment)
+		characters += segmentCharacters(&segment)
+	}
+
+	if len(candidates) == 0 {
+		http.Error(w, "No segments to regenerate in page range", http.StatusNotFound)
+		return
+	}
+	if err := quotas.CheckSynthesis(book.UserID, characters); err != nil {
+		writeQuotaError(w, err)
+		return
+	}
+
+	job, err := jobManager.Start(book.ID, jobs.KindRegeneration)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	var selected []models.AudioSegment
+	for _, segment := range candidates {
+		segment.Status = models.SegmentStatusProcessing
+		if err := db.UpdateAudioSegment(&segment); err != nil {
+			log.Printf("[Regenerate] Error updating segment %s: %v", segment.ID, err)
+			continue
+		}
+		selected = append(selected, segment)
+	}
+
+	go regenerateSegments(job, selected, req.VoiceSettings)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "processing",
+		"fromPage": fromPage,
+		"toPage":   toPage,
+		"segments": len(selected),
+	})
+}
+
+// regenerateSegments regenerates segments one after another as a book's job.
+// Pausing takes effect between segments; once the job is canceled the
+// segments not yet regenerated return to their previous state.
+func regenerateSegments(job *jobs.Job, segments []models.AudioSegment, settings tts.VoiceSettings) {
+	defer jobManager.Finish(job)
+
+	for i := range segments {
+		if err := job.Wait(); err != nil {
+			for j := range segments[i:] {
+				abandonSegment(&segments[i+j], err)
+			}
+			log.Printf("[Regenerate] Regeneration canceled for book: %s", job.BookID)
+			return
+		}
+		regenerateSegment(job, &segments[i], settings)
+	}
+}
+
+// regenerateSegment synthesizes new audio for a segment within a job and
+// releases the superseded file once nothing refers to it
+func regenerateSegment(job *jobs.Job, segment *models.AudioSegment, settings tts.VoiceSettings) {
+	log.Printf("[Regenerate] Regenerating audio for segment %s", segment.ID)
+
+	// Use a fresh file name so cached copies of the old audio are never served
+	baseName := fmt.Sprintf("%s-%d", segment.ID, time.Now().UnixNano())
+	if _, err := synthesizeSegment(job.Context(), segment, settings, baseName); err != nil {
+		log.Printf("[Regenerate] Error regenerating segment %s: %v", segment.ID, err)
+	}
+}
+
+func processBookHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bookID := vars["id"]
+
+	// Get the book
+	book, err := db.GetBookByID(bookID)
+	if err != nil {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+
+	job, err := jobManager.Start(book.ID, jobs.KindProcessing)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	// Start processing in background
+	go processBook(job, book)
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "processing",
+		"message": "Book processing started",
+	})
+}
+
+// pauseBookHandler pauses a book's processing once the segment in progress finishes
+func pauseBookHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	book, err := db.GetBookByID(vars["id"])
+	if err != nil {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+
+	job, ok := jobManager.Get(book.ID)
+	if !ok || job.Context().Err() != nil {
+		http.Error(w, jobs.ErrNotRunning.Error(), http.StatusConflict)
+		return
+	}
+
+	if err := jobManager.Pause(book.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if job.Kind == jobs.KindProcessing {
+		if err := setBookStatus(book, models.BookStatusPaused, ""); err != nil {
+			http.Error(w, "Error updating book status", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeJobStatus(w, book, job)
+}
+
+// resumeBookHandler resumes a paused book. If the paused job no longer exists,
+// for example after a restart, processing starts again where it stopped.
+func resumeBookHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	book, err := db.GetBookByID(vars["id"])
+	if err != nil {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+
+	// A paused regeneration resumes without touching the book's status
+	job, running := jobManager.Get(book.ID)
+	if running && job.Kind == jobs.KindRegeneration {
+		if !job.Paused() {
+			http.Error(w, "Regeneration is not paused", http.StatusConflict)
+			return
+		}
+		if err := jobManager.Resume(book.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		writeJobStatus(w, book, job)
+		return
+	}
+
+	if book.Status != models.BookStatusPaused {
+		http.Error(w, "Book is not paused", http.StatusConflict)
+		return
+	}
+
+	segments, err := db.GetAudioSegments(book.ID)
+	if err != nil {
+		http.Error(w, "Error getting audio segments", http.StatusInternalServerError)
+		return
+	}
+
+	// Claim a new job before touching the status when the paused one is gone
+	if !running {
+		if job, err = jobManager.Start(book.ID, jobs.KindProcessing); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+	}
+
+	// Books are readable, and so ready, once their text has been segmented
+	status := models.BookStatusProcessing
+	if len(segments) > 0 {
+		status = models.BookStatusReady
+	}
+	if err := setBookStatus(book, status, ""); err != nil {
+		if !running {
+			jobManager.Finish(job)
+		}
+		http.Error(w, "Error updating book status", http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case running:
+		if err := jobManager.Resume(book.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+	case len(segments) > 0:
+		go generateBookAudio(job, book, segments)
+	default:
+		go processBook(job, book)
+	}
+
+	writeJobStatus(w, book, job)
+}
+
+// cancelBookHandler stops a book's processing, aborting the synthesis in
+// progress. Segments that were not generated stay pending.
+func cancelBookHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	book, err := db.GetBookByID(vars["id"])
+	if err != nil {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+
+	// A paused book may have lost its job to a restart but can still be canceled
+	job, running := jobManager.Get(book.ID)
+	if err := jobManager.Cancel(book.ID); err != nil && book.Status != models.BookStatusPaused {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if !running || job.Kind == jobs.KindProcessing {
+		if err := setBookStatus(book, models.BookStatusCanceled, ""); err != nil {
+			http.Error(w, "Error updating book status", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeJobStatus(w, book, job)
+}
+
+// writeJobStatus answers a pause, resume or cancel request with the book's
+// status and the kind of job it affected, if any
+func writeJobStatus(w http.ResponseWriter, book *models.Book, job *jobs.Job) {
+	response := map[string]string{
+		"id":     book.ID,
+		"status": book.Status,
+	}
+	if job != nil {
+		response["job"] = string(job.Kind)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+// processBook downloads a book's PDF, splits it into page segments and
+// generates audio for every pending segment. Pausing takes effect between
+// segments; canceling also aborts the download or synthesis in progress.
+func processBook(job *jobs.Job, book *models.Book) {
+	defer jobManager.Finish(job)
+	log.Printf("[Processing] Starting background processing for book: %s", book.ID)
+
+	if err := setJobStatus(job, book, models.BookStatusProcessing); err != nil {
+		log.Printf("[Processing] Error updating book status: %v", err)
+	}
+
+	// Download the PDF file into storage for processing and for readers,
+	// unless it was stored when the book was uploaded
+	pdfKey := book.FileKey
+	if pdfKey == "" {
+		enterStage(book.ID, models.StageDownloading)
+		key, err := downloadBookPDF(job.Context(), book)
+		if err != nil {
+			if job.Context().Err() != nil {
+				stopCanceled(book.ID)
+				return
+			}
+			log.Printf("[PDF] Error downloading PDF: %v", err)
+			failBook(book, err)
+			return
+		}
+		pdfKey = key
+	}
+
+	enterStage(book.ID, models.StageExtracting)
+	pdfPath, err := fileStorage.LocalPath(job.Context(), pdfKey)
+	if err != nil {
+		log.Printf("[PDF] Error reading PDF from storage: %v", err)
+		failBook(book, err)
+		return
+	}
+	if book.CoverURL == "" {
+		extractCover(job.Context(), book, pdfPath)
+	}
+
+	// Segmenting is all or nothing, so a book with segments needs only audio
+	existing, err := db.GetAudioSegments(book.ID)
+	if err != nil {
+		log.Printf("[Processing] Error getting segments: %v", err)
+		failBook(book, err)
+		return
+	}
+	if len(existing) == 0 {
+		if err := ingestBookText(book, pdfPath); err != nil {
+			log.Printf("[PDF] Error ingesting book %s: %v", book.ID, err)
+			failBook(book, err)
+			return
+		}
+	}
+
+	// The text is readable while audio is generated
+	if err := job.Wait(); err != nil {
+		stopCanceled(book.ID)
+		return
+	}
+	if err := setJobStatus(job, book, models.BookStatusReady); err != nil {
+		log.Printf("[PDF] Error updating book status: %v", err)
+		leaveStage(book.ID, err.Error())
+		return
+	}
+	publishBookProgress(book.ID, nil)
+
+	// Get audio segments from the book
+	audioSegments, err := db.GetAudioSegments(book.ID)
+	if err != nil {
+		log.Printf("[Processing] Error getting segments: %v", err)
+		leaveStage(book.ID, err.Error())
+		return
+	}
+
+	// Process each segment
+	enterStage(book.ID, models.StageSynthesizing)
+	stageErr := ""
+	for _, segment := range audioSegments {
+		if segment.Status != models.SegmentStatusPending || segment.Skip {
+			continue
+		}
+
+		// Stop here while paused, and for good once canceled
+		if err := job.Wait(); err != nil {
+			stopCanceled(book.ID)
+			return
+		}
+
+		// Segments left pending are generated once the quota allows it
+		if err := quotas.CheckSynthesis(book.UserID, segmentCharacters(&segment)); err != nil {
+			log.Printf("[Quota] Stopping synthesis for book %s: %v", book.ID, err)
+			stageErr = err.Error()
+			break
+		}
+
+		if _, err := synthesizeSegment(job.Context(), &segment, ttsGen.DefaultVoiceSettings(), segment.ID); err != nil {
+			log.Printf("[Processing] Error generating audio for segment %s: %v", segment.ID, err)
+		}
+	}
+
+	// Update book status to ready
+	if job.Context().Err() != nil {
+		stopCanceled(book.ID)
+		return
+	}
+	leaveStage(book.ID, stageErr)
+	if err := setJobStatus(job, book, models.BookStatusReady); err != nil {
+		log.Printf("[Processing] Error updating book status: %v", err)
+	}
+	log.Printf("[Processing] Book status updated to ready: %s", book.ID)
+}
+
+// ingestBookText reads a book's metadata and page text from its PDF and
+// records them with one segment per page in a single transaction. On error
+// the book is left without segments, so processing can simply be retried.
+func ingestBookText(book *models.Book, pdfPath string) error {
+	pdfFile, err := os.Open(pdfPath)
+	if err != nil {
+		return fmt.Errorf("error opening PDF: %v", err)
+	}
+	defer pdfFile.Close()
+
+	processedBook, err := pdf.ProcessPDF(pdfFile, filepath.Base(book.FileURL))
+	if err != nil {
+		return fmt.Errorf("error processing PDF: %v", err)
+	}
+
+	pages, err := pdf.ExtractPages(pdfPath)
+	if err != nil {
+		return fmt.Errorf("error extracting text: %v", err)
+	}
+
+	enterStage(book.ID, models.StageSegmenting)
+	now := time.Now()
+	segments := make([]models.AudioSegment, len(pages))
+	for i, page := range pages {
+		segments[i] = models.AudioSegment{
+			ID:            uuid.New().String(),
+			BookID:        book.ID,
+			SegmentNumber: i + 1,
+			PageNumber:    page.PageNumber,
+			Content:       page.Text,
+			Status:        models.SegmentStatusPending,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+	}
+
+	book.PageCount = processedBook.PageCount
+	book.Author = processedBook.Author
+	book.Language = processedBook.Language
+	book.TextFingerprint = pdf.TextFingerprint(pages)
+	if err := db.IngestBook(book, segments); err != nil {
+		return err
+	}
+	log.Printf("[PDF] Saved %d segments for book %s", len(segments), book.ID)
+	return nil
+}
+
+// enterStage records that a book's processing moved on to a new stage and announces it
+func enterStage(bookID, stage string) {
+	if _, err := stages.StartBookStage(bookID, stage); err != nil {
+		log.Printf("[Processing] Error recording %s stage for book %s: %v", stage, bookID, err)
+	}
+	eventHub.Publish(events.New(events.TypeBookStage, bookID, events.StageData{Stage: stage}))
+}
+
+// leaveStage ends a book's current stage, recording the error that stopped it if any
+func leaveStage(bookID, stageErr string) {
+	if err := stages.EndBookStage(bookID, stageErr); err != nil {
+		log.Printf("[Processing] Error ending stage for book %s: %v", bookID, err)
+	}
+}
+
+// stopCanceled ends the current stage of a book whose processing was canceled
+func stopCanceled(bookID string) {
+	log.Printf("[Processing] Processing canceled for book: %s", bookID)
+	leaveStage(bookID, "canceled")
+}
+
+// failBook ends the current stage of a book with err and marks the book as failed
+func failBook(book *models.Book, err error) {
+	leaveStage(book.ID, err.Error())
+	if err := setBookStatus(book, models.BookStatusError, err.Error()); err != nil {
+		log.Printf("[Processing] Error updating book status: %v", err)
+	}
+}
+
+// setBookStatus records a book's status and announces the change to clients.
+// A reason is included with error statuses.
+func setBookStatus(book *models.Book, status, reason string) error {
+	previous := book.Status
+	book.Status = status
+	book.UpdatedAt = time.Now()
+	if err := db.SetBookStatus(book.ID, status); err != nil {
+		return err
+	}
+
+	if previous != status || reason != "" {
+		eventHub.Publish(events.New(events.TypeBookStatus, book.ID, events.BookStatusData{
+			Status:         status,
+			PreviousStatus: previous,
+			Error:          reason,
+		}))
+	}
+	return nil
 }
 
-func getTagsHandler(w http.ResponseWriter, r *http.Request) {
-	tags, err := db.GetTags()
+// setJobStatus records the status a book moves on to while its job runs.
+// The pause and cancel handlers stop the job before writing their status, so
+// checking the job after the write means a pause or cancel that lands
+// meanwhile is never overwritten.
+func setJobStatus(job *jobs.Job, book *models.Book, status string) error {
+	if err := setBookStatus(book, status, ""); err != nil {
+		return err
+	}
+	switch {
+	case job.Context().Err() != nil:
+		return setBookStatus(book, models.BookStatusCanceled, "")
+	case job.Paused():
+		return setBookStatus(book, models.BookStatusPaused, "")
+	}
+	return nil
+}
+
+// synthesizeSegment generates, stores and records the audio for a segment,
+// announcing its start and outcome to clients. It returns the URL the audio
+// is served from. Audio it replaces is deleted unless another row still
+// refers to it. If ctx is canceled the segment returns to its previous state
+// instead of failing.
+func synthesizeSegment(ctx context.Context, segment *models.AudioSegment, settings tts.VoiceSettings, baseName string) (string, error) {
+	superseded := []string{segment.AudioKey, segment.AudioURL}
+	segment.Status = models.SegmentStatusProcessing
+	segment.UpdatedAt = time.Now()
+	if err := db.UpdateAudioSegment(segment); err != nil {
+		log.Printf("[TTS] Error marking segment %s as processing: %v", segment.ID, err)
+	}
+	publishSegmentEvent(events.TypeSegmentStarted, segment, "")
+
+	audioData, err := ttsGen.GenerateAudioWithSettings(ctx, segment.Content, settings)
 	if err != nil {
-		http.Error(w, "Error retrieving tags", http.StatusInternalServerError)
-		return
+		if ctx.Err() != nil {
+			return "", abandonSegment(segment, ctx.Err())
+		}
+		return "", failSegment(segment, fmt.Errorf("error generating audio: %v", err))
+	}
+	if err := quotas.RecordSynthesis(bookOwner(segment.BookID), segment, segmentCharacters(segment)); err != nil {
+		log.Printf("[Quota] Error recording synthesis of segment %s: %v", segment.ID, err)
 	}
 
-	json.NewEncoder(w).Encode(tags)
+	key, err := storeSegmentAudio(ctx, segment, audioData, baseName)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", abandonSegment(segment, ctx.Err())
+		}
+		return "", failSegment(segment, fmt.Errorf("error saving audio: %v", err))
+	}
+
+	audioURL := fileStorage.URL(key)
+	segment.AudioKey = key
+	segment.AudioURL = audioURL
+	segment.Status = models.SegmentStatusCompleted
+	segment.LastError = ""
+	segment.UpdatedAt = time.Now()
+	if err := db.UpdateAudioSegment(segment); err != nil {
+		return "", failSegment(segment, fmt.Errorf("error updating segment: %v", err))
+	}
+
+	// The previous audio is deleted once nothing refers to it, which it
+	// never is when the new audio was written under the same key
+	if err := collector.Release(context.Background(), superseded); err != nil {
+		log.Printf("[TTS] Error releasing superseded audio of segment %s: %v", segment.ID, err)
+	}
+
+	publishSegmentEvent(events.TypeSegmentCompleted, segment, "")
+	publishBookProgress(segment.BookID, segment)
+	return audioURL, nil
 }
 
-func getBookStatusHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	book, err := db.GetBookByID(vars["id"])
-	if err != nil {
-		http.Error(w, "Book not found", http.StatusNotFound)
+// failSegment marks a segment as failed, announces the failure and returns err
+func failSegment(segment *models.AudioSegment, err error) error {
+	segment.Status = models.SegmentStatusError
+	segment.LastError = err.Error()
+	segment.UpdatedAt = time.Now()
+	if updateErr := db.UpdateAudioSegment(segment); updateErr != nil {
+		log.Printf("[TTS] Error marking segment %s as failed: %v", segment.ID, updateErr)
+	}
+
+	publishSegmentEvent(events.TypeSegmentFailed, segment, err.Error())
+	publishBookProgress(segment.BookID, segment)
+	return err
+}
+
+// abandonSegment returns a segment whose synthesis was canceled to pending,
+// or to completed if it still has audio from an earlier run, and returns err
+func abandonSegment(segment *models.AudioSegment, err error) error {
+	segment.Status = models.SegmentStatusPending
+	if segment.AudioURL != "" {
+		segment.Status = models.SegmentStatusCompleted
+	}
+	segment.UpdatedAt = time.Now()
+	if updateErr := db.UpdateAudioSegment(segment); updateErr != nil {
+		log.Printf("[TTS] Error resetting canceled segment %s: %v", segment.ID, updateErr)
+	}
+
+	publishSegmentEvent(events.TypeSegmentCanceled, segment, "")
+	return err
+}
+
+// publishSegmentEvent announces a segment lifecycle change to clients
+// watching its book. The segment is logged with its stored audio URL and
+// signed by presentEvent as it is delivered.
+func publishSegmentEvent(eventType string, segment *models.AudioSegment, reason string) {
+	if segment.BookID == "" {
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"id":     book.ID,
-		"status": book.Status,
-	})
+	snapshot := *segment
+	eventHub.Publish(events.New(eventType, segment.BookID, events.SegmentData{
+		Segment: &snapshot,
+		Error:   reason,
+	}))
 }
 
-func updateBookURLHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	var req struct {
-		CloudURL string `json:"cloudUrl"`
+// presentEvent signs the audio URL of a segment event as it is delivered or
+// replayed. Replayed events carry the payload as it was logged.
+func presentEvent(e events.Event) events.Event {
+	if !fileStorage.Signing() {
+		return e
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	switch e.Type {
+	case events.TypeSegmentStarted, events.TypeSegmentCompleted, events.TypeSegmentFailed, events.TypeSegmentCanceled:
+	default:
+		return e
+	}
+
+	var data events.SegmentData
+	switch payload := e.Data.(type) {
+	case events.SegmentData:
+		data = payload
+	case json.RawMessage:
+		if err := json.Unmarshal(payload, &data); err != nil {
+			log.Printf("[Events] Error decoding %s event %d: %v", e.Type, e.ID, err)
+			return e
+		}
+	default:
+		return e
+	}
+	if data.Segment == nil {
+		return e
+	}
+
+	snapshot := *data.Segment
+	presentSegment(&snapshot)
+	data.Segment = &snapshot
+	e.Data = data
+	return e
+}
+
+// publishBookProgress announces how much of a book has been narrated. When
+// changed is a segment that just completed and it finishes its chapter, the
+// chapter is announced as ready too.
+func publishBookProgress(bookID string, changed *models.AudioSegment) {
+	if bookID == "" {
 		return
 	}
 
-	book, err := db.GetBookByID(vars["id"])
+	segments, err := db.GetAudioSegments(bookID)
 	if err != nil {
-		http.Error(w, "Book not found", http.StatusNotFound)
+		log.Printf("[Events] Error getting segments for book %s: %v", bookID, err)
 		return
 	}
 
-	book.FileURL = req.CloudURL
-	if err := db.UpdateBook(book); err != nil {
-		http.Error(w, "Error updating book", http.StatusInternalServerError)
+	counts := progress.CountSegments(segments)
+	eventHub.Publish(events.New(events.TypeBookProgress, bookID, events.ProgressData{
+		Total:     counts.Total,
+		Completed: counts.Completed,
+		Failed:    counts.Error,
+		Skipped:   counts.Skipped,
+		Percent:   counts.Percent(),
+	}))
+
+	if changed == nil || changed.Status != models.SegmentStatusCompleted {
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	texts := make([]string, len(segments))
+	for i, segment := range segments {
+		texts[i] = segment.Content
+	}
+	for _, chapter := range audio.SplitChapters(texts) {
+		members := segments[chapter.Start : chapter.End+1]
+		if !containsSegment(members, changed.ID) {
+			continue
+		}
+
+		data := events.ChapterData{
+			Chapter:     chapter.Number,
+			Title:       chapter.Title,
+			FromSegment: members[0].SegmentNumber,
+			ToSegment:   members[len(members)-1].SegmentNumber,
+		}
+		for _, segment := range members {
+			if segment.Skip {
+				continue
+			}
+			if segment.Status != models.SegmentStatusCompleted || segment.AudioURL == "" {
+				return
+			}
+			data.Duration += segment.Duration
+		}
+		eventHub.Publish(events.New(events.TypeChapterReady, bookID, data))
+		return
+	}
 }
 
-func generateBookAudioHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	bookID := vars["id"]
+// containsSegment reports whether a segment with the given ID is in segments
+func containsSegment(segments []models.AudioSegment, id string) bool {
+	for _, segment := range segments {
+		if segment.ID == id {
+			return true
+		}
+	}
+	return false
+}
 
-	// Get the book
-	book, err := db.GetBookByID(bookID)
+// segmentBreak classifies the boundary between a segment and the one after it
+func segmentBreak(segment *models.AudioSegment) audio.Break {
+	if segment.BookID == "" || segment.SegmentNumber == 0 {
+		return audio.BreakNone
+	}
+
+	next, err := db.GetAudioSegmentByNumber(segment.BookID, segment.SegmentNumber+1)
 	if err != nil {
-		http.Error(w, "Book not found", http.StatusNotFound)
-		return
+		return audio.BreakNone
 	}
 
-	// Get segments from the book
-	segments, err := db.GetAudioSegments(book.ID)
+	return audio.ClassifyBreak(segment.Content, next.Content)
+}
+
+// downloadBookPDF fetches a book's source PDF into file storage, records its
+// storage key on the book and returns the key
+func downloadBookPDF(ctx context.Context, book *models.Book) (string, error) {
+	key, err := fetchBookPDF(ctx, book)
 	if err != nil {
-		log.Printf("[Processing] Error getting segments: %v", err)
-		http.Error(w, "Error getting audio segments", http.StatusInternalServerError)
-		return
+		return "", err
 	}
 
-	// Start TTS processing in background
-	go func() {
-		// Process each segment
-		for _, segment := range segments {
-			if segment.Status != "pending" {
-				continue
-			}
+	book.UpdatedAt = time.Now()
+	if err := db.SetBookFile(book.ID, book.FileKey, book.FileSize, book.ContentHash); err != nil {
+		return "", fmt.Errorf("error recording PDF key: %v", err)
+	}
+	return key, nil
+}
 
-			// Generate audio
-			audioData, err := ttsGen.GenerateAudio(segment.Content)
-			if err != nil {
-				log.Printf("[TTS] Error generating audio: %v", err)
-				segment.Status = "error"
-				db.UpdateAudioSegment(&segment)
-				continue
-			}
+// fetchBookPDF downloads a book's PDF into storage and sets the book's file
+// key, size and content hash without saving the book
+func fetchBookPDF(ctx context.Context, book *models.Book) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", book.FileURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating download request: %v", err)
+	}
 
-			// Save audio to temporary file for immediate playback
-			audioFileName := fmt.Sprintf("tts-%s.mp3", uuid.New().String())
-			audioPath := filepath.Join(config.AppConfig.UploadDir, "audio", audioFileName)
-			if err := os.WriteFile(audioPath, audioData, 0644); err != nil {
-				log.Printf("[TTS] Error writing audio file: %v", err)
-				segment.Status = "error"
-				db.UpdateAudioSegment(&segment)
-				continue
-			}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error downloading PDF: %v", err)
+	}
+	defer resp.Body.Close()
 
-			// Update segment with local URL
-			segment.AudioURL = "/audio/" + audioFileName
-			segment.Status = "completed"
-			segment.UpdatedAt = time.Now()
-			if err := db.UpdateAudioSegment(&segment); err != nil {
-				log.Printf("[TTS] Error updating audio segment: %v", err)
-				continue
-			}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error downloading PDF: %s", resp.Status)
+	}
 
-			// Notify WebSocket clients about the new audio
-			if conns, ok := wsConnections[book.ID]; ok {
-				notification := map[string]interface{}{
-					"type":    "audio_ready",
-					"segment": segment,
-				}
-				for _, conn := range conns {
-					if err := conn.WriteJSON(notification); err != nil {
-						log.Printf("[WS] Error sending notification: %v", err)
-					}
-				}
-			}
+	limit := config.AppConfig.MaxUploadSize
+	if limit > 0 && resp.ContentLength > limit {
+		return "", errFileTooLarge
+	}
+	body := io.Reader(resp.Body)
+	if limit > 0 {
+		// One byte past the limit is enough to tell the file is too large
+		body = io.LimitReader(resp.Body, limit+1)
+	}
 
-			// Upload to UploadThing in background
-			go func(segmentID string, audioPath string, audioData []byte, segment models.AudioSegment) {
-				log.Printf("[Upload] Starting UploadThing upload for segment: %s", segmentID)
-				uploadURL, err := uploadToUploadThing(audioPath)
-				if err != nil {
-					log.Printf("[Upload] Error uploading to UploadThing: %v", err)
-					return
-				}
-
-				// Update segment with UploadThing URL
-				segment.AudioURL = uploadURL
-				segment.UpdatedAt = time.Now()
-				if err := db.UpdateAudioSegment(&segment); err != nil {
-					log.Printf("[Upload] Error updating segment with UploadThing URL: %v", err)
-					return
-				}
-
-				// Clean up local file
-				os.Remove(audioPath)
-			}(segment.ID, audioPath, audioData, segment)
-		}
-	}()
+	hash := sha256.New()
+	counter := &byteCounter{}
+	key, err := fileStorage.SaveBookPDF(ctx, book.ID, io.TeeReader(body, io.MultiWriter(hash, counter)))
+	if err != nil {
+		return "", err
+	}
+	if limit > 0 && counter.n > limit {
+		if err := fileStorage.Delete(ctx, key); err != nil {
+			log.Printf("[Upload] Error deleting oversized file %s: %v", key, err)
+		}
+		return "", errFileTooLarge
+	}
 
-	w.WriteHeader(http.StatusAccepted)
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "processing",
-		"message": "Audio generation started",
-	})
+	book.FileKey = key
+	book.ContentHash = hex.EncodeToString(hash.Sum(nil))
+	book.FileSize = counter.n
+	return key, nil
 }
 
-func processBookHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	bookID := vars["id"]
+// errFileTooLarge is returned for a download larger than MAX_UPLOAD_SIZE
+var errFileTooLarge = errors.New("file is larger than the maximum upload size")
 
-	// Get the book
-	book, err := db.GetBookByID(bookID)
+// byteCounter counts the bytes written to it
+type byteCounter struct {
+	n int64
+}
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// hashStoredBooks records the content hash of books whose files were stored
+// before hashes were, then logs how many duplicate groups there are to review
+func hashStoredBooks(ctx context.Context) {
+	books, err := duplicates.GetUnhashedBooks()
 	if err != nil {
-		http.Error(w, "Book not found", http.StatusNotFound)
+		log.Printf("[Duplicates] Error listing unhashed books: %v", err)
 		return
 	}
 
-	// Start processing in background
-	go func() {
-		// Download the PDF file
-		resp, err := http.Get(book.FileURL)
+	for _, book := range books {
+		rc, _, err := fileStorage.Open(ctx, book.FileKey)
 		if err != nil {
-			log.Printf("[PDF] Error downloading PDF: %v", err)
-			book.Status = "error"
-			db.UpdateBook(book)
-			return
+			log.Printf("[Duplicates] Error opening file of book %s: %v", book.ID, err)
+			continue
 		}
-		defer resp.Body.Close()
-
-		// Process PDF
-		processedBook, err := pdf.ProcessPDF(resp.Body, filepath.Base(book.FileURL))
+		hash := sha256.New()
+		_, err = io.Copy(hash, rc)
+		rc.Close()
 		if err != nil {
-			log.Printf("[PDF] Error processing PDF: %v", err)
-			book.Status = "error"
-			db.UpdateBook(book)
-			return
+			log.Printf("[Duplicates] Error reading file of book %s: %v", book.ID, err)
+			continue
 		}
-
-		// Update book with processed information
-		book.PageCount = processedBook.PageCount
-		book.Author = processedBook.Author
-		book.Language = processedBook.Language
-		if err := db.UpdateBook(book); err != nil {
-			log.Printf("[PDF] Error updating book: %v", err)
-			return
+		if err := duplicates.SetBookContentHash(book.ID, hex.EncodeToString(hash.Sum(nil))); err != nil {
+			log.Printf("[Duplicates] %v", err)
 		}
+	}
+	if len(books) > 0 {
+		log.Printf("[Duplicates] Hashed %d stored books", len(books))
+	}
 
-		// Create temporary file for PDF processing
-		tmpFile, err := os.CreateTemp("", "book-*.pdf")
-		if err != nil {
-			log.Printf("[PDF] Error creating temp file: %v", err)
-			book.Status = "error"
-			db.UpdateBook(book)
-			return
-		}
-		defer os.Remove(tmpFile.Name())
+	report, err := duplicates.DuplicateReport()
+	if err != nil {
+		log.Printf("[Duplicates] Error building duplicate report: %v", err)
+		return
+	}
+	if len(report.Groups) > 0 {
+		log.Printf("[Duplicates] Found %d groups of possible duplicate books, review them at GET /api/admin/duplicates", len(report.Groups))
+	}
+}
 
-		// Copy PDF to temporary file
-		if _, err := io.Copy(tmpFile, resp.Body); err != nil {
-			log.Printf("[PDF] Error copying to temp file: %v", err)
-			book.Status = "error"
-			db.UpdateBook(book)
-			return
+// extractCover attaches the cover embedded in a book's document, if it has
+// one and no cover was set since processing started
+func extractCover(ctx context.Context, book *models.Book, documentPath string) {
+	img, err := cover.Extract(documentPath)
+	if err != nil {
+		if !errors.Is(err, cover.ErrNoCover) {
+			log.Printf("[Cover] Error extracting cover of book %s: %v", book.ID, err)
 		}
+		return
+	}
 
-		// Extract text segments
-		textSegments, err := pdf.ExtractText(tmpFile.Name())
+	if current, err := db.GetBookByID(book.ID); err == nil && (current.CoverKey != "" || current.CoverURL != "") {
+		book.CoverKey, book.CoverURL = current.CoverKey, current.CoverURL
+		return
+	}
+	if err := quotas.CheckStorage(book.UserID, int64(len(img.Data))); err != nil {
+		log.Printf("[Quota] Not attaching extracted cover to book %s: %v", book.ID, err)
+		return
+	}
+	if err := attachCover(ctx, book, img.Data); err != nil {
+		log.Printf("[Cover] Error attaching extracted cover to book %s: %v", book.ID, err)
+		return
+	}
+	log.Printf("[Cover] Extracted cover for book %s", book.ID)
+}
+
+// attachCover stores an image as a book's cover along with its thumbnails,
+// then deletes the files of the cover it replaces
+func attachCover(ctx context.Context, book *models.Book, data []byte) error {
+	thumbs, format, err := cover.Thumbnails(data, config.AppConfig.ThumbnailSizes)
+	if err != nil {
+		return err
+	}
+
+	// Files written before a failure are left for the garbage collector
+	coverKey, err := fileStorage.SaveCover(ctx, bytes.NewReader(data), "cover."+format)
+	if err != nil {
+		return err
+	}
+	var thumbnails []models.CoverThumbnail
+	for _, thumb := range thumbs {
+		key, err := fileStorage.SaveThumbnail(ctx, coverKey, thumb.Width, thumb.Data)
 		if err != nil {
-			log.Printf("[PDF] Error extracting text: %v", err)
-			book.Status = "error"
-			db.UpdateBook(book)
-			return
+			return err
 		}
+		thumbnails = append(thumbnails, models.CoverThumbnail{
+			BookID: book.ID,
+			Width:  thumb.Width,
+			Height: thumb.Height,
+			Key:    key,
+			Size:   int64(len(thumb.Data)),
+		})
+	}
 
-		// Create audio segments
-		for i, text := range textSegments {
-			segment := &models.AudioSegment{
-				ID:        uuid.New().String(),
-				BookID:    book.ID,
-				Content:   text,
-				Status:    "pending",
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
-			}
-			if err := db.SaveAudioSegment(segment); err != nil {
-				log.Printf("[PDF] Error saving segment %d: %v", i+1, err)
-				continue
-			}
-		}
+	// The cover and its thumbnails count against the owner's storage quota
+	book.CoverKey = coverKey
+	book.CoverSize = int64(len(data))
+	book.CoverURL = fileStorage.URL(coverKey)
+	book.UpdatedAt = time.Now()
+	replaced, err := db.SetBookCover(book, thumbnails)
+	if err != nil {
+		return err
+	}
+	book.Thumbnails = thumbnails
 
-		// Update book status
-		book.Status = "ready"
-		book.UpdatedAt = time.Now()
-		if err := db.UpdateBook(book); err != nil {
-			log.Printf("[PDF] Error updating book status: %v", err)
-			return
-		}
+	// Only the cover the committed write replaced is released, so a cover
+	// changed concurrently is never left pointing at deleted files
+	return collector.Release(ctx, replaced)
+}
 
-		// Get audio segments from the book
-		audioSegments, err := db.GetAudioSegments(book.ID)
+// storeSegmentAudio post-processes generated audio for a segment, encodes it
+// into the configured output profile and writes it to file storage as
+// baseName plus the extension of the real container. It records the format
+// and duration on the segment, packages it for HLS playback and returns the
+// storage key of the audio. Encoding stops early if ctx is canceled.
+func storeSegmentAudio(ctx context.Context, segment *models.AudioSegment, audioData []byte, baseName string) (string, error) {
+	// Normalize loudness, trim silence and add the pause for the following break
+	if audioProc.Enabled() {
+		processed, err := audioProc.Process(ctx, audioData, audioProc.OptionsFor(segmentBreak(segment)))
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
 		if err != nil {
-			log.Printf("[Processing] Error getting segments: %v", err)
-			return
+			log.Printf("[Audio] Error processing audio for segment %s: %v", segment.ID, err)
+		} else {
+			audioData = processed
 		}
+	}
 
-		// Process each segment
-		for _, segment := range audioSegments {
-			if segment.Status != "pending" {
-				continue
-			}
+	// Encode into the output profile, falling back to the provider's format
+	profile := transcoder.Default()
+	encoded, info, err := transcoder.Transcode(ctx, audioData, profile)
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err != nil {
+		log.Printf("[Audio] Error transcoding segment %s to %s: %v", segment.ID, profile.Name, err)
+		encoded = audioData
+		info, _ = audio.Probe(audioData)
+	}
 
-			// Generate audio for the segment
-			audioData, err := ttsGen.ProcessAudioSegment(&segment)
-			if err != nil {
-				log.Printf("[Processing] Error generating audio for segment %s: %v", segment.ID, err)
-				segment.Status = "error"
-				db.UpdateAudioSegment(&segment)
-				continue
-			}
+	format := audio.FormatOf(info)
+	key, err := fileStorage.SaveAudio(context.Background(), encoded, baseName+format.Extension, format.MimeType)
+	if err != nil {
+		return "", err
+	}
 
-			// Save audio to file
-			audioFileName := fmt.Sprintf("%s.mp3", segment.ID)
-			audioPath := filepath.Join("audio", audioFileName)
-			if err := os.WriteFile(audioPath, audioData, 0644); err != nil {
-				log.Printf("[Processing] Error saving audio file for segment %s: %v", segment.ID, err)
-				segment.Status = "error"
-				db.UpdateAudioSegment(&segment)
-				continue
-			}
+	segment.AudioSize = int64(len(encoded))
+	segment.Container = format.Container
+	segment.Codec = format.Codec
+	segment.MimeType = format.MimeType
+	if info != nil {
+		segment.Duration = info.Duration.Seconds()
+	}
 
-			// Update segment with audio URL and status
-			segment.AudioURL = audioPath
-			segment.Status = "ready"
-			segment.UpdatedAt = time.Now()
-			if err := db.UpdateAudioSegment(&segment); err != nil {
-				log.Printf("[Processing] Error updating segment %s: %v", segment.ID, err)
-				continue
-			}
+	if err := hlsPackager.Package(segment.BookID, segment.ID, encoded, format.Codec); err != nil {
+		log.Printf("[HLS] Error packaging segment %s: %v", segment.ID, err)
+	}
+
+	return key, nil
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for a request,
+// or "" if its origin is not in ALLOWED_ORIGINS. A "*" entry allows every
+// origin unless media signing is enabled, since signed links would otherwise
+// be readable by any site.
+func allowedOrigin(r *http.Request) string {
+	origin := r.Header.Get("Origin")
+	for _, allowed := range config.AppConfig.AllowedOrigins {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == "*" && !fileStorage.Signing() {
+			return "*"
+		}
+		if origin != "" && allowed == origin {
+			return origin
 		}
+	}
+	return ""
+}
 
-		// Update book status to ready
-		book.Status = "ready"
-		book.UpdatedAt = time.Now()
-		if err := db.UpdateBook(book); err != nil {
-			log.Printf("[Processing] Error updating book status: %v", err)
+// requireAdmin restricts a handler to requests carrying ADMIN_TOKEN as a
+// bearer token. Without a token, admin routes are closed.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := config.AppConfig.AdminToken
+		if token == "" {
+			http.Error(w, "Admin access is not configured", http.StatusForbidden)
+			return
 		}
-	}()
 
-	w.WriteHeader(http.StatusAccepted)
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "processing",
-		"message": "Book processing started",
-	})
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
 }
 
-func uploadToUploadThing(filePath string) (string, error) {
-	file, err := os.Open(filePath)
+// duplicateReportHandler lists groups of books that look like duplicates so
+// they can be reviewed and deleted by hand
+func duplicateReportHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := duplicates.DuplicateReport()
 	if err != nil {
-		return "", fmt.Errorf("error opening file: %v", err)
+		log.Printf("[Duplicates] Error building duplicate report: %v", err)
+		http.Error(w, "Error building duplicate report", http.StatusInternalServerError)
+		return
 	}
-	defer file.Close()
+	for i := range report.Groups {
+		for j := range report.Groups[i].Books {
+			presentBook(&report.Groups[i].Books[j])
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
 
-	// Create multipart form
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+// collectGarbageHandler reports stored files that nothing references. GET
+// and ?dryRun=true only report them; POST deletes them.
+func collectGarbageHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun := r.Method == http.MethodGet || r.URL.Query().Get("dryRun") == "true"
 
-	// Add file
-	part, err := writer.CreateFormFile("file", filepath.Base(filePath))
+	report, err := collector.Run(r.Context(), dryRun)
 	if err != nil {
-		return "", fmt.Errorf("error creating form file: %v", err)
+		log.Printf("[GC] Error collecting orphaned files: %v", err)
+		http.Error(w, "Error collecting orphaned files", http.StatusInternalServerError)
+		return
 	}
-	if _, err := io.Copy(part, file); err != nil {
-		return "", fmt.Errorf("error copying file: %v", err)
+	if !dryRun {
+		log.Printf("[GC] Deleted %d of %d orphaned files (%d bytes)", report.Deleted, len(report.Orphans), report.OrphanBytes)
 	}
-	writer.Close()
 
-	// Create request
-	req, err := http.NewRequest("POST", config.AppConfig.UploadThingURL, body)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// segmentCharacters returns the number of characters a segment sends for synthesis
+func segmentCharacters(segment *models.AudioSegment) int64 {
+	return int64(utf8.RuneCountInString(segment.Content))
+}
+
+// bookOwner returns the ID of the user a book belongs to, or "" if it has no owner
+func bookOwner(bookID string) string {
+	if bookID == "" {
+		return ""
+	}
+	book, err := db.GetBookByID(bookID)
 	if err != nil {
-		return "", fmt.Errorf("error creating request: %v", err)
+		return ""
 	}
+	return book.UserID
+}
 
-	// Set headers
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("Authorization", "Bearer "+config.AppConfig.UploadThingToken)
+// writeQuotaError responds to a request refused by a quota check
+func writeQuotaError(w http.ResponseWriter, err error) {
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		http.Error(w, exceeded.Error(), http.StatusForbidden)
+		return
+	}
+	log.Printf("[Quota] Error checking quota: %v", err)
+	http.Error(w, "Error checking quota", http.StatusInternalServerError)
+}
 
-	// Send request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// getUsageHandler reports the requesting user's consumption against their quotas
+func getUsageHandler(w http.ResponseWriter, r *http.Request) {
+	usage, err := quotas.Usage(r.Header.Get("X-User-ID"), time.Now())
 	if err != nil {
-		return "", fmt.Errorf("error uploading to UploadThing: %v", err)
+		log.Printf("[Quota] Error getting usage: %v", err)
+		http.Error(w, "Error getting usage", http.StatusInternalServerError)
+		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("UploadThing error: %s", resp.Status)
-	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
 
-	// Parse response
-	var result struct {
-		URL string `json:"url"`
+// updateUserQuotaHandler sets a user's quota overrides and returns their usage
+func updateUserQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var override models.UserQuota
+	if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	for _, limit := range []*int64{override.StorageBytes, override.Books, override.MonthlyCharacters} {
+		if limit != nil && *limit < 0 {
+			http.Error(w, "Limits must not be negative", http.StatusBadRequest)
+			return
+		}
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("error decoding response: %v", err)
+
+	override.UserID = vars["id"]
+	if err := quotas.SetOverride(&override); err != nil {
+		log.Printf("[Quota] Error saving quota for user %s: %v", override.UserID, err)
+		http.Error(w, "Error saving quota", http.StatusInternalServerError)
+		return
 	}
 
-	return result.URL, nil
+	usage, err := quotas.Usage(override.UserID, time.Now())
+	if err != nil {
+		http.Error(w, "Error getting usage", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
 }
@@ -0,0 +1,155 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"backend/domain/models"
+)
+
+// SaveAudioSegment saves a new audio segment
+func (s *Store) SaveAudioSegment(segment *models.AudioSegment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.segments[segment.ID]; ok {
+		return fmt.Errorf("error saving audio segment: segment %s already exists", segment.ID)
+	}
+	if _, ok := s.books[segment.BookID]; !ok {
+		return fmt.Errorf("error saving audio segment: book %s: %w", segment.BookID, errNotFound)
+	}
+	s.segments[segment.ID] = *segment
+	return nil
+}
+
+// UpdateAudioSegment updates the text, audio and status of a segment
+func (s *Store) UpdateAudioSegment(segment *models.AudioSegment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	segment.UpdatedAt = time.Now()
+	stored, ok := s.segments[segment.ID]
+	if !ok {
+		return nil
+	}
+	updated := *segment
+	updated.BookID = stored.BookID
+	updated.SegmentNumber = stored.SegmentNumber
+	updated.PageNumber = stored.PageNumber
+	updated.CreatedAt = stored.CreatedAt
+	s.segments[segment.ID] = updated
+	return nil
+}
+
+// GetAudioSegments retrieves all audio segments for a book in playback order
+func (s *Store) GetAudioSegments(bookID string) ([]models.AudioSegment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var segments []models.AudioSegment
+	for _, segment := range s.segments {
+		if segment.BookID == bookID {
+			segments = append(segments, segment)
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].SegmentNumber != segments[j].SegmentNumber {
+			return segments[i].SegmentNumber < segments[j].SegmentNumber
+		}
+		return segments[i].CreatedAt.Before(segments[j].CreatedAt)
+	})
+	return segments, nil
+}
+
+// GetAudioSegmentByID retrieves an audio segment by its ID
+func (s *Store) GetAudioSegmentByID(id string) (*models.AudioSegment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	segment, ok := s.segments[id]
+	if !ok {
+		return nil, fmt.Errorf("error getting audio segment: %w", errNotFound)
+	}
+	return &segment, nil
+}
+
+// GetAudioSegmentByNumber retrieves the segment at a position within a book
+func (s *Store) GetAudioSegmentByNumber(bookID string, segmentNumber int) (*models.AudioSegment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, segment := range s.segments {
+		if segment.BookID == bookID && segment.SegmentNumber == segmentNumber {
+			return &segment, nil
+		}
+	}
+	return nil, fmt.Errorf("error getting audio segment: %w", errNotFound)
+}
+
+// DeleteAudioSegment deletes an audio segment and its revision history
+func (s *Store) DeleteAudioSegment(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.revisions, id)
+	delete(s.segments, id)
+	return nil
+}
+
+// ReviseAudioSegment saves a segment whose text changed and appends the new
+// text to its revision history. The first time a segment is revised its
+// previous text is recorded as the original revision.
+func (s *Store) ReviseAudioSegment(segment *models.AudioSegment, previousContent, source string) (*models.SegmentRevision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.segments[segment.ID]
+	if !ok {
+		return nil, fmt.Errorf("error saving revision: segment %s: %w", segment.ID, errNotFound)
+	}
+
+	now := time.Now()
+	revisions := s.revisions[segment.ID]
+	if len(revisions) == 0 {
+		revisions = append(revisions, models.SegmentRevision{
+			ID:        uuid.New().String(),
+			SegmentID: segment.ID,
+			Revision:  1,
+			Content:   previousContent,
+			Source:    models.RevisionSourceExtracted,
+			CreatedAt: segment.CreatedAt,
+		})
+	}
+
+	revision := models.SegmentRevision{
+		ID:        uuid.New().String(),
+		SegmentID: segment.ID,
+		Revision:  revisions[len(revisions)-1].Revision + 1,
+		Content:   segment.Content,
+		Source:    source,
+		CreatedAt: now,
+	}
+	s.revisions[segment.ID] = append(revisions, revision)
+
+	segment.UpdatedAt = now
+	stored.Content = segment.Content
+	stored.Status = segment.Status
+	stored.Skip = segment.Skip
+	stored.UpdatedAt = now
+	s.segments[segment.ID] = stored
+	return &revision, nil
+}
+
+// GetSegmentRevisions retrieves the revision history of a segment, oldest first
+func (s *Store) GetSegmentRevisions(segmentID string) ([]models.SegmentRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.revisions[segmentID]) == 0 {
+		return nil, nil
+	}
+	return append([]models.SegmentRevision(nil), s.revisions[segmentID]...), nil
+}
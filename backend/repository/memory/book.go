@@ -0,0 +1,434 @@
+package memory
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/domain/models"
+	"backend/repository"
+)
+
+// SaveBook saves a new book
+func (s *Store) SaveBook(book *models.Book) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.books[book.ID]; ok {
+		return fmt.Errorf("error saving book: book %s already exists", book.ID)
+	}
+	s.books[book.ID] = storedBook(book)
+	return nil
+}
+
+// GetBookByID retrieves a book by its ID
+func (s *Store) GetBookByID(id string) (*models.Book, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	book, ok := s.books[id]
+	if !ok {
+		return nil, fmt.Errorf("error getting book: %w", errNotFound)
+	}
+	return s.hydrate(book), nil
+}
+
+// UpdateBook updates an existing book
+func (s *Store) UpdateBook(book *models.Book) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	book.UpdatedAt = time.Now()
+	stored, ok := s.books[book.ID]
+	if !ok {
+		return nil
+	}
+	updated := storedBook(book)
+	updated.UserID = stored.UserID
+	updated.CreatedAt = stored.CreatedAt
+	s.books[book.ID] = updated
+	return nil
+}
+
+// SetBookMetadata changes only a book's title, author, language,
+// description, series and ISBN
+func (s *Store) SetBookMetadata(book *models.Book) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	book.UpdatedAt = time.Now()
+	if stored, ok := s.books[book.ID]; ok {
+		stored.Title = book.Title
+		stored.Author = book.Author
+		stored.Language = book.Language
+		stored.Description = book.Description
+		stored.Series = book.Series
+		stored.ISBN = book.ISBN
+		stored.UpdatedAt = book.UpdatedAt
+		s.books[book.ID] = stored
+	}
+	return nil
+}
+
+// SetBookStatus changes only a book's status
+func (s *Store) SetBookStatus(bookID, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.books[bookID]; ok {
+		stored.Status = status
+		stored.UpdatedAt = time.Now()
+		s.books[bookID] = stored
+	}
+	return nil
+}
+
+// SetBookFile changes only the storage key, size and content hash of a book's source file
+func (s *Store) SetBookFile(bookID, key string, size int64, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.books[bookID]; ok {
+		stored.FileKey = key
+		stored.FileSize = size
+		stored.ContentHash = hash
+		stored.UpdatedAt = time.Now()
+		s.books[bookID] = stored
+	}
+	return nil
+}
+
+// SetBookURL changes a book's source URL and clears its stored file
+func (s *Store) SetBookURL(bookID, url string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.books[bookID]; ok {
+		stored.FileURL = url
+		stored.FileKey = ""
+		stored.FileSize = 0
+		stored.ContentHash = ""
+		stored.UpdatedAt = time.Now()
+		s.books[bookID] = stored
+	}
+	return nil
+}
+
+// IngestBook records a processed book's page count and text fingerprint,
+// and its author and language where they are empty, and replaces its segments
+func (s *Store) IngestBook(book *models.Book, segments []models.AudioSegment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.books[book.ID]
+	if !ok {
+		return fmt.Errorf("error ingesting book: %w", errNotFound)
+	}
+	seen := make(map[string]bool, len(segments))
+	for _, segment := range segments {
+		existing, ok := s.segments[segment.ID]
+		if seen[segment.ID] || ok && existing.BookID != book.ID {
+			return fmt.Errorf("error saving segments: segment %s already exists", segment.ID)
+		}
+		seen[segment.ID] = true
+	}
+
+	stored.PageCount = book.PageCount
+	stored.TextFingerprint = book.TextFingerprint
+	if stored.Author == "" {
+		stored.Author = book.Author
+	}
+	if stored.Language == "" {
+		stored.Language = book.Language
+	}
+	stored.UpdatedAt = time.Now()
+	s.books[book.ID] = stored
+
+	for segmentID, segment := range s.segments {
+		if segment.BookID == book.ID {
+			delete(s.segments, segmentID)
+			delete(s.revisions, segmentID)
+		}
+	}
+	for _, segment := range segments {
+		s.segments[segment.ID] = segment
+	}
+	return nil
+}
+
+// DeleteBook deletes a book and everything that belongs to it
+func (s *Store) DeleteBook(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for segmentID, segment := range s.segments {
+		if segment.BookID == id {
+			delete(s.segments, segmentID)
+			delete(s.revisions, segmentID)
+		}
+	}
+	for key := range s.progress {
+		if key.bookID == id {
+			delete(s.progress, key)
+		}
+	}
+	for bookmarkID, bookmark := range s.bookmarks {
+		if bookmark.BookID == id {
+			delete(s.bookmarks, bookmarkID)
+		}
+	}
+	delete(s.bookCategories, id)
+	delete(s.bookTags, id)
+	delete(s.thumbnails, id)
+	delete(s.books, id)
+	return nil
+}
+
+// FindBookByContentHash returns the user's oldest book with the content
+// hash, or nil if there is none
+func (s *Store) FindBookByContentHash(userID, hash string) (*models.Book, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var found *models.Book
+	for _, book := range s.books {
+		if book.UserID != userID || book.ContentHash != hash {
+			continue
+		}
+		if found == nil || book.CreatedAt.Before(found.CreatedAt) ||
+			(book.CreatedAt.Equal(found.CreatedAt) && book.ID < found.ID) {
+			found = s.hydrate(book)
+		}
+	}
+	return found, nil
+}
+
+// SetBookCover records a book's cover and replaces its thumbnails, and
+// returns the references of the cover and thumbnails it replaced
+func (s *Store) SetBookCover(book *models.Book, thumbnails []models.CoverThumbnail) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var replaced []string
+	if stored, ok := s.books[book.ID]; ok {
+		replaced = append(replaced, stored.CoverKey, stored.CoverURL)
+	} else {
+		replaced = append(replaced, "", "")
+	}
+	for _, thumb := range s.thumbnails[book.ID] {
+		replaced = append(replaced, thumb.Key)
+	}
+
+	if stored, ok := s.books[book.ID]; ok {
+		stored.CoverURL = book.CoverURL
+		stored.CoverKey = book.CoverKey
+		stored.CoverSize = book.CoverSize
+		stored.UpdatedAt = book.UpdatedAt
+		s.books[book.ID] = stored
+	}
+
+	saved := make([]models.CoverThumbnail, len(thumbnails))
+	for i, thumb := range thumbnails {
+		saved[i] = models.CoverThumbnail{BookID: book.ID, Width: thumb.Width, Height: thumb.Height, Key: thumb.Key, Size: thumb.Size}
+	}
+	sort.Slice(saved, func(i, j int) bool { return saved[i].Width < saved[j].Width })
+	s.thumbnails[book.ID] = saved
+	return replaced, nil
+}
+
+// GetCoverThumbnails retrieves the thumbnails of a book's cover, smallest first
+func (s *Store) GetCoverThumbnails(bookID string) ([]models.CoverThumbnail, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.thumbnails[bookID]) == 0 {
+		return nil, nil
+	}
+	return append([]models.CoverThumbnail(nil), s.thumbnails[bookID]...), nil
+}
+
+// bookCursor is the position after which the next page starts
+type bookCursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	ID   string `json:"id"`
+}
+
+// ListBooks returns the books matching filter in its sort order, and the
+// cursor of the next page, which is empty on the last page
+func (s *Store) ListBooks(filter models.BookFilter) ([]models.Book, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sortKey, err := s.sortKey(filter.Sort, filter.UserID)
+	if err != nil {
+		return nil, "", err
+	}
+	switch filter.ReadingState {
+	case "", models.ReadingStateUnread, models.ReadingStateReading, models.ReadingStateFinished:
+	default:
+		return nil, "", fmt.Errorf("unknown reading state %q", filter.ReadingState)
+	}
+
+	var after *bookCursor
+	if filter.Cursor != "" {
+		after = &bookCursor{}
+		data, err := base64.RawURLEncoding.DecodeString(filter.Cursor)
+		if err != nil || json.Unmarshal(data, after) != nil || after.Sort != filter.Sort {
+			return nil, "", repository.ErrInvalidCursor
+		}
+	}
+
+	type entry struct {
+		book models.Book
+		key  string
+	}
+	var matches []entry
+	for _, book := range s.books {
+		if !s.matches(book, filter) {
+			continue
+		}
+		matches = append(matches, entry{book, sortKey(book)})
+	}
+
+	less := func(a, b entry) bool {
+		if a.key != b.key {
+			return a.key < b.key
+		}
+		return a.book.ID < b.book.ID
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if filter.Descending {
+			return less(matches[j], matches[i])
+		}
+		return less(matches[i], matches[j])
+	})
+
+	books := []models.Book{}
+	var keys []string
+	for _, m := range matches {
+		if after != nil {
+			position := entry{models.Book{ID: after.ID}, after.Key}
+			if filter.Descending && !less(m, position) || !filter.Descending && !less(position, m) {
+				continue
+			}
+		}
+		books = append(books, *s.hydrate(m.book))
+		keys = append(keys, m.key)
+		if filter.Limit > 0 && len(books) > filter.Limit {
+			break
+		}
+	}
+
+	next := ""
+	if filter.Limit > 0 && len(books) > filter.Limit {
+		books = books[:filter.Limit]
+		last := filter.Limit - 1
+		data, _ := json.Marshal(bookCursor{Sort: filter.Sort, Key: keys[last], ID: books[last].ID})
+		next = base64.RawURLEncoding.EncodeToString(data)
+	}
+	return books, next, nil
+}
+
+// sortKey returns the function giving the value a sort order compares
+func (s *Store) sortKey(order, userID string) (func(models.Book) string, error) {
+	switch order {
+	case models.BookSortTitle:
+		return func(b models.Book) string { return strings.ToLower(b.Title) }, nil
+	case models.BookSortAuthor:
+		return func(b models.Book) string { return strings.ToLower(b.Author) }, nil
+	case models.BookSortAdded:
+		return func(b models.Book) string { return b.CreatedAt.UTC().Format("2006-01-02T15:04:05.000000000") }, nil
+	case models.BookSortLastRead:
+		return func(b models.Book) string { return s.progress[progressKey{b.ID, userID}].LastReadAt }, nil
+	}
+	return nil, fmt.Errorf("unknown sort order %q", order)
+}
+
+// matches reports whether a book passes every condition of filter
+func (s *Store) matches(book models.Book, filter models.BookFilter) bool {
+	if len(filter.Statuses) > 0 && !contains(filter.Statuses, book.Status) {
+		return false
+	}
+	if len(filter.Languages) > 0 && !contains(filter.Languages, book.Language) {
+		return false
+	}
+	if filter.Author != "" && !strings.Contains(strings.ToLower(book.Author), strings.ToLower(filter.Author)) {
+		return false
+	}
+	for _, category := range filter.Categories {
+		if !s.hasLink(s.bookCategories[book.ID], category, func(id string) string { return s.categories[id].Name }) {
+			return false
+		}
+	}
+	for _, tag := range filter.Tags {
+		if !s.hasLink(s.bookTags[book.ID], tag, func(id string) string { return s.tags[id].Name }) {
+			return false
+		}
+	}
+
+	progress, ok := s.progress[progressKey{book.ID, filter.UserID}]
+	started := ok && (progress.CurrentPage > 0 || progress.CompletionPercent > 0)
+	finished := ok && (progress.CompletionPercent >= 100 || (progress.TotalPages > 0 && progress.CurrentPage >= progress.TotalPages))
+	switch filter.ReadingState {
+	case models.ReadingStateUnread:
+		return !started
+	case models.ReadingStateReading:
+		return started && !finished
+	case models.ReadingStateFinished:
+		return finished
+	}
+	return true
+}
+
+// hasLink reports whether a set of category or tag IDs holds ref as an ID
+// or as a name, ignoring case
+func (s *Store) hasLink(ids map[string]bool, ref string, name func(id string) string) bool {
+	for id := range ids {
+		if id == ref || strings.EqualFold(name(id), ref) {
+			return true
+		}
+	}
+	return false
+}
+
+// hydrate returns a copy of a stored book with its category and tag names
+// and cover thumbnails
+func (s *Store) hydrate(book models.Book) *models.Book {
+	book.Categories = []string{}
+	for id := range s.bookCategories[book.ID] {
+		book.Categories = append(book.Categories, s.categories[id].Name)
+	}
+	sort.Strings(book.Categories)
+
+	book.Tags = []string{}
+	for id := range s.bookTags[book.ID] {
+		book.Tags = append(book.Tags, s.tags[id].Name)
+	}
+	sort.Strings(book.Tags)
+
+	book.Thumbnails = append([]models.CoverThumbnail{}, s.thumbnails[book.ID]...)
+	return &book
+}
+
+// storedBook copies the fields of a book that are persisted
+func storedBook(book *models.Book) models.Book {
+	stored := *book
+	stored.DocumentURL = ""
+	stored.Categories = nil
+	stored.Tags = nil
+	stored.Thumbnails = nil
+	return stored
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"backend/domain/models"
+	"backend/repository"
+)
+
+// GetCategories retrieves all categories by name with their book counts
+func (s *Store) GetCategories() ([]models.Category, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	categories := []models.Category{}
+	for _, category := range s.categories {
+		category.BookCount = countLinks(s.bookCategories, category.ID)
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		return strings.ToLower(categories[i].Name) < strings.ToLower(categories[j].Name)
+	})
+	return categories, nil
+}
+
+// GetCategoryByID retrieves a category by its ID
+func (s *Store) GetCategoryByID(id string) (*models.Category, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	category, ok := s.categories[id]
+	if !ok {
+		return nil, fmt.Errorf("error getting category: %w", errNotFound)
+	}
+	category.BookCount = countLinks(s.bookCategories, id)
+	return &category, nil
+}
+
+// CreateCategory creates a new category
+func (s *Store) CreateCategory(category *models.Category) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.categoryNamed(category.Name, "") {
+		return repository.ErrNameTaken
+	}
+	if _, ok := s.categories[category.ID]; ok {
+		return fmt.Errorf("error creating category: category %s already exists", category.ID)
+	}
+	stored := *category
+	stored.BookCount = 0
+	s.categories[category.ID] = stored
+	return nil
+}
+
+// UpdateCategory renames a category and replaces its description
+func (s *Store) UpdateCategory(category *models.Category) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.categories[category.ID]
+	if !ok {
+		return fmt.Errorf("category not found: %w", errNotFound)
+	}
+	if s.categoryNamed(category.Name, category.ID) {
+		return repository.ErrNameTaken
+	}
+	stored.Name = category.Name
+	stored.Description = category.Description
+	s.categories[category.ID] = stored
+	return nil
+}
+
+// DeleteCategory deletes a category and removes every book from it
+func (s *Store) DeleteCategory(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.categories[id]; !ok {
+		return fmt.Errorf("category not found: %w", errNotFound)
+	}
+	for bookID := range s.bookCategories {
+		unlink(s.bookCategories, bookID, id)
+	}
+	delete(s.categories, id)
+	return nil
+}
+
+// AddBookToCategory puts a book in a category. Adding it again is a no-op.
+func (s *Store) AddBookToCategory(bookID, categoryID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.books[bookID]; !ok {
+		return fmt.Errorf("error adding book to category: book %s: %w", bookID, errNotFound)
+	}
+	if _, ok := s.categories[categoryID]; !ok {
+		return fmt.Errorf("error adding book to category: category %s: %w", categoryID, errNotFound)
+	}
+	link(s.bookCategories, bookID, categoryID)
+	return nil
+}
+
+// RemoveBookFromCategory takes a book out of a category
+func (s *Store) RemoveBookFromCategory(bookID, categoryID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlink(s.bookCategories, bookID, categoryID)
+	return nil
+}
+
+// GetTags retrieves all tags by name with their book counts
+func (s *Store) GetTags() ([]models.Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tags := []models.Tag{}
+	for _, tag := range s.tags {
+		tag.BookCount = countLinks(s.bookTags, tag.ID)
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return strings.ToLower(tags[i].Name) < strings.ToLower(tags[j].Name)
+	})
+	return tags, nil
+}
+
+// GetTagByID retrieves a tag by its ID
+func (s *Store) GetTagByID(id string) (*models.Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tag, ok := s.tags[id]
+	if !ok {
+		return nil, fmt.Errorf("error getting tag: %w", errNotFound)
+	}
+	tag.BookCount = countLinks(s.bookTags, id)
+	return &tag, nil
+}
+
+// CreateTag creates a new tag
+func (s *Store) CreateTag(tag *models.Tag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tagNamed(tag.Name, "") {
+		return repository.ErrNameTaken
+	}
+	if _, ok := s.tags[tag.ID]; ok {
+		return fmt.Errorf("error creating tag: tag %s already exists", tag.ID)
+	}
+	stored := *tag
+	stored.BookCount = 0
+	s.tags[tag.ID] = stored
+	return nil
+}
+
+// RenameTag changes a tag's name
+func (s *Store) RenameTag(id, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.tags[id]
+	if !ok {
+		return fmt.Errorf("tag not found: %w", errNotFound)
+	}
+	if s.tagNamed(name, id) {
+		return repository.ErrNameTaken
+	}
+	stored.Name = name
+	s.tags[id] = stored
+	return nil
+}
+
+// DeleteTag deletes a tag and removes it from every book
+func (s *Store) DeleteTag(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tags[id]; !ok {
+		return fmt.Errorf("tag not found: %w", errNotFound)
+	}
+	for bookID := range s.bookTags {
+		unlink(s.bookTags, bookID, id)
+	}
+	delete(s.tags, id)
+	return nil
+}
+
+// TagBooks adds a tag to each of the books that exist and do not have it
+// yet, and returns how many books were tagged
+func (s *Store) TagBooks(tagID string, bookIDs []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tagged := 0
+	for _, bookID := range bookIDs {
+		if _, ok := s.books[bookID]; ok && link(s.bookTags, bookID, tagID) {
+			tagged++
+		}
+	}
+	return tagged, nil
+}
+
+// UntagBooks removes a tag from the books and returns how many had it
+func (s *Store) UntagBooks(tagID string, bookIDs []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	untagged := 0
+	for _, bookID := range bookIDs {
+		if unlink(s.bookTags, bookID, tagID) {
+			untagged++
+		}
+	}
+	return untagged, nil
+}
+
+// MergeTags moves every book tagged with one of sourceIDs to targetID and
+// deletes the source tags
+func (s *Store) MergeTags(targetID string, sourceIDs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sourceID := range sourceIDs {
+		if sourceID == targetID {
+			continue
+		}
+		for bookID := range s.bookTags {
+			if unlink(s.bookTags, bookID, sourceID) {
+				link(s.bookTags, bookID, targetID)
+			}
+		}
+		delete(s.tags, sourceID)
+	}
+	return nil
+}
+
+// categoryNamed reports whether a category other than exceptID has the name
+func (s *Store) categoryNamed(name, exceptID string) bool {
+	for id, category := range s.categories {
+		if id != exceptID && category.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// tagNamed reports whether a tag other than exceptID has the name
+func (s *Store) tagNamed(name, exceptID string) bool {
+	for id, tag := range s.tags {
+		if id != exceptID && tag.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"backend/domain/models"
+)
+
+// UpdateReadingProgress records a user's reading progress for a book,
+// replacing the previous record
+func (s *Store) UpdateReadingProgress(progress *models.ReadingProgress) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.books[progress.BookID]; !ok {
+		return fmt.Errorf("error updating reading progress: book %s: %w", progress.BookID, errNotFound)
+	}
+	for key, stored := range s.progress {
+		if stored.ID == progress.ID {
+			delete(s.progress, key)
+		}
+	}
+	s.progress[progressKey{progress.BookID, progress.UserID}] = *progress
+	return nil
+}
+
+// GetReadingProgress retrieves a user's reading progress for a book
+func (s *Store) GetReadingProgress(bookID, userID string) (*models.ReadingProgress, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	progress, ok := s.progress[progressKey{bookID, userID}]
+	if !ok {
+		return nil, fmt.Errorf("error getting reading progress: %w", errNotFound)
+	}
+	return &progress, nil
+}
+
+// DeleteReadingProgress deletes a user's reading progress for a book
+func (s *Store) DeleteReadingProgress(bookID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.progress, progressKey{bookID, userID})
+	return nil
+}
+
+// CreateBookmark creates a new bookmark
+func (s *Store) CreateBookmark(bookmark *models.Bookmark) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.bookmarks[bookmark.ID]; ok {
+		return fmt.Errorf("error creating bookmark: bookmark %s already exists", bookmark.ID)
+	}
+	if _, ok := s.books[bookmark.BookID]; !ok {
+		return fmt.Errorf("error creating bookmark: book %s: %w", bookmark.BookID, errNotFound)
+	}
+	s.bookmarks[bookmark.ID] = *bookmark
+	return nil
+}
+
+// UpdateBookmark changes the page and note of a bookmark owned by bookmark.UserID
+func (s *Store) UpdateBookmark(bookmark *models.Bookmark) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bookmark.UpdatedAt = time.Now()
+	stored, ok := s.bookmarks[bookmark.ID]
+	if !ok || stored.UserID != bookmark.UserID {
+		return nil
+	}
+	stored.PageNumber = bookmark.PageNumber
+	stored.Note = bookmark.Note
+	stored.UpdatedAt = bookmark.UpdatedAt
+	s.bookmarks[bookmark.ID] = stored
+	return nil
+}
+
+// GetBookmarks retrieves all bookmarks for a book and user
+func (s *Store) GetBookmarks(bookID, userID string) ([]models.Bookmark, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var bookmarks []models.Bookmark
+	for _, bookmark := range s.bookmarks {
+		if bookmark.BookID == bookID && bookmark.UserID == userID {
+			bookmarks = append(bookmarks, bookmark)
+		}
+	}
+	sort.Slice(bookmarks, func(i, j int) bool { return bookmarks[i].PageNumber < bookmarks[j].PageNumber })
+	return bookmarks, nil
+}
+
+// GetBookmarkByID retrieves a bookmark by its ID
+func (s *Store) GetBookmarkByID(id string) (*models.Bookmark, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	bookmark, ok := s.bookmarks[id]
+	if !ok {
+		return nil, fmt.Errorf("error getting bookmark: %w", errNotFound)
+	}
+	return &bookmark, nil
+}
+
+// DeleteBookmark deletes a bookmark
+func (s *Store) DeleteBookmark(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.bookmarks, id)
+	return nil
+}
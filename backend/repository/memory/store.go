@@ -0,0 +1,92 @@
+package memory
+
+import (
+	"errors"
+	"sync"
+
+	"backend/domain/models"
+	"backend/repository"
+)
+
+// errNotFound is wrapped by the errors returned for missing records
+var errNotFound = errors.New("not found")
+
+// Store keeps every aggregate in memory. It behaves like the SQLite
+// repository and is meant for tests.
+type Store struct {
+	mu sync.RWMutex
+
+	books      map[string]models.Book
+	thumbnails map[string][]models.CoverThumbnail
+	segments   map[string]models.AudioSegment
+	revisions  map[string][]models.SegmentRevision
+	progress   map[progressKey]models.ReadingProgress
+	bookmarks  map[string]models.Bookmark
+	categories map[string]models.Category
+	tags       map[string]models.Tag
+	users      map[string]models.User // Password holds the bcrypt hash
+
+	bookCategories map[string]map[string]bool // book ID to category IDs
+	bookTags       map[string]map[string]bool // book ID to tag IDs
+}
+
+type progressKey struct {
+	bookID string
+	userID string
+}
+
+var _ repository.Store = (*Store)(nil)
+
+// New creates an empty store
+func New() *Store {
+	return &Store{
+		books:          make(map[string]models.Book),
+		thumbnails:     make(map[string][]models.CoverThumbnail),
+		segments:       make(map[string]models.AudioSegment),
+		revisions:      make(map[string][]models.SegmentRevision),
+		progress:       make(map[progressKey]models.ReadingProgress),
+		bookmarks:      make(map[string]models.Bookmark),
+		categories:     make(map[string]models.Category),
+		tags:           make(map[string]models.Tag),
+		users:          make(map[string]models.User),
+		bookCategories: make(map[string]map[string]bool),
+		bookTags:       make(map[string]map[string]bool),
+	}
+}
+
+// link adds id to the set stored under key
+func link(sets map[string]map[string]bool, key, id string) bool {
+	set, ok := sets[key]
+	if !ok {
+		set = make(map[string]bool)
+		sets[key] = set
+	}
+	if set[id] {
+		return false
+	}
+	set[id] = true
+	return true
+}
+
+// unlink removes id from the set stored under key
+func unlink(sets map[string]map[string]bool, key, id string) bool {
+	if !sets[key][id] {
+		return false
+	}
+	delete(sets[key], id)
+	if len(sets[key]) == 0 {
+		delete(sets, key)
+	}
+	return true
+}
+
+// countLinks returns how many sets contain id
+func countLinks(sets map[string]map[string]bool, id string) int {
+	n := 0
+	for _, set := range sets {
+		if set[id] {
+			n++
+		}
+	}
+	return n
+}
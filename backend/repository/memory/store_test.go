@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"testing"
+
+	"backend/repository"
+	"backend/repository/memory"
+	"backend/repository/repotest"
+)
+
+func TestStore(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.Store {
+		return memory.New()
+	})
+}
@@ -0,0 +1,147 @@
+package memory
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"backend/domain/models"
+)
+
+// CreateUser creates a new user, storing a hash of its password
+func (s *Store) CreateUser(user *models.User) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user.ID]; ok {
+		return fmt.Errorf("error creating user: user %s already exists", user.ID)
+	}
+	if s.userTaken(user, "") {
+		return fmt.Errorf("error creating user: username or email already in use")
+	}
+	stored := *user
+	stored.Password = string(hashedPassword)
+	s.users[user.ID] = stored
+	return nil
+}
+
+// UpdateUser updates a user's username and email
+func (s *Store) UpdateUser(user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user.UpdatedAt = time.Now()
+	stored, ok := s.users[user.ID]
+	if !ok {
+		return nil
+	}
+	if s.userTaken(user, user.ID) {
+		return fmt.Errorf("error updating user: username or email already in use")
+	}
+	stored.Username = user.Username
+	stored.Email = user.Email
+	stored.UpdatedAt = user.UpdatedAt
+	s.users[user.ID] = stored
+	return nil
+}
+
+// UpdatePassword updates a user's password
+func (s *Store) UpdatePassword(userID, newPassword string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.users[userID]; ok {
+		stored.Password = string(hashedPassword)
+		stored.UpdatedAt = time.Now()
+		s.users[userID] = stored
+	}
+	return nil
+}
+
+// GetUserByID retrieves a user by their ID
+func (s *Store) GetUserByID(id string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, fmt.Errorf("error getting user: %w", errNotFound)
+	}
+	return &user, nil
+}
+
+// GetUserByEmail retrieves a user by their email address
+func (s *Store) GetUserByEmail(email string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, fmt.Errorf("error getting user by email: %w", errNotFound)
+}
+
+// GetUserByUsername retrieves a user by their username
+func (s *Store) GetUserByUsername(username string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, fmt.Errorf("error getting user by username: %w", errNotFound)
+}
+
+// DeleteUser deletes a user
+func (s *Store) DeleteUser(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.users, id)
+	return nil
+}
+
+// ValidatePassword checks if the provided password matches the stored hash
+func (s *Store) ValidatePassword(userID, password string) (bool, error) {
+	s.mu.RLock()
+	user, ok := s.users[userID]
+	s.mu.RUnlock()
+	if !ok {
+		return false, fmt.Errorf("error getting password hash: %w", errNotFound)
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	if err != nil {
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return false, fmt.Errorf("error comparing passwords: %v", err)
+	}
+	return true, nil
+}
+
+// userTaken reports whether a user other than exceptID has the username or
+// email of user
+func (s *Store) userTaken(user *models.User, exceptID string) bool {
+	for id, other := range s.users {
+		if id != exceptID && (other.Username == user.Username || other.Email == user.Email) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"backend/domain/models"
+)
+
+// ErrInvalidCursor is returned for a library cursor that was not produced by
+// ListBooks with the same sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrNameTaken is returned when a category or tag is given a name another one already has
+var ErrNameTaken = errors.New("name is already taken")
+
+// Books stores books and their covers. Books are returned with their
+// categories, tags and cover thumbnails. Getting a book that does not exist
+// returns an error.
+type Books interface {
+	SaveBook(book *models.Book) error
+	GetBookByID(id string) (*models.Book, error)
+	UpdateBook(book *models.Book) error
+	// SetBookMetadata changes only a book's title, author, language,
+	// description, series and ISBN
+	SetBookMetadata(book *models.Book) error
+	// SetBookStatus changes only a book's status
+	SetBookStatus(bookID, status string) error
+	// SetBookFile changes only the storage key, size and content hash of a
+	// book's source file
+	SetBookFile(bookID, key string, size int64, hash string) error
+	// SetBookURL changes a book's source URL and clears the storage key,
+	// size and content hash of the file downloaded from the old one
+	SetBookURL(bookID, url string) error
+	// IngestBook records a processed book's page count and text fingerprint,
+	// and its author and language where they are empty, and replaces its
+	// segments with segments atomically: on error neither is changed
+	IngestBook(book *models.Book, segments []models.AudioSegment) error
+	// DeleteBook deletes a book with its segments, progress, bookmarks,
+	// category and tag assignments and cover thumbnails
+	DeleteBook(id string) error
+	// ListBooks returns the books matching filter in its sort order, and the
+	// cursor of the next page, which is empty on the last page
+	ListBooks(filter models.BookFilter) ([]models.Book, string, error)
+	// FindBookByContentHash returns the user's oldest book with the given
+	// content hash, or nil if there is none
+	FindBookByContentHash(userID, hash string) (*models.Book, error)
+	// SetBookCover changes only a book's cover and replaces its thumbnails,
+	// returning the references of the cover and thumbnails it replaced
+	SetBookCover(book *models.Book, thumbnails []models.CoverThumbnail) ([]string, error)
+	GetCoverThumbnails(bookID string) ([]models.CoverThumbnail, error)
+}
+
+// Segments stores a book's audio segments and their text revisions
+type Segments interface {
+	SaveAudioSegment(segment *models.AudioSegment) error
+	UpdateAudioSegment(segment *models.AudioSegment) error
+	// GetAudioSegments returns a book's segments in playback order
+	GetAudioSegments(bookID string) ([]models.AudioSegment, error)
+	GetAudioSegmentByID(id string) (*models.AudioSegment, error)
+	GetAudioSegmentByNumber(bookID string, segmentNumber int) (*models.AudioSegment, error)
+	DeleteAudioSegment(id string) error
+	// ReviseAudioSegment saves a segment's new text and appends it to the
+	// revision history, recording previousContent as the original revision
+	// the first time
+	ReviseAudioSegment(segment *models.AudioSegment, previousContent, source string) (*models.SegmentRevision, error)
+	GetSegmentRevisions(segmentID string) ([]models.SegmentRevision, error)
+}
+
+// Progress stores each user's reading progress, one record per book
+type Progress interface {
+	UpdateReadingProgress(progress *models.ReadingProgress) error
+	GetReadingProgress(bookID, userID string) (*models.ReadingProgress, error)
+	DeleteReadingProgress(bookID, userID string) error
+}
+
+// Bookmarks stores users' bookmarks
+type Bookmarks interface {
+	CreateBookmark(bookmark *models.Bookmark) error
+	// UpdateBookmark changes the page and note of a bookmark owned by bookmark.UserID
+	UpdateBookmark(bookmark *models.Bookmark) error
+	// GetBookmarks returns a user's bookmarks in a book by page
+	GetBookmarks(bookID, userID string) ([]models.Bookmark, error)
+	GetBookmarkByID(id string) (*models.Bookmark, error)
+	DeleteBookmark(id string) error
+}
+
+// Taxonomy stores categories and tags and their assignment to books.
+// Creating or renaming one to a name in use returns ErrNameTaken.
+type Taxonomy interface {
+	GetCategories() ([]models.Category, error)
+	GetCategoryByID(id string) (*models.Category, error)
+	CreateCategory(category *models.Category) error
+	UpdateCategory(category *models.Category) error
+	DeleteCategory(id string) error
+	AddBookToCategory(bookID, categoryID string) error
+	RemoveBookFromCategory(bookID, categoryID string) error
+
+	GetTags() ([]models.Tag, error)
+	GetTagByID(id string) (*models.Tag, error)
+	CreateTag(tag *models.Tag) error
+	RenameTag(id, name string) error
+	DeleteTag(id string) error
+	// TagBooks tags the existing books that do not have the tag yet and
+	// returns how many were tagged
+	TagBooks(tagID string, bookIDs []string) (int, error)
+	// UntagBooks returns how many of the books had the tag
+	UntagBooks(tagID string, bookIDs []string) (int, error)
+	// MergeTags moves the books of sourceIDs to targetID and deletes the sources
+	MergeTags(targetID string, sourceIDs []string) error
+}
+
+// Users stores accounts. Passwords are given in plain text and stored hashed.
+type Users interface {
+	CreateUser(user *models.User) error
+	UpdateUser(user *models.User) error
+	UpdatePassword(userID, newPassword string) error
+	GetUserByID(id string) (*models.User, error)
+	GetUserByEmail(email string) (*models.User, error)
+	GetUserByUsername(username string) (*models.User, error)
+	DeleteUser(id string) error
+	ValidatePassword(userID, password string) (bool, error)
+}
+
+// Store combines the repositories of every aggregate
+type Store interface {
+	Books
+	Segments
+	Progress
+	Bookmarks
+	Taxonomy
+	Users
+}
+
+// The interfaces below are implemented by the SQLite database only. They are
+// kept out of Store, so the in-memory store and the contract suite do not
+// cover them, and each caller depends on just the part it uses.
+
+// Stages records the processing timeline of books
+type Stages interface {
+	// StartBookStage ends the stage a book is in and starts a new one
+	StartBookStage(bookID, stage string) (*models.BookStage, error)
+	// EndBookStage ends the stage a book is in, recording the error that stopped it
+	EndBookStage(bookID, stageErr string) error
+	// GetBookStages returns a book's stages, oldest first
+	GetBookStages(bookID string) ([]models.BookStage, error)
+}
+
+// Searcher finds books and segments by their text
+type Searcher interface {
+	// Search returns the books and segments matching every term of query,
+	// limited to one book if bookID is set
+	Search(query, bookID string, limit, offset int) (*models.SearchResults, error)
+}
+
+// Duplicates finds books that may be copies of one another
+type Duplicates interface {
+	// GetUnhashedBooks returns the books with a stored file but no content hash
+	GetUnhashedBooks() ([]models.Book, error)
+	SetBookContentHash(bookID, hash string) error
+	DuplicateReport() (*models.DuplicateReport, error)
+}
+
+// Usage stores what users consume and their quota overrides
+type Usage interface {
+	SaveSynthesisUsage(usage *models.SynthesisUsage) error
+	// GetSynthesisUsage returns the characters a user has sent for synthesis since the given time
+	GetSynthesisUsage(userID string, since time.Time) (int64, error)
+	// GetStorageUsage returns the bytes stored for a user's books and how many they own
+	GetStorageUsage(userID string) (bytes int64, books int64, err error)
+	// GetUserQuota returns a user's quota overrides, or nil if they have none
+	GetUserQuota(userID string) (*models.UserQuota, error)
+	SaveUserQuota(quota *models.UserQuota) error
+}
+
+// Events keeps the most recent events of each book
+type Events interface {
+	// SaveBookEvent assigns an event its ID and keeps at most keep events of its book
+	SaveBookEvent(event *models.BookEvent, keep int) error
+	// GetBookEventsSince returns a book's events after the given ID, oldest first
+	GetBookEventsSince(bookID string, afterID int64) ([]models.BookEvent, error)
+}
+
+// FileReferences lists the stored files rows refer to
+type FileReferences interface {
+	GetFileReferences() ([]string, error)
+	GetBookFileReferences(bookID string) ([]string, error)
+}
+
+// Snapshots copies the database to a file while it is in use
+type Snapshots interface {
+	Backup(ctx context.Context, destPath string) error
+}
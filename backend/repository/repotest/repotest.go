@@ -0,0 +1,785 @@
+// Package repotest is a contract test suite that every repository.Store
+// implementation must pass
+package repotest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"backend/domain/models"
+	"backend/repository"
+)
+
+// Run runs the contract suite. open must return a new, empty store for each
+// call.
+func Run(t *testing.T, open func(t *testing.T) repository.Store) {
+	t.Run("Books", func(t *testing.T) { testBooks(t, open(t)) })
+	t.Run("ListBooks", func(t *testing.T) { testListBooks(t, open(t)) })
+	t.Run("Segments", func(t *testing.T) { testSegments(t, open(t)) })
+	t.Run("IngestBook", func(t *testing.T) { testIngestBook(t, open(t)) })
+	t.Run("Progress", func(t *testing.T) { testProgress(t, open(t)) })
+	t.Run("Bookmarks", func(t *testing.T) { testBookmarks(t, open(t)) })
+	t.Run("Taxonomy", func(t *testing.T) { testTaxonomy(t, open(t)) })
+	t.Run("Users", func(t *testing.T) { testUsers(t, open(t)) })
+	t.Run("DeleteBook", func(t *testing.T) { testDeleteBook(t, open(t)) })
+	t.Run("MissingParents", func(t *testing.T) { testMissingParents(t, open(t)) })
+}
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newBook returns a ready book created n minutes after epoch
+func newBook(id, title, author string, n int) *models.Book {
+	created := epoch.Add(time.Duration(n) * time.Minute)
+	return &models.Book{
+		ID:        id,
+		Title:     title,
+		Author:    author,
+		UserID:    "user-1",
+		Language:  "en",
+		Status:    models.BookStatusReady,
+		CreatedAt: created,
+		UpdatedAt: created,
+	}
+}
+
+func mustSaveBook(t *testing.T, store repository.Store, book *models.Book) {
+	t.Helper()
+	if err := store.SaveBook(book); err != nil {
+		t.Fatalf("SaveBook(%s): %v", book.ID, err)
+	}
+}
+
+func ids[T any](items []T, id func(T) string) []string {
+	out := make([]string, len(items))
+	for i, item := range items {
+		out[i] = id(item)
+	}
+	return out
+}
+
+func bookIDs(books []models.Book) []string {
+	return ids(books, func(b models.Book) string { return b.ID })
+}
+
+func expectIDs(t *testing.T, what string, got, want []string) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("%s = %v, want %v", what, got, want)
+	}
+}
+
+func testBooks(t *testing.T, store repository.Store) {
+	book := newBook("b1", "Dune", "Frank Herbert", 0)
+	book.ContentHash = "hash-1"
+	mustSaveBook(t, store, book)
+
+	if err := store.SaveBook(newBook("b1", "Again", "", 1)); err == nil {
+		t.Error("SaveBook with a duplicate ID succeeded")
+	}
+	if _, err := store.GetBookByID("missing"); err == nil {
+		t.Error("GetBookByID of a missing book succeeded")
+	}
+
+	got, err := store.GetBookByID("b1")
+	if err != nil {
+		t.Fatalf("GetBookByID: %v", err)
+	}
+	if got.Title != "Dune" || got.Author != "Frank Herbert" || got.UserID != "user-1" || got.ContentHash != "hash-1" {
+		t.Errorf("GetBookByID = %+v", got)
+	}
+
+	got.Title = "Dune Messiah"
+	got.Description = "The second book"
+	got.Status = models.BookStatusProcessing
+	if err := store.UpdateBook(got); err != nil {
+		t.Fatalf("UpdateBook: %v", err)
+	}
+	got, _ = store.GetBookByID("b1")
+	if got.Title != "Dune Messiah" || got.Description != "The second book" || got.Status != models.BookStatusProcessing {
+		t.Errorf("after UpdateBook = %+v", got)
+	}
+	if !got.CreatedAt.Equal(book.CreatedAt) {
+		t.Errorf("UpdateBook changed CreatedAt to %v", got.CreatedAt)
+	}
+
+	// Scoped writes leave the other columns alone, even when given a stale book
+	stale := *got
+	edited := *got
+	edited.Title = "Children of Dune"
+	edited.ISBN = "9780441104024"
+	edited.Status = models.BookStatusError
+	if err := store.SetBookMetadata(&edited); err != nil {
+		t.Fatalf("SetBookMetadata: %v", err)
+	}
+	if err := store.SetBookStatus(stale.ID, models.BookStatusReady); err != nil {
+		t.Fatalf("SetBookStatus: %v", err)
+	}
+	if err := store.SetBookFile(stale.ID, "pdfs/b1.pdf", 42, "hash-2"); err != nil {
+		t.Fatalf("SetBookFile: %v", err)
+	}
+	got, _ = store.GetBookByID("b1")
+	if got.Title != "Children of Dune" || got.ISBN != "9780441104024" || got.Status != models.BookStatusReady {
+		t.Errorf("after SetBookMetadata and SetBookStatus = %+v", got)
+	}
+	if got.FileKey != "pdfs/b1.pdf" || got.FileSize != 42 || got.ContentHash != "hash-2" {
+		t.Errorf("after SetBookFile = %+v", got)
+	}
+	if err := store.SetBookURL(stale.ID, "https://example.com/b1-v2.pdf"); err != nil {
+		t.Fatalf("SetBookURL: %v", err)
+	}
+	got, _ = store.GetBookByID("b1")
+	if got.FileURL != "https://example.com/b1-v2.pdf" || got.FileKey != "" || got.FileSize != 0 || got.ContentHash != "" {
+		t.Errorf("after SetBookURL = %+v", got)
+	}
+	if got.Title != "Children of Dune" || got.Status != models.BookStatusReady {
+		t.Errorf("SetBookURL changed other columns: %+v", got)
+	}
+	got.FileKey, got.FileSize, got.ContentHash = "pdfs/b1.pdf", 42, "hash-1"
+	if err := store.SetBookFile(got.ID, got.FileKey, got.FileSize, got.ContentHash); err != nil {
+		t.Fatalf("SetBookFile: %v", err)
+	}
+
+	older := newBook("b0", "Copy", "", -1)
+	older.ContentHash = "hash-1"
+	mustSaveBook(t, store, older)
+	other := newBook("b2", "Copy", "", -2)
+	other.UserID = "user-2"
+	other.ContentHash = "hash-1"
+	mustSaveBook(t, store, other)
+
+	found, err := store.FindBookByContentHash("user-1", "hash-1")
+	if err != nil || found == nil || found.ID != "b0" {
+		t.Errorf("FindBookByContentHash = %v, %v, want b0", found, err)
+	}
+	found, err = store.FindBookByContentHash("user-1", "other")
+	if err != nil || found != nil {
+		t.Errorf("FindBookByContentHash of an unknown hash = %v, %v, want nil", found, err)
+	}
+
+	if thumbs, err := store.GetCoverThumbnails("b1"); err != nil || len(thumbs) != 0 {
+		t.Errorf("GetCoverThumbnails before a cover = %v, %v", thumbs, err)
+	}
+	stale = *got
+	got.CoverKey = "covers/b1.jpg"
+	got.CoverSize = 5000
+	_, err = store.SetBookCover(got, []models.CoverThumbnail{
+		{Width: 400, Height: 600, Key: "covers/b1-400.jpg", Size: 400},
+		{Width: 200, Height: 300, Key: "covers/b1-200.jpg", Size: 200},
+	})
+	if err != nil {
+		t.Fatalf("SetBookCover: %v", err)
+	}
+	thumbs, err := store.GetCoverThumbnails("b1")
+	if err != nil || len(thumbs) != 2 || thumbs[0].Width != 200 || thumbs[1].Width != 400 {
+		t.Errorf("GetCoverThumbnails = %+v, %v, want widths 200, 400", thumbs, err)
+	} else if thumbs[0].Size != 200 || thumbs[1].Size != 400 {
+		t.Errorf("GetCoverThumbnails sizes = %d, %d, want 200, 400", thumbs[0].Size, thumbs[1].Size)
+	}
+	if got, _ := store.GetBookByID("b1"); got.CoverKey != "covers/b1.jpg" || got.CoverSize != 5000 {
+		t.Errorf("CoverKey, CoverSize = %q, %d after SetBookCover", got.CoverKey, got.CoverSize)
+	} else if len(got.Thumbnails) != 2 || got.Thumbnails[0].Key != "covers/b1-200.jpg" || got.Thumbnails[1].Size != 400 {
+		t.Errorf("GetBookByID thumbnails = %+v, want widths 200, 400", got.Thumbnails)
+	}
+	if books, _, err := store.ListBooks(models.BookFilter{Sort: models.BookSortAdded}); err != nil {
+		t.Errorf("ListBooks: %v", err)
+	} else {
+		for _, book := range books {
+			if want := map[string]int{"b1": 2}[book.ID]; len(book.Thumbnails) != want {
+				t.Errorf("ListBooks thumbnails of %s = %+v, want %d", book.ID, book.Thumbnails, want)
+			}
+		}
+	}
+
+	// The replaced cover is the stored one, not the one on a stale book
+	stale.CoverKey = "covers/b1-new.jpg"
+	replaced, err := store.SetBookCover(&stale, nil)
+	if err != nil {
+		t.Fatalf("SetBookCover again: %v", err)
+	}
+	sort.Strings(replaced)
+	expectIDs(t, "replaced cover references", replaced, []string{"", "covers/b1-200.jpg", "covers/b1-400.jpg", "covers/b1.jpg"})
+}
+
+func testListBooks(t *testing.T, store repository.Store) {
+	mustSaveBook(t, store, newBook("b1", "Emma", "Jane Austen", 3))
+	mustSaveBook(t, store, newBook("b2", "beloved", "Toni Morrison", 1))
+	mustSaveBook(t, store, newBook("b3", "Persuasion", "Jane Austen", 2))
+	failed := newBook("b4", "Abandoned", "Nobody", 4)
+	failed.Status = models.BookStatusError
+	failed.Language = "fr"
+	mustSaveBook(t, store, failed)
+
+	list := func(filter models.BookFilter) []string {
+		t.Helper()
+		books, _, err := store.ListBooks(filter)
+		if err != nil {
+			t.Fatalf("ListBooks(%+v): %v", filter, err)
+		}
+		return bookIDs(books)
+	}
+
+	expectIDs(t, "by title", list(models.BookFilter{Sort: models.BookSortTitle}), []string{"b4", "b2", "b1", "b3"})
+	expectIDs(t, "by added, descending", list(models.BookFilter{Sort: models.BookSortAdded, Descending: true}), []string{"b4", "b1", "b3", "b2"})
+	expectIDs(t, "by author", list(models.BookFilter{Sort: models.BookSortAuthor, Author: "austen"}), []string{"b1", "b3"})
+	expectIDs(t, "ready", list(models.BookFilter{Sort: models.BookSortTitle, Statuses: []string{models.BookStatusReady}}), []string{"b2", "b1", "b3"})
+	expectIDs(t, "french", list(models.BookFilter{Sort: models.BookSortTitle, Languages: []string{"fr"}}), []string{"b4"})
+
+	if _, _, err := store.ListBooks(models.BookFilter{Sort: "pages"}); err == nil {
+		t.Error("ListBooks with an unknown sort succeeded")
+	}
+	if _, _, err := store.ListBooks(models.BookFilter{Sort: models.BookSortTitle, Cursor: "not a cursor"}); !errors.Is(err, repository.ErrInvalidCursor) {
+		t.Errorf("ListBooks with a bad cursor = %v, want ErrInvalidCursor", err)
+	}
+
+	var pages []string
+	filter := models.BookFilter{Sort: models.BookSortTitle, Limit: 3}
+	for {
+		books, next, err := store.ListBooks(filter)
+		if err != nil {
+			t.Fatalf("ListBooks page: %v", err)
+		}
+		pages = append(pages, bookIDs(books)...)
+		if next == "" {
+			break
+		}
+		if len(pages) > 4 {
+			t.Fatal("ListBooks pagination does not end")
+		}
+		filter.Cursor = next
+	}
+	expectIDs(t, "paginated by title", pages, []string{"b4", "b2", "b1", "b3"})
+
+	if _, _, err := store.ListBooks(models.BookFilter{Sort: models.BookSortAuthor, Cursor: filter.Cursor}); !errors.Is(err, repository.ErrInvalidCursor) {
+		t.Errorf("ListBooks with a cursor of another sort = %v, want ErrInvalidCursor", err)
+	}
+
+	tag := &models.Tag{ID: "t1", Name: "Classic", CreatedAt: epoch}
+	if err := store.CreateTag(tag); err != nil {
+		t.Fatalf("CreateTag: %v", err)
+	}
+	if _, err := store.TagBooks("t1", []string{"b1", "b3"}); err != nil {
+		t.Fatalf("TagBooks: %v", err)
+	}
+	expectIDs(t, "tagged by name", list(models.BookFilter{Sort: models.BookSortTitle, Tags: []string{"classic"}}), []string{"b1", "b3"})
+	expectIDs(t, "tagged by ID", list(models.BookFilter{Sort: models.BookSortTitle, Tags: []string{"t1"}}), []string{"b1", "b3"})
+
+	progress := []models.ReadingProgress{
+		{ID: "p1", BookID: "b1", UserID: "user-1", CurrentPage: 10, TotalPages: 100, LastReadAt: "2024-02-01T00:00:00Z"},
+		{ID: "p2", BookID: "b2", UserID: "user-1", CurrentPage: 100, TotalPages: 100, CompletionPercent: 100, LastReadAt: "2024-03-01T00:00:00Z"},
+		{ID: "p3", BookID: "b3", UserID: "user-2", CurrentPage: 5, TotalPages: 100, LastReadAt: "2024-04-01T00:00:00Z"},
+	}
+	for i := range progress {
+		if err := store.UpdateReadingProgress(&progress[i]); err != nil {
+			t.Fatalf("UpdateReadingProgress: %v", err)
+		}
+	}
+	state := func(readingState string) []string {
+		return list(models.BookFilter{Sort: models.BookSortTitle, UserID: "user-1", ReadingState: readingState})
+	}
+	expectIDs(t, "unread", state(models.ReadingStateUnread), []string{"b4", "b3"})
+	expectIDs(t, "reading", state(models.ReadingStateReading), []string{"b1"})
+	expectIDs(t, "finished", state(models.ReadingStateFinished), []string{"b2"})
+	lastRead := list(models.BookFilter{Sort: models.BookSortLastRead, Descending: true, UserID: "user-1"})
+	if len(lastRead) != 4 || lastRead[0] != "b2" || lastRead[1] != "b1" {
+		t.Errorf("by last read = %v, want b2, b1 first", lastRead)
+	}
+}
+
+func testSegments(t *testing.T, store repository.Store) {
+	mustSaveBook(t, store, newBook("b1", "Dune", "", 0))
+	for i, id := range []string{"s3", "s1", "s2"} {
+		number := map[string]int{"s1": 1, "s2": 2, "s3": 3}[id]
+		segment := &models.AudioSegment{
+			ID:            id,
+			BookID:        "b1",
+			SegmentNumber: number,
+			PageNumber:    1,
+			Content:       fmt.Sprintf("text %d", number),
+			Status:        "pending",
+			CreatedAt:     epoch.Add(time.Duration(i) * time.Second),
+			UpdatedAt:     epoch,
+		}
+		if err := store.SaveAudioSegment(segment); err != nil {
+			t.Fatalf("SaveAudioSegment(%s): %v", id, err)
+		}
+	}
+
+	segments, err := store.GetAudioSegments("b1")
+	if err != nil {
+		t.Fatalf("GetAudioSegments: %v", err)
+	}
+	expectIDs(t, "segments", ids(segments, func(s models.AudioSegment) string { return s.ID }), []string{"s1", "s2", "s3"})
+	if segments, err := store.GetAudioSegments("missing"); err != nil || len(segments) != 0 {
+		t.Errorf("GetAudioSegments of a missing book = %v, %v", segments, err)
+	}
+
+	second, err := store.GetAudioSegmentByNumber("b1", 2)
+	if err != nil || second.ID != "s2" {
+		t.Fatalf("GetAudioSegmentByNumber = %v, %v, want s2", second, err)
+	}
+	if _, err := store.GetAudioSegmentByNumber("b1", 9); err == nil {
+		t.Error("GetAudioSegmentByNumber of a missing segment succeeded")
+	}
+	if _, err := store.GetAudioSegmentByID("missing"); err == nil {
+		t.Error("GetAudioSegmentByID of a missing segment succeeded")
+	}
+
+	second.AudioKey = "audio/s2.mp3"
+	second.Duration = 2.5
+	second.Status = "completed"
+	if err := store.UpdateAudioSegment(second); err != nil {
+		t.Fatalf("UpdateAudioSegment: %v", err)
+	}
+	got, _ := store.GetAudioSegmentByID("s2")
+	if got.AudioKey != "audio/s2.mp3" || got.Duration != 2.5 || got.Status != "completed" {
+		t.Errorf("after UpdateAudioSegment = %+v", got)
+	}
+
+	if revisions, err := store.GetSegmentRevisions("s2"); err != nil || len(revisions) != 0 {
+		t.Errorf("GetSegmentRevisions before a revision = %v, %v", revisions, err)
+	}
+	for _, content := range []string{"first edit", "second edit"} {
+		previous := got.Content
+		got.Content = content
+		revision, err := store.ReviseAudioSegment(got, previous, models.RevisionSourceEdit)
+		if err != nil {
+			t.Fatalf("ReviseAudioSegment: %v", err)
+		}
+		if revision.Content != content || revision.Source != models.RevisionSourceEdit {
+			t.Errorf("ReviseAudioSegment = %+v", revision)
+		}
+	}
+	revisions, err := store.GetSegmentRevisions("s2")
+	if err != nil || len(revisions) != 3 {
+		t.Fatalf("GetSegmentRevisions = %v, %v, want 3 revisions", revisions, err)
+	}
+	for i, want := range []string{"text 2", "first edit", "second edit"} {
+		if revisions[i].Revision != i+1 || revisions[i].Content != want {
+			t.Errorf("revision %d = %+v, want %q", i+1, revisions[i], want)
+		}
+	}
+	if revisions[0].Source != models.RevisionSourceExtracted {
+		t.Errorf("original revision source = %q", revisions[0].Source)
+	}
+	if got, _ := store.GetAudioSegmentByID("s2"); got.Content != "second edit" {
+		t.Errorf("content after ReviseAudioSegment = %q", got.Content)
+	}
+
+	if err := store.DeleteAudioSegment("s2"); err != nil {
+		t.Fatalf("DeleteAudioSegment: %v", err)
+	}
+	if _, err := store.GetAudioSegmentByID("s2"); err == nil {
+		t.Error("GetAudioSegmentByID succeeded after DeleteAudioSegment")
+	}
+	if revisions, _ := store.GetSegmentRevisions("s2"); len(revisions) != 0 {
+		t.Errorf("%d revisions left after DeleteAudioSegment", len(revisions))
+	}
+}
+
+// pageSegments returns n pending segments of a book, one per page
+func pageSegments(bookID, prefix string, n int) []models.AudioSegment {
+	segments := make([]models.AudioSegment, n)
+	for i := range segments {
+		segments[i] = models.AudioSegment{
+			ID:            fmt.Sprintf("%s-%d", prefix, i+1),
+			BookID:        bookID,
+			SegmentNumber: i + 1,
+			PageNumber:    i + 1,
+			Content:       fmt.Sprintf("page %d", i+1),
+			Status:        "pending",
+			CreatedAt:     epoch,
+			UpdatedAt:     epoch,
+		}
+	}
+	return segments
+}
+
+func testIngestBook(t *testing.T, store repository.Store) {
+	book := newBook("b1", "Dune", "", 0)
+	book.Status = models.BookStatusProcessing
+	mustSaveBook(t, store, book)
+
+	// Metadata edited while the book is processed is kept
+	edited := *book
+	edited.Title = "Dune (edited)"
+	edited.Author = "Frank Herbert"
+	if err := store.SetBookMetadata(&edited); err != nil {
+		t.Fatalf("SetBookMetadata: %v", err)
+	}
+
+	book.PageCount = 123
+	book.TextFingerprint = "fingerprint"
+	book.Author = "Unknown"
+	if err := store.IngestBook(book, pageSegments("b1", "a", 123)); err != nil {
+		t.Fatalf("IngestBook: %v", err)
+	}
+	segments, err := store.GetAudioSegments("b1")
+	if err != nil || len(segments) != 123 {
+		t.Fatalf("GetAudioSegments after IngestBook = %d segments, %v, want 123", len(segments), err)
+	}
+	for i, segment := range segments {
+		if segment.SegmentNumber != i+1 || segment.Content != fmt.Sprintf("page %d", i+1) {
+			t.Fatalf("segment %d = %+v", i+1, segment)
+		}
+	}
+	if got, _ := store.GetBookByID("b1"); got.PageCount != 123 || got.TextFingerprint != "fingerprint" ||
+		got.Title != "Dune (edited)" || got.Author != "Frank Herbert" || got.Status != models.BookStatusProcessing {
+		t.Errorf("book after IngestBook = %+v", got)
+	}
+
+	// A failed ingestion changes nothing
+	book.PageCount = 2
+	failing := pageSegments("b1", "b", 2)
+	failing[1].ID = failing[0].ID
+	if err := store.IngestBook(book, failing); err == nil {
+		t.Fatal("IngestBook with duplicate segment IDs succeeded")
+	}
+	if segments, _ := store.GetAudioSegments("b1"); len(segments) != 123 || segments[0].ID != "a-1" {
+		t.Errorf("failed IngestBook left %d segments", len(segments))
+	}
+	if got, _ := store.GetBookByID("b1"); got.PageCount != 123 {
+		t.Errorf("failed IngestBook changed the page count to %d", got.PageCount)
+	}
+
+	// Ingesting again replaces the segments
+	if err := store.IngestBook(book, pageSegments("b1", "c", 2)); err != nil {
+		t.Fatalf("IngestBook again: %v", err)
+	}
+	segments, _ = store.GetAudioSegments("b1")
+	expectIDs(t, "segments after IngestBook again", ids(segments, func(s models.AudioSegment) string { return s.ID }), []string{"c-1", "c-2"})
+
+	if err := store.IngestBook(newBook("missing", "", "", 0), pageSegments("missing", "d", 1)); err == nil {
+		t.Error("IngestBook of a missing book succeeded")
+	}
+	if segments, _ := store.GetAudioSegments("missing"); len(segments) != 0 {
+		t.Errorf("IngestBook of a missing book saved %d segments", len(segments))
+	}
+}
+
+func testProgress(t *testing.T, store repository.Store) {
+	mustSaveBook(t, store, newBook("b1", "Dune", "", 0))
+	if _, err := store.GetReadingProgress("b1", "user-1"); err == nil {
+		t.Error("GetReadingProgress without progress succeeded")
+	}
+
+	progress := &models.ReadingProgress{ID: "p1", BookID: "b1", UserID: "user-1", CurrentPage: 3, TotalPages: 10, CompletionPercent: 30}
+	if err := store.UpdateReadingProgress(progress); err != nil {
+		t.Fatalf("UpdateReadingProgress: %v", err)
+	}
+	progress.CurrentPage = 5
+	progress.CompletionPercent = 50
+	if err := store.UpdateReadingProgress(progress); err != nil {
+		t.Fatalf("UpdateReadingProgress: %v", err)
+	}
+	other := &models.ReadingProgress{ID: "p2", BookID: "b1", UserID: "user-2", CurrentPage: 1, TotalPages: 10}
+	if err := store.UpdateReadingProgress(other); err != nil {
+		t.Fatalf("UpdateReadingProgress: %v", err)
+	}
+
+	got, err := store.GetReadingProgress("b1", "user-1")
+	if err != nil || got.CurrentPage != 5 || got.CompletionPercent != 50 {
+		t.Errorf("GetReadingProgress = %+v, %v, want page 5", got, err)
+	}
+
+	if err := store.DeleteReadingProgress("b1", "user-1"); err != nil {
+		t.Fatalf("DeleteReadingProgress: %v", err)
+	}
+	if _, err := store.GetReadingProgress("b1", "user-1"); err == nil {
+		t.Error("GetReadingProgress succeeded after DeleteReadingProgress")
+	}
+	if _, err := store.GetReadingProgress("b1", "user-2"); err != nil {
+		t.Errorf("DeleteReadingProgress removed another user's progress: %v", err)
+	}
+}
+
+func testBookmarks(t *testing.T, store repository.Store) {
+	mustSaveBook(t, store, newBook("b1", "Dune", "", 0))
+	for _, bookmark := range []models.Bookmark{
+		{ID: "m1", BookID: "b1", UserID: "user-1", PageNumber: 40, Note: "later", CreatedAt: epoch, UpdatedAt: epoch},
+		{ID: "m2", BookID: "b1", UserID: "user-1", PageNumber: 7, CreatedAt: epoch, UpdatedAt: epoch},
+		{ID: "m3", BookID: "b1", UserID: "user-2", PageNumber: 1, CreatedAt: epoch, UpdatedAt: epoch},
+	} {
+		if err := store.CreateBookmark(&bookmark); err != nil {
+			t.Fatalf("CreateBookmark(%s): %v", bookmark.ID, err)
+		}
+	}
+
+	bookmarks, err := store.GetBookmarks("b1", "user-1")
+	if err != nil {
+		t.Fatalf("GetBookmarks: %v", err)
+	}
+	expectIDs(t, "bookmarks", ids(bookmarks, func(b models.Bookmark) string { return b.ID }), []string{"m2", "m1"})
+
+	if err := store.UpdateBookmark(&models.Bookmark{ID: "m1", UserID: "user-1", PageNumber: 41, Note: "now"}); err != nil {
+		t.Fatalf("UpdateBookmark: %v", err)
+	}
+	if err := store.UpdateBookmark(&models.Bookmark{ID: "m1", UserID: "user-2", PageNumber: 99, Note: "stolen"}); err != nil {
+		t.Fatalf("UpdateBookmark by another user: %v", err)
+	}
+	got, err := store.GetBookmarkByID("m1")
+	if err != nil || got.PageNumber != 41 || got.Note != "now" || got.BookID != "b1" {
+		t.Errorf("GetBookmarkByID = %+v, %v, want page 41", got, err)
+	}
+
+	if err := store.DeleteBookmark("m1"); err != nil {
+		t.Fatalf("DeleteBookmark: %v", err)
+	}
+	if _, err := store.GetBookmarkByID("m1"); err == nil {
+		t.Error("GetBookmarkByID succeeded after DeleteBookmark")
+	}
+}
+
+func testTaxonomy(t *testing.T, store repository.Store) {
+	mustSaveBook(t, store, newBook("b1", "Dune", "", 0))
+	mustSaveBook(t, store, newBook("b2", "Emma", "", 1))
+
+	if categories, err := store.GetCategories(); err != nil || categories == nil || len(categories) != 0 {
+		t.Errorf("GetCategories of an empty store = %#v, %v, want an empty slice", categories, err)
+	}
+	for _, category := range []models.Category{
+		{ID: "c1", Name: "fiction", CreatedAt: epoch},
+		{ID: "c2", Name: "Biography", CreatedAt: epoch},
+	} {
+		if err := store.CreateCategory(&category); err != nil {
+			t.Fatalf("CreateCategory(%s): %v", category.ID, err)
+		}
+	}
+	if err := store.CreateCategory(&models.Category{ID: "c3", Name: "fiction", CreatedAt: epoch}); !errors.Is(err, repository.ErrNameTaken) {
+		t.Errorf("CreateCategory with a taken name = %v, want ErrNameTaken", err)
+	}
+	if err := store.UpdateCategory(&models.Category{ID: "c2", Name: "fiction"}); !errors.Is(err, repository.ErrNameTaken) {
+		t.Errorf("UpdateCategory to a taken name = %v, want ErrNameTaken", err)
+	}
+	if err := store.UpdateCategory(&models.Category{ID: "missing", Name: "Poetry"}); err == nil {
+		t.Error("UpdateCategory of a missing category succeeded")
+	}
+	if err := store.UpdateCategory(&models.Category{ID: "c2", Name: "Lives", Description: "True stories"}); err != nil {
+		t.Fatalf("UpdateCategory: %v", err)
+	}
+
+	for _, bookID := range []string{"b1", "b2", "b1"} {
+		if err := store.AddBookToCategory(bookID, "c1"); err != nil {
+			t.Fatalf("AddBookToCategory: %v", err)
+		}
+	}
+	categories, _ := store.GetCategories()
+	expectIDs(t, "categories", ids(categories, func(c models.Category) string { return c.ID }), []string{"c1", "c2"})
+	if categories[0].BookCount != 2 || categories[1].Description != "True stories" {
+		t.Errorf("GetCategories = %+v", categories)
+	}
+	if err := store.RemoveBookFromCategory("b2", "c1"); err != nil {
+		t.Fatalf("RemoveBookFromCategory: %v", err)
+	}
+	if category, err := store.GetCategoryByID("c1"); err != nil || category.BookCount != 1 {
+		t.Errorf("GetCategoryByID = %+v, %v, want 1 book", category, err)
+	}
+	if book, _ := store.GetBookByID("b1"); fmt.Sprint(book.Categories) != "[fiction]" {
+		t.Errorf("book categories = %v", book.Categories)
+	}
+	if err := store.DeleteCategory("c1"); err != nil {
+		t.Fatalf("DeleteCategory: %v", err)
+	}
+	if err := store.DeleteCategory("c1"); err == nil {
+		t.Error("DeleteCategory of a deleted category succeeded")
+	}
+	if book, _ := store.GetBookByID("b1"); len(book.Categories) != 0 {
+		t.Errorf("book categories after DeleteCategory = %v", book.Categories)
+	}
+
+	for _, tag := range []models.Tag{
+		{ID: "t1", Name: "classic", CreatedAt: epoch},
+		{ID: "t2", Name: "favorite", CreatedAt: epoch},
+		{ID: "t3", Name: "Favourite", CreatedAt: epoch},
+	} {
+		if err := store.CreateTag(&tag); err != nil {
+			t.Fatalf("CreateTag(%s): %v", tag.ID, err)
+		}
+	}
+	if err := store.CreateTag(&models.Tag{ID: "t4", Name: "classic", CreatedAt: epoch}); !errors.Is(err, repository.ErrNameTaken) {
+		t.Errorf("CreateTag with a taken name = %v, want ErrNameTaken", err)
+	}
+	if err := store.RenameTag("t1", "favorite"); !errors.Is(err, repository.ErrNameTaken) {
+		t.Errorf("RenameTag to a taken name = %v, want ErrNameTaken", err)
+	}
+	if err := store.RenameTag("missing", "new"); err == nil {
+		t.Error("RenameTag of a missing tag succeeded")
+	}
+	if err := store.RenameTag("t1", "Classics"); err != nil {
+		t.Fatalf("RenameTag: %v", err)
+	}
+
+	if n, err := store.TagBooks("t2", []string{"b1", "b2", "missing"}); err != nil || n != 2 {
+		t.Errorf("TagBooks = %d, %v, want 2", n, err)
+	}
+	if n, err := store.TagBooks("t2", []string{"b1"}); err != nil || n != 0 {
+		t.Errorf("TagBooks of a tagged book = %d, %v, want 0", n, err)
+	}
+	if n, err := store.TagBooks("t3", []string{"b1"}); err != nil || n != 1 {
+		t.Errorf("TagBooks = %d, %v, want 1", n, err)
+	}
+	if n, err := store.UntagBooks("t2", []string{"b2", "missing"}); err != nil || n != 1 {
+		t.Errorf("UntagBooks = %d, %v, want 1", n, err)
+	}
+
+	if err := store.MergeTags("t2", []string{"t3", "t2"}); err != nil {
+		t.Fatalf("MergeTags: %v", err)
+	}
+	tags, _ := store.GetTags()
+	expectIDs(t, "tags after merge", ids(tags, func(tag models.Tag) string { return tag.ID }), []string{"t1", "t2"})
+	if tags[1].BookCount != 1 {
+		t.Errorf("merged tag has %d books, want 1", tags[1].BookCount)
+	}
+	if _, err := store.GetTagByID("t3"); err == nil {
+		t.Error("GetTagByID of a merged tag succeeded")
+	}
+	if book, _ := store.GetBookByID("b1"); fmt.Sprint(book.Tags) != "[favorite]" {
+		t.Errorf("book tags after merge = %v", book.Tags)
+	}
+
+	if err := store.DeleteTag("t2"); err != nil {
+		t.Fatalf("DeleteTag: %v", err)
+	}
+	if book, _ := store.GetBookByID("b1"); len(book.Tags) != 0 {
+		t.Errorf("book tags after DeleteTag = %v", book.Tags)
+	}
+}
+
+func testUsers(t *testing.T, store repository.Store) {
+	user := &models.User{ID: "u1", Username: "ada", Email: "ada@example.com", Password: "secret", CreatedAt: epoch, UpdatedAt: epoch}
+	if err := store.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if err := store.CreateUser(&models.User{ID: "u2", Username: "ada", Email: "other@example.com", Password: "x"}); err == nil {
+		t.Error("CreateUser with a taken username succeeded")
+	}
+
+	got, err := store.GetUserByEmail("ada@example.com")
+	if err != nil || got.ID != "u1" {
+		t.Fatalf("GetUserByEmail = %v, %v", got, err)
+	}
+	if got.Password == "secret" {
+		t.Error("password is stored in plain text")
+	}
+	if _, err := store.GetUserByUsername("nobody"); err == nil {
+		t.Error("GetUserByUsername of a missing user succeeded")
+	}
+
+	if ok, err := store.ValidatePassword("u1", "secret"); err != nil || !ok {
+		t.Errorf("ValidatePassword = %v, %v, want true", ok, err)
+	}
+	if ok, err := store.ValidatePassword("u1", "wrong"); err != nil || ok {
+		t.Errorf("ValidatePassword of a wrong password = %v, %v, want false", ok, err)
+	}
+	if err := store.UpdatePassword("u1", "changed"); err != nil {
+		t.Fatalf("UpdatePassword: %v", err)
+	}
+	if ok, _ := store.ValidatePassword("u1", "changed"); !ok {
+		t.Error("ValidatePassword rejects the new password")
+	}
+
+	got.Username = "lovelace"
+	if err := store.UpdateUser(got); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if got, err := store.GetUserByUsername("lovelace"); err != nil || got.ID != "u1" {
+		t.Errorf("GetUserByUsername after UpdateUser = %v, %v", got, err)
+	}
+
+	if err := store.DeleteUser("u1"); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := store.GetUserByID("u1"); err == nil {
+		t.Error("GetUserByID succeeded after DeleteUser")
+	}
+}
+
+func testDeleteBook(t *testing.T, store repository.Store) {
+	mustSaveBook(t, store, newBook("b1", "Dune", "", 0))
+	mustSaveBook(t, store, newBook("b2", "Emma", "", 1))
+	for _, bookID := range []string{"b1", "b2"} {
+		segment := &models.AudioSegment{ID: "s-" + bookID, BookID: bookID, SegmentNumber: 1, Content: "text", CreatedAt: epoch, UpdatedAt: epoch}
+		if err := store.SaveAudioSegment(segment); err != nil {
+			t.Fatalf("SaveAudioSegment: %v", err)
+		}
+		progress := &models.ReadingProgress{ID: "p-" + bookID, BookID: bookID, UserID: "user-1", CurrentPage: 1}
+		if err := store.UpdateReadingProgress(progress); err != nil {
+			t.Fatalf("UpdateReadingProgress: %v", err)
+		}
+		bookmark := &models.Bookmark{ID: "m-" + bookID, BookID: bookID, UserID: "user-1", PageNumber: 1, CreatedAt: epoch, UpdatedAt: epoch}
+		if err := store.CreateBookmark(bookmark); err != nil {
+			t.Fatalf("CreateBookmark: %v", err)
+		}
+	}
+	if err := store.CreateTag(&models.Tag{ID: "t1", Name: "classic", CreatedAt: epoch}); err != nil {
+		t.Fatalf("CreateTag: %v", err)
+	}
+	if _, err := store.TagBooks("t1", []string{"b1", "b2"}); err != nil {
+		t.Fatalf("TagBooks: %v", err)
+	}
+	if _, err := store.SetBookCover(&models.Book{ID: "b1"}, []models.CoverThumbnail{{Width: 200, Height: 300, Key: "k"}}); err != nil {
+		t.Fatalf("SetBookCover: %v", err)
+	}
+
+	if err := store.DeleteBook("b1"); err != nil {
+		t.Fatalf("DeleteBook: %v", err)
+	}
+	if _, err := store.GetBookByID("b1"); err == nil {
+		t.Error("GetBookByID succeeded after DeleteBook")
+	}
+	if segments, _ := store.GetAudioSegments("b1"); len(segments) != 0 {
+		t.Errorf("%d segments left after DeleteBook", len(segments))
+	}
+	if _, err := store.GetReadingProgress("b1", "user-1"); err == nil {
+		t.Error("reading progress left after DeleteBook")
+	}
+	if bookmarks, _ := store.GetBookmarks("b1", "user-1"); len(bookmarks) != 0 {
+		t.Errorf("%d bookmarks left after DeleteBook", len(bookmarks))
+	}
+	if thumbs, _ := store.GetCoverThumbnails("b1"); len(thumbs) != 0 {
+		t.Errorf("%d thumbnails left after DeleteBook", len(thumbs))
+	}
+	if tag, _ := store.GetTagByID("t1"); tag == nil || tag.BookCount != 1 {
+		t.Errorf("tag after DeleteBook = %+v, want 1 book", tag)
+	}
+
+	if _, err := store.GetBookByID("b2"); err != nil {
+		t.Errorf("DeleteBook removed another book: %v", err)
+	}
+	if segments, _ := store.GetAudioSegments("b2"); len(segments) != 1 {
+		t.Errorf("DeleteBook removed another book's segments")
+	}
+}
+
+func testMissingParents(t *testing.T, store repository.Store) {
+	mustSaveBook(t, store, newBook("b1", "Dune", "", 0))
+
+	segment := &models.AudioSegment{ID: "s1", BookID: "missing", SegmentNumber: 1, Content: "text", CreatedAt: epoch, UpdatedAt: epoch}
+	if err := store.SaveAudioSegment(segment); err == nil {
+		t.Error("SaveAudioSegment of a missing book succeeded")
+	}
+	segment.BookID = "b1"
+	if _, err := store.ReviseAudioSegment(segment, "old", models.RevisionSourceEdit); err == nil {
+		t.Error("ReviseAudioSegment of a missing segment succeeded")
+	}
+	if err := store.UpdateReadingProgress(&models.ReadingProgress{ID: "p1", BookID: "missing", UserID: "user-1"}); err == nil {
+		t.Error("UpdateReadingProgress of a missing book succeeded")
+	}
+	if err := store.CreateBookmark(&models.Bookmark{ID: "m1", BookID: "missing", UserID: "user-1", CreatedAt: epoch, UpdatedAt: epoch}); err == nil {
+		t.Error("CreateBookmark of a missing book succeeded")
+	}
+	if err := store.AddBookToCategory("b1", "missing"); err == nil {
+		t.Error("AddBookToCategory of a missing category succeeded")
+	}
+	if err := store.CreateCategory(&models.Category{ID: "c1", Name: "fiction", CreatedAt: epoch}); err != nil {
+		t.Fatalf("CreateCategory: %v", err)
+	}
+	if err := store.AddBookToCategory("missing", "c1"); err == nil {
+		t.Error("AddBookToCategory of a missing book succeeded")
+	}
+	if category, _ := store.GetCategoryByID("c1"); category == nil || category.BookCount != 0 {
+		t.Errorf("category after failed assignments = %+v, want no books", category)
+	}
+}
@@ -7,37 +7,95 @@ import (
 	"backend/domain/models"
 )
 
+// audioSegmentColumns lists the columns read by scanAudioSegment, in order
+const audioSegmentColumns = `
+	id, book_id, segment_number, page_number, content, audio_url, COALESCE(audio_key, ''),
+	COALESCE(audio_size, 0), container, codec, mime_type, duration, status,
+	last_error, skip, created_at, updated_at
+`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanAudioSegment scans a row selected with audioSegmentColumns
+func scanAudioSegment(row rowScanner, segment *models.AudioSegment) error {
+	return row.Scan(
+		&segment.ID,
+		&segment.BookID,
+		&segment.SegmentNumber,
+		&segment.PageNumber,
+		&segment.Content,
+		&segment.AudioURL,
+		&segment.AudioKey,
+		&segment.AudioSize,
+		&segment.Container,
+		&segment.Codec,
+		&segment.MimeType,
+		&segment.Duration,
+		&segment.Status,
+		&segment.LastError,
+		&segment.Skip,
+		&segment.CreatedAt,
+		&segment.UpdatedAt,
+	)
+}
+
 // SaveAudioSegment saves a new audio segment to the database
 func (db *DB) SaveAudioSegment(segment *models.AudioSegment) error {
 	query := `
-		INSERT INTO audio_segments (
-			id, book_id, content, audio_url,
-			status, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO audio_segments (` + audioSegmentInsertColumns + `)
+		VALUES ` + audioSegmentPlaceholders + `
 	`
 
-	_, err := db.Exec(query,
+	if _, err := db.Exec(query, audioSegmentValues(segment)...); err != nil {
+		return fmt.Errorf("error saving audio segment: %v", err)
+	}
+
+	return nil
+}
+
+// audioSegmentInsertColumns lists the columns written for a new segment, in
+// the order of audioSegmentValues
+const audioSegmentInsertColumns = `
+	id, book_id, segment_number, page_number, content, audio_url, audio_key,
+	audio_size, container, codec, mime_type, duration, status,
+	last_error, skip, created_at, updated_at
+`
+
+// audioSegmentPlaceholders holds one placeholder per insert column
+const audioSegmentPlaceholders = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+// audioSegmentValues returns the values of audioSegmentInsertColumns for a segment
+func audioSegmentValues(segment *models.AudioSegment) []interface{} {
+	return []interface{}{
 		segment.ID,
 		segment.BookID,
+		segment.SegmentNumber,
+		segment.PageNumber,
 		segment.Content,
 		segment.AudioURL,
+		segment.AudioKey,
+		segment.AudioSize,
+		segment.Container,
+		segment.Codec,
+		segment.MimeType,
+		segment.Duration,
 		segment.Status,
+		segment.LastError,
+		segment.Skip,
 		segment.CreatedAt,
 		segment.UpdatedAt,
-	)
-
-	if err != nil {
-		return fmt.Errorf("error saving audio segment: %v", err)
 	}
-
-	return nil
 }
 
 // UpdateAudioSegment updates an existing audio segment in the database
 func (db *DB) UpdateAudioSegment(segment *models.AudioSegment) error {
 	query := `
 		UPDATE audio_segments 
-		SET content = ?, audio_url = ?, status = ?, updated_at = ?
+		SET content = ?, audio_url = ?, audio_key = ?, audio_size = ?, container = ?, codec = ?, mime_type = ?,
+			duration = ?, status = ?, last_error = ?, skip = ?, updated_at = ?
 		WHERE id = ?
 	`
 
@@ -45,7 +103,15 @@ func (db *DB) UpdateAudioSegment(segment *models.AudioSegment) error {
 	_, err := db.Exec(query,
 		segment.Content,
 		segment.AudioURL,
+		segment.AudioKey,
+		segment.AudioSize,
+		segment.Container,
+		segment.Codec,
+		segment.MimeType,
+		segment.Duration,
 		segment.Status,
+		segment.LastError,
+		segment.Skip,
 		segment.UpdatedAt,
 		segment.ID,
 	)
@@ -57,16 +123,15 @@ func (db *DB) UpdateAudioSegment(segment *models.AudioSegment) error {
 	return nil
 }
 
-// GetAudioSegments retrieves all audio segments for a book
+// GetAudioSegments retrieves all audio segments for a book in playback order
 func (db *DB) GetAudioSegments(bookID string) ([]models.AudioSegment, error) {
-	query := `
-		SELECT id, book_id, content, audio_url, status, created_at, updated_at
+	query := `SELECT ` + audioSegmentColumns + `
 		FROM audio_segments
 		WHERE book_id = ?
-		ORDER BY created_at ASC
+		ORDER BY segment_number ASC, created_at ASC
 	`
 
-	rows, err := db.Query(query, bookID)
+	rows, err := db.readers.Query(query, bookID)
 	if err != nil {
 		return nil, fmt.Errorf("error querying audio segments: %v", err)
 	}
@@ -75,16 +140,7 @@ func (db *DB) GetAudioSegments(bookID string) ([]models.AudioSegment, error) {
 	var segments []models.AudioSegment
 	for rows.Next() {
 		var segment models.AudioSegment
-		err := rows.Scan(
-			&segment.ID,
-			&segment.BookID,
-			&segment.Content,
-			&segment.AudioURL,
-			&segment.Status,
-			&segment.CreatedAt,
-			&segment.UpdatedAt,
-		)
-		if err != nil {
+		if err := scanAudioSegment(rows, &segment); err != nil {
 			return nil, fmt.Errorf("error scanning audio segment: %v", err)
 		}
 		segments = append(segments, segment)
@@ -95,36 +151,51 @@ func (db *DB) GetAudioSegments(bookID string) ([]models.AudioSegment, error) {
 
 // GetAudioSegmentByID retrieves an audio segment by its ID
 func (db *DB) GetAudioSegmentByID(id string) (*models.AudioSegment, error) {
-	query := `
-		SELECT id, book_id, content, audio_url, status, created_at, updated_at
+	query := `SELECT ` + audioSegmentColumns + `
 		FROM audio_segments
 		WHERE id = ?
 	`
 
 	segment := &models.AudioSegment{}
-	err := db.QueryRow(query, id).Scan(
-		&segment.ID,
-		&segment.BookID,
-		&segment.Content,
-		&segment.AudioURL,
-		&segment.Status,
-		&segment.CreatedAt,
-		&segment.UpdatedAt,
-	)
+	if err := scanAudioSegment(db.readers.QueryRow(query, id), segment); err != nil {
+		return nil, fmt.Errorf("error getting audio segment: %v", err)
+	}
 
-	if err != nil {
+	return segment, nil
+}
+
+// GetAudioSegmentByNumber retrieves the segment at a position within a book
+func (db *DB) GetAudioSegmentByNumber(bookID string, segmentNumber int) (*models.AudioSegment, error) {
+	query := `SELECT ` + audioSegmentColumns + `
+		FROM audio_segments
+		WHERE book_id = ? AND segment_number = ?
+	`
+
+	segment := &models.AudioSegment{}
+	if err := scanAudioSegment(db.readers.QueryRow(query, bookID, segmentNumber), segment); err != nil {
 		return nil, fmt.Errorf("error getting audio segment: %v", err)
 	}
 
 	return segment, nil
 }
 
-// DeleteAudioSegment deletes an audio segment from the database
+// DeleteAudioSegment deletes an audio segment and its revision history from the database
 func (db *DB) DeleteAudioSegment(id string) error {
-	query := "DELETE FROM audio_segments WHERE id = ?"
-	_, err := db.Exec(query, id)
+	tx, err := db.Begin()
 	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM segment_revisions WHERE segment_id = ?", id); err != nil {
+		return fmt.Errorf("error deleting segment revisions: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM audio_segments WHERE id = ?", id); err != nil {
 		return fmt.Errorf("error deleting audio segment: %v", err)
 	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
 	return nil
 }
@@ -0,0 +1,87 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Backup copies a consistent snapshot of the database to a new file at
+// destPath using SQLite's online backup API. Writes continue meanwhile; the
+// snapshot is taken in a single read transaction so it never sees half of one.
+func (db *DB) Backup(ctx context.Context, destPath string) error {
+	if _, err := os.Stat(destPath); err == nil {
+		return fmt.Errorf("error backing up database: %s already exists", destPath)
+	}
+
+	dest, err := sql.Open("sqlite3", destPath)
+	if err != nil {
+		return fmt.Errorf("error creating backup database: %v", err)
+	}
+	defer dest.Close()
+
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error creating backup database: %v", err)
+	}
+	defer destConn.Close()
+
+	srcConn, err := db.readers.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting connection: %v", err)
+	}
+	defer srcConn.Close()
+
+	err = destConn.Raw(func(destDriver interface{}) error {
+		return srcConn.Raw(func(srcDriver interface{}) error {
+			destSQLite, ok := destDriver.(*sqlite3.SQLiteConn)
+			srcSQLite, ok2 := srcDriver.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return fmt.Errorf("unexpected driver connection")
+			}
+
+			backup, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("error backing up database: %v", err)
+	}
+
+	// Leave a single self-contained file rather than one that expects a WAL
+	if _, err := destConn.ExecContext(ctx, "PRAGMA journal_mode = DELETE"); err != nil {
+		return fmt.Errorf("error finishing backup database: %v", err)
+	}
+	return nil
+}
+
+// IntegrityCheck runs SQLite's integrity check and returns the problems it finds
+func (db *DB) IntegrityCheck() ([]string, error) {
+	rows, err := db.readers.Query("PRAGMA integrity_check")
+	if err != nil {
+		return nil, fmt.Errorf("error checking database integrity: %v", err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return nil, fmt.Errorf("error scanning integrity check: %v", err)
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	return problems, rows.Err()
+}
@@ -1,28 +1,127 @@
 package sqlite
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"backend/domain/models"
 )
 
+// bookColumns lists the columns read by scanBook, in order. Categories and
+// tags are read as JSON arrays of names, and cover thumbnails as a JSON array
+// of objects, so a page of books takes a single query. Columns are qualified,
+// so queries must select from books without an alias.
+const bookColumns = `
+	books.id, books.title, COALESCE(books.author, ''), books.description, books.series, books.isbn,
+	COALESCE(books.cover_url, ''), books.file_url,
+	COALESCE(books.file_key, ''), COALESCE(books.cover_key, ''),
+	COALESCE(books.user_id, ''), COALESCE(books.file_size, 0), books.cover_size,
+	books.content_hash, books.text_fingerprint,
+	books.page_count, books.current_page, books.language, books.status,
+	books.created_at, books.updated_at,
+	(SELECT json_group_array(name) FROM (
+		SELECT c.name FROM book_categories bc JOIN categories c ON c.id = bc.category_id
+		WHERE bc.book_id = books.id ORDER BY c.name
+	)),
+	(SELECT json_group_array(name) FROM (
+		SELECT t.name FROM book_tags bt JOIN tags t ON t.id = bt.tag_id
+		WHERE bt.book_id = books.id ORDER BY t.name
+	)),
+	(SELECT json_group_array(json_object('w', width, 'h', height, 'k', key, 's', size)) FROM (
+		SELECT width, height, key, size FROM cover_thumbnails
+		WHERE cover_thumbnails.book_id = books.id ORDER BY width
+	))
+`
+
+// thumbnailColumn is a cover thumbnail as read from bookColumns
+type thumbnailColumn struct {
+	Width  int    `json:"w"`
+	Height int    `json:"h"`
+	Key    string `json:"k"`
+	Size   int64  `json:"s"`
+}
+
+// scanBook scans a row selected with bookColumns, followed by any extra columns
+func scanBook(row rowScanner, book *models.Book, extra ...interface{}) error {
+	var categories, tags, thumbnails string
+	err := row.Scan(append([]interface{}{
+		&book.ID,
+		&book.Title,
+		&book.Author,
+		&book.Description,
+		&book.Series,
+		&book.ISBN,
+		&book.CoverURL,
+		&book.FileURL,
+		&book.FileKey,
+		&book.CoverKey,
+		&book.UserID,
+		&book.FileSize,
+		&book.CoverSize,
+		&book.ContentHash,
+		&book.TextFingerprint,
+		&book.PageCount,
+		&book.CurrentPage,
+		&book.Language,
+		&book.Status,
+		&book.CreatedAt,
+		&book.UpdatedAt,
+		&categories,
+		&tags,
+		&thumbnails,
+	}, extra...)...)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal([]byte(categories), &book.Categories); err != nil {
+		return fmt.Errorf("error decoding categories: %v", err)
+	}
+	if err := json.Unmarshal([]byte(tags), &book.Tags); err != nil {
+		return fmt.Errorf("error decoding tags: %v", err)
+	}
+
+	var thumbs []thumbnailColumn
+	if err := json.Unmarshal([]byte(thumbnails), &thumbs); err != nil {
+		return fmt.Errorf("error decoding cover thumbnails: %v", err)
+	}
+	book.Thumbnails = make([]models.CoverThumbnail, len(thumbs))
+	for i, thumb := range thumbs {
+		book.Thumbnails[i] = models.CoverThumbnail{BookID: book.ID, Width: thumb.Width, Height: thumb.Height, Key: thumb.Key, Size: thumb.Size}
+	}
+	return nil
+}
+
 // SaveBook saves a book to the database
 func (db *DB) SaveBook(book *models.Book) error {
 	query := `
 		INSERT INTO books (
-			id, title, author, cover_url, file_url,
+			id, title, author, description, series, isbn,
+			cover_url, file_url,
+			file_key, cover_key, user_id, file_size, cover_size,
+			content_hash, text_fingerprint,
 			page_count, current_page, language, status,
 			created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	_, err := db.Exec(query,
 		book.ID,
 		book.Title,
 		book.Author,
+		book.Description,
+		book.Series,
+		book.ISBN,
 		book.CoverURL,
 		book.FileURL,
+		book.FileKey,
+		book.CoverKey,
+		book.UserID,
+		book.FileSize,
+		book.CoverSize,
+		book.ContentHash,
+		book.TextFingerprint,
 		book.PageCount,
 		book.CurrentPage,
 		book.Language,
@@ -40,30 +139,13 @@ func (db *DB) SaveBook(book *models.Book) error {
 
 // GetBookByID retrieves a book by its ID
 func (db *DB) GetBookByID(id string) (*models.Book, error) {
-	query := `
-		SELECT id, title, author, cover_url, file_url,
-			   page_count, current_page, language, status,
-			   created_at, updated_at
+	query := `SELECT ` + bookColumns + `
 		FROM books
 		WHERE id = ?
 	`
 
 	book := &models.Book{}
-	err := db.QueryRow(query, id).Scan(
-		&book.ID,
-		&book.Title,
-		&book.Author,
-		&book.CoverURL,
-		&book.FileURL,
-		&book.PageCount,
-		&book.CurrentPage,
-		&book.Language,
-		&book.Status,
-		&book.CreatedAt,
-		&book.UpdatedAt,
-	)
-
-	if err != nil {
+	if err := scanBook(db.readers.QueryRow(query, id), book); err != nil {
 		return nil, fmt.Errorf("error getting book: %v", err)
 	}
 
@@ -74,7 +156,10 @@ func (db *DB) GetBookByID(id string) (*models.Book, error) {
 func (db *DB) UpdateBook(book *models.Book) error {
 	query := `
 		UPDATE books 
-		SET title = ?, author = ?, cover_url = ?, file_url = ?, 
+		SET title = ?, author = ?, description = ?, series = ?, isbn = ?,
+			cover_url = ?, file_url = ?,
+			file_key = ?, cover_key = ?, file_size = ?, cover_size = ?,
+			content_hash = ?, text_fingerprint = ?,
 			page_count = ?, current_page = ?, language = ?, status = ?,
 			updated_at = ?
 		WHERE id = ?
@@ -84,8 +169,17 @@ func (db *DB) UpdateBook(book *models.Book) error {
 	_, err := db.Exec(query,
 		book.Title,
 		book.Author,
+		book.Description,
+		book.Series,
+		book.ISBN,
 		book.CoverURL,
 		book.FileURL,
+		book.FileKey,
+		book.CoverKey,
+		book.FileSize,
+		book.CoverSize,
+		book.ContentHash,
+		book.TextFingerprint,
 		book.PageCount,
 		book.CurrentPage,
 		book.Language,
@@ -101,53 +195,80 @@ func (db *DB) UpdateBook(book *models.Book) error {
 	return nil
 }
 
-// GetBooks retrieves all books from the database
-func (db *DB) GetBooks() ([]models.Book, error) {
-	query := `
-		SELECT id, title, author, cover_url, file_url,
-			   page_count, current_page, language, status,
-			   created_at, updated_at
-		FROM books
-		ORDER BY created_at DESC
-	`
+// SetBookMetadata records a book's title, author, language, description,
+// series and ISBN without touching the columns processing writes
+func (db *DB) SetBookMetadata(book *models.Book) error {
+	book.UpdatedAt = time.Now()
+	_, err := db.Exec(`
+		UPDATE books
+		SET title = ?, author = ?, language = ?, description = ?, series = ?, isbn = ?, updated_at = ?
+		WHERE id = ?`,
+		book.Title, book.Author, book.Language, book.Description, book.Series, book.ISBN, book.UpdatedAt, book.ID)
+	if err != nil {
+		return fmt.Errorf("error updating book metadata: %v", err)
+	}
+	return nil
+}
 
-	rows, err := db.Query(query)
+// SetBookStatus records a book's status without touching its other columns,
+// so that it never undoes an edit made while the book is processed
+func (db *DB) SetBookStatus(bookID, status string) error {
+	_, err := db.Exec("UPDATE books SET status = ?, updated_at = ? WHERE id = ?", status, time.Now(), bookID)
 	if err != nil {
-		return nil, fmt.Errorf("error querying books: %v", err)
-	}
-	defer rows.Close()
-
-	var books []models.Book
-	for rows.Next() {
-		var book models.Book
-		err := rows.Scan(
-			&book.ID,
-			&book.Title,
-			&book.Author,
-			&book.CoverURL,
-			&book.FileURL,
-			&book.PageCount,
-			&book.CurrentPage,
-			&book.Language,
-			&book.Status,
-			&book.CreatedAt,
-			&book.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("error scanning book: %v", err)
-		}
-		books = append(books, book)
+		return fmt.Errorf("error updating book status: %v", err)
 	}
+	return nil
+}
+
+// SetBookFile records the storage key, size and content hash of a book's source file
+func (db *DB) SetBookFile(bookID, key string, size int64, hash string) error {
+	_, err := db.Exec("UPDATE books SET file_key = ?, file_size = ?, content_hash = ?, updated_at = ? WHERE id = ?",
+		key, size, hash, time.Now(), bookID)
+	if err != nil {
+		return fmt.Errorf("error updating book file: %v", err)
+	}
+	return nil
+}
 
-	return books, nil
+// SetBookURL records a book's new source URL and forgets the file stored
+// from the old one, so the next processing downloads it again
+func (db *DB) SetBookURL(bookID, url string) error {
+	_, err := db.Exec("UPDATE books SET file_url = ?, file_key = '', file_size = 0, content_hash = '', updated_at = ? WHERE id = ?",
+		url, time.Now(), bookID)
+	if err != nil {
+		return fmt.Errorf("error updating book URL: %v", err)
+	}
+	return nil
 }
 
-// DeleteBook deletes a book from the database
+// DeleteBook deletes a book and every row that belongs to it
 func (db *DB) DeleteBook(id string) error {
-	query := "DELETE FROM books WHERE id = ?"
-	_, err := db.Exec(query, id)
+	tx, err := db.Begin()
 	if err != nil {
-		return fmt.Errorf("error deleting book: %v", err)
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		"DELETE FROM segment_revisions WHERE segment_id IN (SELECT id FROM audio_segments WHERE book_id = ?)",
+		"DELETE FROM audio_segments WHERE book_id = ?",
+		"DELETE FROM book_categories WHERE book_id = ?",
+		"DELETE FROM book_tags WHERE book_id = ?",
+		"DELETE FROM book_events WHERE book_id = ?",
+		"DELETE FROM book_stages WHERE book_id = ?",
+		"DELETE FROM reading_progress WHERE book_id = ?",
+		"DELETE FROM bookmarks WHERE book_id = ?",
+		"DELETE FROM cover_thumbnails WHERE book_id = ?",
+		"DELETE FROM books WHERE id = ?",
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, id); err != nil {
+			return fmt.Errorf("error deleting book: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
 	}
 	return nil
 }
@@ -66,7 +66,7 @@ func (db *DB) GetBookmarks(bookID, userID string) ([]models.Bookmark, error) {
 		ORDER BY page_number ASC
 	`
 
-	rows, err := db.Query(query, bookID, userID)
+	rows, err := db.readers.Query(query, bookID, userID)
 	if err != nil {
 		return nil, fmt.Errorf("error querying bookmarks: %v", err)
 	}
@@ -102,7 +102,7 @@ func (db *DB) GetBookmarkByID(id string) (*models.Bookmark, error) {
 	`
 
 	bookmark := &models.Bookmark{}
-	err := db.QueryRow(query, id).Scan(
+	err := db.readers.QueryRow(query, id).Scan(
 		&bookmark.ID,
 		&bookmark.BookID,
 		&bookmark.UserID,
@@ -1,72 +1,119 @@
 package sqlite
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 
+	"github.com/mattn/go-sqlite3"
+
 	"backend/domain/models"
+	"backend/repository"
 )
 
+// ErrNameTaken is returned when a category or tag is given a name another one already has
+var ErrNameTaken = repository.ErrNameTaken
+
+const categoryColumns = `
+	c.id, c.name, COALESCE(c.description, ''), c.created_at,
+	(SELECT COUNT(*) FROM book_categories bc WHERE bc.category_id = c.id)
+`
+
+const tagColumns = `
+	t.id, t.name, t.created_at,
+	(SELECT COUNT(*) FROM book_tags bt WHERE bt.tag_id = t.id)
+`
+
+func scanCategory(row rowScanner, category *models.Category) error {
+	return row.Scan(
+		&category.ID,
+		&category.Name,
+		&category.Description,
+		&category.CreatedAt,
+		&category.BookCount,
+	)
+}
+
+func scanTag(row rowScanner, tag *models.Tag) error {
+	return row.Scan(
+		&tag.ID,
+		&tag.Name,
+		&tag.CreatedAt,
+		&tag.BookCount,
+	)
+}
+
 // GetCategories retrieves all categories from the database
 func (db *DB) GetCategories() ([]models.Category, error) {
-	query := `
-		SELECT id, name, description, created_at
-		FROM categories
-		ORDER BY name ASC
+	query := `SELECT ` + categoryColumns + `
+		FROM categories c
+		ORDER BY c.name COLLATE NOCASE ASC
 	`
 
-	rows, err := db.Query(query)
+	rows, err := db.readers.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("error querying categories: %v", err)
 	}
 	defer rows.Close()
 
-	var categories []models.Category
+	categories := []models.Category{}
 	for rows.Next() {
 		var category models.Category
-		err := rows.Scan(
-			&category.ID,
-			&category.Name,
-			&category.Description,
-			&category.CreatedAt,
-		)
-		if err != nil {
+		if err := scanCategory(rows, &category); err != nil {
 			return nil, fmt.Errorf("error scanning category: %v", err)
 		}
 		categories = append(categories, category)
 	}
 
-	return categories, nil
+	return categories, rows.Err()
 }
 
-// GetTags retrieves all tags from the database
+// GetCategoryByID retrieves a category by its ID
+func (db *DB) GetCategoryByID(id string) (*models.Category, error) {
+	query := `SELECT ` + categoryColumns + ` FROM categories c WHERE c.id = ?`
+
+	category := &models.Category{}
+	if err := scanCategory(db.readers.QueryRow(query, id), category); err != nil {
+		return nil, fmt.Errorf("error getting category: %v", err)
+	}
+	return category, nil
+}
+
+// GetTags retrieves all tags from the database with the number of books
+// carrying each
 func (db *DB) GetTags() ([]models.Tag, error) {
-	query := `
-		SELECT id, name, created_at
-		FROM tags
-		ORDER BY name ASC
+	query := `SELECT ` + tagColumns + `
+		FROM tags t
+		ORDER BY t.name COLLATE NOCASE ASC
 	`
 
-	rows, err := db.Query(query)
+	rows, err := db.readers.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("error querying tags: %v", err)
 	}
 	defer rows.Close()
 
-	var tags []models.Tag
+	tags := []models.Tag{}
 	for rows.Next() {
 		var tag models.Tag
-		err := rows.Scan(
-			&tag.ID,
-			&tag.Name,
-			&tag.CreatedAt,
-		)
-		if err != nil {
+		if err := scanTag(rows, &tag); err != nil {
 			return nil, fmt.Errorf("error scanning tag: %v", err)
 		}
 		tags = append(tags, tag)
 	}
 
-	return tags, nil
+	return tags, rows.Err()
+}
+
+// GetTagByID retrieves a tag by its ID
+func (db *DB) GetTagByID(id string) (*models.Tag, error) {
+	query := `SELECT ` + tagColumns + ` FROM tags t WHERE t.id = ?`
+
+	tag := &models.Tag{}
+	if err := scanTag(db.readers.QueryRow(query, id), tag); err != nil {
+		return nil, fmt.Errorf("error getting tag: %v", err)
+	}
+	return tag, nil
 }
 
 // CreateCategory creates a new category in the database
@@ -84,12 +131,28 @@ func (db *DB) CreateCategory(category *models.Category) error {
 	)
 
 	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrNameTaken
+		}
 		return fmt.Errorf("error creating category: %v", err)
 	}
 
 	return nil
 }
 
+// UpdateCategory renames a category and replaces its description
+func (db *DB) UpdateCategory(category *models.Category) error {
+	query := "UPDATE categories SET name = ?, description = ? WHERE id = ?"
+	result, err := db.Exec(query, category.Name, category.Description, category.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrNameTaken
+		}
+		return fmt.Errorf("error updating category: %v", err)
+	}
+	return requireRow(result, "category")
+}
+
 // CreateTag creates a new tag in the database
 func (db *DB) CreateTag(tag *models.Tag) error {
 	query := `
@@ -104,28 +167,181 @@ func (db *DB) CreateTag(tag *models.Tag) error {
 	)
 
 	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrNameTaken
+		}
 		return fmt.Errorf("error creating tag: %v", err)
 	}
 
 	return nil
 }
 
-// DeleteCategory deletes a category from the database
+// RenameTag changes a tag's name
+func (db *DB) RenameTag(id, name string) error {
+	result, err := db.Exec("UPDATE tags SET name = ? WHERE id = ?", name, id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrNameTaken
+		}
+		return fmt.Errorf("error renaming tag: %v", err)
+	}
+	return requireRow(result, "tag")
+}
+
+// DeleteCategory deletes a category and removes every book from it
 func (db *DB) DeleteCategory(id string) error {
-	query := "DELETE FROM categories WHERE id = ?"
-	_, err := db.Exec(query, id)
+	return db.deleteWithLinks("category", "DELETE FROM book_categories WHERE category_id = ?", "DELETE FROM categories WHERE id = ?", id)
+}
+
+// DeleteTag deletes a tag and removes it from every book
+func (db *DB) DeleteTag(id string) error {
+	return db.deleteWithLinks("tag", "DELETE FROM book_tags WHERE tag_id = ?", "DELETE FROM tags WHERE id = ?", id)
+}
+
+func (db *DB) deleteWithLinks(kind, unlink, remove, id string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(unlink, id); err != nil {
+		return fmt.Errorf("error deleting %s: %v", kind, err)
+	}
+	result, err := tx.Exec(remove, id)
 	if err != nil {
-		return fmt.Errorf("error deleting category: %v", err)
+		return fmt.Errorf("error deleting %s: %v", kind, err)
+	}
+	if err := requireRow(result, kind); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
 	}
 	return nil
 }
 
-// DeleteTag deletes a tag from the database
-func (db *DB) DeleteTag(id string) error {
-	query := "DELETE FROM tags WHERE id = ?"
-	_, err := db.Exec(query, id)
+// AddBookToCategory puts a book in a category. Adding it again is a no-op.
+func (db *DB) AddBookToCategory(bookID, categoryID string) error {
+	query := "INSERT OR IGNORE INTO book_categories (book_id, category_id) VALUES (?, ?)"
+	if _, err := db.Exec(query, bookID, categoryID); err != nil {
+		return fmt.Errorf("error adding book to category: %v", err)
+	}
+	return nil
+}
+
+// RemoveBookFromCategory takes a book out of a category
+func (db *DB) RemoveBookFromCategory(bookID, categoryID string) error {
+	query := "DELETE FROM book_categories WHERE book_id = ? AND category_id = ?"
+	if _, err := db.Exec(query, bookID, categoryID); err != nil {
+		return fmt.Errorf("error removing book from category: %v", err)
+	}
+	return nil
+}
+
+// TagBooks adds a tag to each of the books that exist and do not have it
+// yet, and returns how many books were tagged
+func (db *DB) TagBooks(tagID string, bookIDs []string) (int, error) {
+	query := `
+		INSERT OR IGNORE INTO book_tags (book_id, tag_id)
+		SELECT id, ? FROM books WHERE id = ?
+	`
+	n, err := db.execEach(query, tagID, bookIDs)
+	if err != nil {
+		return n, fmt.Errorf("error tagging books: %v", err)
+	}
+	return n, nil
+}
+
+// UntagBooks removes a tag from the books and returns how many had it
+func (db *DB) UntagBooks(tagID string, bookIDs []string) (int, error) {
+	n, err := db.execEach("DELETE FROM book_tags WHERE tag_id = ? AND book_id = ?", tagID, bookIDs)
+	if err != nil {
+		return n, fmt.Errorf("error untagging books: %v", err)
+	}
+	return n, nil
+}
+
+// execEach runs a statement taking a tag ID and a book ID once per book in
+// one transaction and returns the number of rows it changed
+func (db *DB) execEach(query, tagID string, bookIDs []string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
 	if err != nil {
-		return fmt.Errorf("error deleting tag: %v", err)
+		return 0, err
+	}
+	defer stmt.Close()
+
+	changed := 0
+	for _, bookID := range bookIDs {
+		result, err := stmt.Exec(tagID, bookID)
+		if err != nil {
+			return 0, err
+		}
+		n, _ := result.RowsAffected()
+		changed += int(n)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return changed, nil
+}
+
+// MergeTags moves every book tagged with one of sourceIDs to targetID and
+// deletes the source tags
+func (db *DB) MergeTags(targetID string, sourceIDs []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, sourceID := range sourceIDs {
+		if sourceID == targetID {
+			continue
+		}
+		_, err := tx.Exec(`
+			INSERT OR IGNORE INTO book_tags (book_id, tag_id)
+			SELECT book_id, ? FROM book_tags WHERE tag_id = ?
+		`, targetID, sourceID)
+		if err == nil {
+			_, err = tx.Exec("DELETE FROM book_tags WHERE tag_id = ?", sourceID)
+		}
+		if err == nil {
+			_, err = tx.Exec("DELETE FROM tags WHERE id = ?", sourceID)
+		}
+		if err != nil {
+			return fmt.Errorf("error merging tag %s: %v", sourceID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
 	}
 	return nil
 }
+
+// requireRow returns sql.ErrNoRows, wrapped, when a statement changed nothing
+func requireRow(result sql.Result, kind string) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking %s update: %v", kind, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s not found: %w", kind, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err comes from a UNIQUE constraint
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
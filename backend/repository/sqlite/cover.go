@@ -0,0 +1,78 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+
+	"backend/domain/models"
+)
+
+// SetBookCover records a book's cover and replaces its thumbnails. It
+// returns the references of the cover and thumbnails it replaced, read in
+// the same transaction so that concurrent changes are never lost.
+func (db *DB) SetBookCover(book *models.Book, thumbnails []models.CoverThumbnail) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var coverKey, coverURL string
+	err = tx.QueryRow("SELECT COALESCE(cover_key, ''), COALESCE(cover_url, '') FROM books WHERE id = ?", book.ID).Scan(&coverKey, &coverURL)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("error getting book cover: %v", err)
+	}
+	replaced := []string{coverKey, coverURL}
+
+	rows, err := tx.Query("SELECT key FROM cover_thumbnails WHERE book_id = ?", book.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting cover thumbnails: %v", err)
+	}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning cover thumbnail: %v", err)
+		}
+		replaced = append(replaced, key)
+	}
+	rows.Close()
+
+	if _, err := tx.Exec("UPDATE books SET cover_url = ?, cover_key = ?, cover_size = ?, updated_at = ? WHERE id = ?",
+		book.CoverURL, book.CoverKey, book.CoverSize, book.UpdatedAt, book.ID); err != nil {
+		return nil, fmt.Errorf("error updating book cover: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM cover_thumbnails WHERE book_id = ?", book.ID); err != nil {
+		return nil, fmt.Errorf("error deleting cover thumbnails: %v", err)
+	}
+	for _, thumb := range thumbnails {
+		if _, err := tx.Exec("INSERT INTO cover_thumbnails (book_id, width, height, key, size) VALUES (?, ?, ?, ?, ?)",
+			book.ID, thumb.Width, thumb.Height, thumb.Key, thumb.Size); err != nil {
+			return nil, fmt.Errorf("error saving cover thumbnail: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %v", err)
+	}
+	return replaced, nil
+}
+
+// GetCoverThumbnails retrieves the thumbnails of a book's cover, smallest first
+func (db *DB) GetCoverThumbnails(bookID string) ([]models.CoverThumbnail, error) {
+	rows, err := db.readers.Query("SELECT book_id, width, height, key, size FROM cover_thumbnails WHERE book_id = ? ORDER BY width", bookID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying cover thumbnails: %v", err)
+	}
+	defer rows.Close()
+
+	var thumbnails []models.CoverThumbnail
+	for rows.Next() {
+		var thumb models.CoverThumbnail
+		if err := rows.Scan(&thumb.BookID, &thumb.Width, &thumb.Height, &thumb.Key, &thumb.Size); err != nil {
+			return nil, fmt.Errorf("error scanning cover thumbnail: %v", err)
+		}
+		thumbnails = append(thumbnails, thumb)
+	}
+	return thumbnails, rows.Err()
+}
@@ -3,84 +3,175 @@ package sqlite
 import (
 	"database/sql"
 	"fmt"
-	"os"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+
+	"backend/repository"
 )
 
-// DB represents a database connection
+// DB represents a database connection. Writes share a single connection,
+// so writers queue in the process rather than failing on SQLite's lock, while
+// reads use a pool of read-only connections that WAL lets run alongside it.
 type DB struct {
 	*sql.DB
+
+	// readers serves queries outside transactions
+	readers *sql.DB
+
+	// foreignKeys is set when foreign keys are enforced
+	foreignKeys bool
+
+	// fts is set by InitSearch when SQLite was built with FTS5
+	fts bool
 }
 
-// NewDB creates a new database connection
-func NewDB(dbPath string) (*DB, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+var _ repository.Store = (*DB)(nil)
+
+// Options configures the connections to the database
+type Options struct {
+	JournalMode string        // DELETE, TRUNCATE, PERSIST, MEMORY, WAL or OFF
+	Synchronous string        // OFF, NORMAL, FULL or EXTRA
+	BusyTimeout time.Duration // how long a statement waits for a lock held by another process
+	ForeignKeys bool
+	MaxReaders  int // read connections; writes always share one
+}
+
+// DefaultOptions returns the options used unless configured otherwise
+func DefaultOptions() Options {
+	return Options{
+		JournalMode: "WAL",
+		Synchronous: "NORMAL",
+		BusyTimeout: 5 * time.Second,
+		ForeignKeys: true,
+		MaxReaders:  4,
+	}
+}
+
+// NewDB opens the database at dbPath with one write connection and a pool of
+// read connections
+func NewDB(dbPath string, opts Options) (*DB, error) {
+	params := url.Values{}
+	params.Set("_busy_timeout", strconv.FormatInt(opts.BusyTimeout.Milliseconds(), 10))
+	params.Set("_foreign_keys", strconv.FormatBool(opts.ForeignKeys))
+	params.Set("_synchronous", opts.Synchronous)
+
+	// The journal mode is stored in the file, so the writer sets it before
+	// any reader connects. Transactions take the write lock when they begin
+	// so that they never fail to upgrade a read lock later.
+	writerParams := url.Values{"_journal_mode": {opts.JournalMode}, "_txlock": {"immediate"}}
+	for key, values := range params {
+		writerParams[key] = values
+	}
+	writer, err := sql.Open("sqlite3", dbPath+"?"+writerParams.Encode())
 	if err != nil {
 		return nil, fmt.Errorf("error opening database: %v", err)
 	}
+	writer.SetMaxOpenConns(1)
+	if err := writer.Ping(); err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("error opening database: %v", err)
+	}
+
+	db := &DB{DB: writer, readers: writer, foreignKeys: opts.ForeignKeys}
+	if dbPath != ":memory:" && opts.MaxReaders > 0 {
+		params.Set("_query_only", "true")
+		readers, err := sql.Open("sqlite3", dbPath+"?"+params.Encode())
+		if err != nil {
+			writer.Close()
+			return nil, fmt.Errorf("error opening database: %v", err)
+		}
+		readers.SetMaxOpenConns(opts.MaxReaders)
+		readers.SetMaxIdleConns(opts.MaxReaders)
+		db.readers = readers
+	}
+
+	var journalMode string
+	if err := writer.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err == nil {
+		log.Printf("[DB] Opened %s (journal %s, synchronous %s, foreign keys %t, %d readers)",
+			dbPath, journalMode, opts.Synchronous, opts.ForeignKeys, opts.MaxReaders)
+	}
+	return db, nil
+}
 
-	return &DB{db}, nil
+// Close closes every connection to the database
+func (db *DB) Close() error {
+	if db.readers != db.DB {
+		db.readers.Close()
+	}
+	return db.DB.Close()
 }
 
-// InitDB initializes the database connection and creates tables
-func (db *DB) InitDB() error {
-	// Read and execute schema.sql
-	schema, err := os.ReadFile("schema.sql")
+// ForeignKeyViolations counts, per table, the rows that refer to a row that
+// no longer exists, such as those left behind before foreign keys were enforced
+func (db *DB) ForeignKeyViolations() (map[string]int, error) {
+	rows, err := db.readers.Query("PRAGMA foreign_key_check")
 	if err != nil {
-		return fmt.Errorf("error reading schema file: %v", err)
+		return nil, fmt.Errorf("error checking foreign keys: %v", err)
 	}
+	defer rows.Close()
 
-	_, err = db.Exec(string(schema))
-	if err != nil {
-		return fmt.Errorf("error creating schema: %v", err)
+	violations := make(map[string]int)
+	for rows.Next() {
+		var table, parent string
+		var rowID sql.NullInt64
+		var fkID int
+		if err := rows.Scan(&table, &rowID, &parent, &fkID); err != nil {
+			return nil, fmt.Errorf("error scanning foreign key check: %v", err)
+		}
+		violations[table]++
 	}
+	return violations, rows.Err()
+}
 
-	// Create audio_segments table
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS audio_segments (
-			id TEXT PRIMARY KEY,
-			book_id TEXT NOT NULL,
-			segment_number INTEGER NOT NULL,
-			content TEXT NOT NULL,
-			audio_url TEXT,
-			duration REAL,
-			status TEXT NOT NULL,
-			created_at DATETIME NOT NULL,
-			updated_at DATETIME NOT NULL,
-			FOREIGN KEY (book_id) REFERENCES books(id)
-		)
-	`)
+// InitDB brings the database schema up to date by applying any pending
+// migrations. It refuses to touch a database migrated by a newer server.
+func (db *DB) InitDB() error {
+	applied, err := db.MigrateUp(0)
 	if err != nil {
-		return fmt.Errorf("error creating audio_segments table: %v", err)
+		return err
+	}
+	for _, m := range applied {
+		log.Printf("[DB] Applied migration %04d_%s", m.Version, m.Name)
 	}
-
 	return nil
 }
 
-// CleanupDuplicateBooks removes duplicate book entries based on title and author
-func (db *DB) CleanupDuplicateBooks() error {
-	query := `
-		WITH duplicates AS (
-			SELECT title, author, COUNT(*) as count
-			FROM books
-			GROUP BY title, author
-			HAVING count > 1
-		)
-		DELETE FROM books
-		WHERE (title, author) IN (
-			SELECT title, author FROM duplicates
-		)
-		AND id NOT IN (
-			SELECT MIN(id)
-			FROM books
-			GROUP BY title, author
+// addColumnIfMissing adds a column to a table unless it already exists
+func (db *DB) addColumnIfMissing(table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("error reading table info for %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
 		)
-	`
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return fmt.Errorf("error scanning table info for %s: %v", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading table info for %s: %v", table, err)
+	}
+	rows.Close()
 
-	_, err := db.Exec(query)
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
 	if err != nil {
-		return fmt.Errorf("error cleaning up duplicate books: %v", err)
+		return fmt.Errorf("error adding column %s.%s: %v", table, column, err)
 	}
 
 	return nil
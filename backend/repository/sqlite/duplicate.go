@@ -0,0 +1,144 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"backend/domain/models"
+)
+
+// duplicateKeys are the expressions books are grouped by for each duplicate
+// reason, with the condition a book needs to be considered
+var duplicateKeys = []struct {
+	reason    string
+	key       string
+	condition string
+}{
+	{models.DuplicateSameFile, "books.content_hash", "books.content_hash != ''"},
+	{models.DuplicateSameText, "books.text_fingerprint", "books.text_fingerprint != ''"},
+	{models.DuplicateSameTitle, "lower(trim(books.title)) || char(31) || lower(trim(COALESCE(books.author, '')))", "trim(books.title) != ''"},
+}
+
+// FindBookByContentHash returns the user's oldest book whose source file has
+// the given hash, or nil if there is none
+func (db *DB) FindBookByContentHash(userID, hash string) (*models.Book, error) {
+	query := `SELECT ` + bookColumns + `
+		FROM books
+		WHERE COALESCE(books.user_id, '') = ? AND books.content_hash = ?
+		ORDER BY books.created_at, books.id
+		LIMIT 1
+	`
+
+	book := &models.Book{}
+	err := scanBook(db.readers.QueryRow(query, userID, hash), book)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding book by content hash: %v", err)
+	}
+	return book, nil
+}
+
+// GetUnhashedBooks returns the books with a stored file but no content hash,
+// which were added before hashes were recorded
+func (db *DB) GetUnhashedBooks() ([]models.Book, error) {
+	query := `SELECT ` + bookColumns + `
+		FROM books
+		WHERE COALESCE(books.file_key, '') != '' AND books.content_hash = ''
+		ORDER BY books.created_at
+	`
+
+	rows, err := db.readers.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying unhashed books: %v", err)
+	}
+	defer rows.Close()
+
+	var books []models.Book
+	for rows.Next() {
+		var book models.Book
+		if err := scanBook(rows, &book); err != nil {
+			return nil, fmt.Errorf("error scanning book: %v", err)
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
+
+// SetBookContentHash records the hash of a book's source file
+func (db *DB) SetBookContentHash(bookID, hash string) error {
+	_, err := db.Exec("UPDATE books SET content_hash = ? WHERE id = ?", hash, bookID)
+	if err != nil {
+		return fmt.Errorf("error setting content hash: %v", err)
+	}
+	return nil
+}
+
+// DuplicateReport groups each user's books that share a source file, a
+// normalized text or a title and author. Groups whose books all share one
+// source file are only reported as sameFile.
+func (db *DB) DuplicateReport() (*models.DuplicateReport, error) {
+	report := &models.DuplicateReport{Groups: []models.DuplicateGroup{}, GeneratedAt: time.Now()}
+
+	for _, d := range duplicateKeys {
+		having := "COUNT(*) > 1"
+		if d.reason != models.DuplicateSameFile {
+			having += " AND NOT (COUNT(DISTINCT books.content_hash) = 1 AND MIN(books.content_hash) != '')"
+		}
+		query := `SELECT ` + bookColumns + `, ` + d.key + `
+			FROM books
+			WHERE (COALESCE(books.user_id, ''), ` + d.key + `) IN (
+				SELECT COALESCE(books.user_id, ''), ` + d.key + `
+				FROM books
+				WHERE ` + d.condition + `
+				GROUP BY 1, 2
+				HAVING ` + having + `
+			)
+			ORDER BY COALESCE(books.user_id, ''), ` + d.key + `, books.created_at, books.id
+		`
+
+		groups, err := db.queryDuplicateGroups(d.reason, query)
+		if err != nil {
+			return nil, err
+		}
+		report.Groups = append(report.Groups, groups...)
+	}
+
+	err := db.readers.QueryRow(`
+		SELECT COUNT(*) FROM books WHERE COALESCE(file_key, '') != '' AND content_hash = ''
+	`).Scan(&report.UnhashedBooks)
+	if err != nil {
+		return nil, fmt.Errorf("error counting unhashed books: %v", err)
+	}
+	return report, nil
+}
+
+// queryDuplicateGroups collects rows ordered by user and key into groups
+func (db *DB) queryDuplicateGroups(reason, query string) ([]models.DuplicateGroup, error) {
+	rows, err := db.readers.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying %s duplicates: %v", reason, err)
+	}
+	defer rows.Close()
+
+	var groups []models.DuplicateGroup
+	lastKey := ""
+	for rows.Next() {
+		var book models.Book
+		var key string
+		if err := scanBook(rows, &book, &key); err != nil {
+			return nil, fmt.Errorf("error scanning book: %v", err)
+		}
+
+		n := len(groups)
+		if n == 0 || groups[n-1].UserID != book.UserID || key != lastKey {
+			groups = append(groups, models.DuplicateGroup{Reason: reason, UserID: book.UserID})
+			n++
+		}
+		groups[n-1].Books = append(groups[n-1].Books, book)
+		lastKey = key
+	}
+	return groups, rows.Err()
+}
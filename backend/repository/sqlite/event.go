@@ -0,0 +1,62 @@
+package sqlite
+
+import (
+	"fmt"
+
+	"backend/domain/models"
+)
+
+// SaveBookEvent appends an event to a book's event log, assigning its ID, and
+// trims the log to the most recent keep events. A keep of zero or less keeps
+// every event.
+func (db *DB) SaveBookEvent(event *models.BookEvent, keep int) error {
+	result, err := db.Exec(
+		"INSERT INTO book_events (book_id, type, version, payload, created_at) VALUES (?, ?, ?, ?, ?)",
+		event.BookID, event.Type, event.Version, string(event.Payload), event.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving book event: %v", err)
+	}
+
+	event.ID, err = result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error getting book event ID: %v", err)
+	}
+
+	if keep > 0 {
+		_, err = db.Exec(
+			"DELETE FROM book_events WHERE book_id = ? AND id <= (SELECT id FROM book_events WHERE book_id = ? ORDER BY id DESC LIMIT 1 OFFSET ?)",
+			event.BookID, event.BookID, keep,
+		)
+		if err != nil {
+			return fmt.Errorf("error trimming book events: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// GetBookEventsSince returns the events logged for a book after the given ID, oldest first
+func (db *DB) GetBookEventsSince(bookID string, afterID int64) ([]models.BookEvent, error) {
+	rows, err := db.readers.Query(
+		"SELECT id, book_id, type, version, payload, created_at FROM book_events WHERE book_id = ? AND id > ? ORDER BY id",
+		bookID, afterID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting book events: %v", err)
+	}
+	defer rows.Close()
+
+	var events []models.BookEvent
+	for rows.Next() {
+		var event models.BookEvent
+		var payload string
+		if err := rows.Scan(&event.ID, &event.BookID, &event.Type, &event.Version, &payload, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning book event: %v", err)
+		}
+		event.Payload = []byte(payload)
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,46 @@
+package sqlite
+
+import (
+	"fmt"
+)
+
+// fileReferences selects every stored file a book's rows point at: storage
+// keys, the URLs of files written before keys were recorded, and the key its
+// source PDF is downloaded to
+const fileReferences = `
+	SELECT file_key AS ref, id AS book_id FROM books
+	UNION SELECT cover_key, id FROM books
+	UNION SELECT cover_url, id FROM books
+	UNION SELECT 'pdfs/' || id || '.pdf', id FROM books
+	UNION SELECT audio_key, book_id FROM audio_segments
+	UNION SELECT audio_url, book_id FROM audio_segments
+	UNION SELECT key, book_id FROM cover_thumbnails
+`
+
+// GetFileReferences returns every stored file reference in the database
+func (db *DB) GetFileReferences() ([]string, error) {
+	return db.queryFileReferences("SELECT DISTINCT ref FROM ("+fileReferences+") WHERE ref IS NOT NULL AND ref != ''", nil)
+}
+
+// GetBookFileReferences returns the stored file references of a book and its segments
+func (db *DB) GetBookFileReferences(bookID string) ([]string, error) {
+	return db.queryFileReferences("SELECT DISTINCT ref FROM ("+fileReferences+") WHERE book_id = ? AND ref IS NOT NULL AND ref != ''", []interface{}{bookID})
+}
+
+func (db *DB) queryFileReferences(query string, args []interface{}) ([]string, error) {
+	rows, err := db.readers.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting file references: %v", err)
+	}
+	defer rows.Close()
+
+	var refs []string
+	for rows.Next() {
+		var ref string
+		if err := rows.Scan(&ref); err != nil {
+			return nil, fmt.Errorf("error scanning file reference: %v", err)
+		}
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
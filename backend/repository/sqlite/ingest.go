@@ -0,0 +1,103 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/domain/models"
+)
+
+// segmentBatchSize is how many segments one INSERT writes. It keeps a batch
+// under SQLite's default limit of 999 bound variables.
+const segmentBatchSize = 50
+
+// IngestBook records what processing learned about a book and replaces its
+// segments with segments in one transaction, so a book is never left with
+// only some of its pages. Only the page count and text fingerprint are
+// written, along with the author and language where they are still empty,
+// so metadata edited while the book was processed is kept. Segments are
+// written in batches through prepared statements.
+func (db *DB) IngestBook(book *models.Book, segments []models.AudioSegment) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow("SELECT 1 FROM books WHERE id = ?", book.ID).Scan(&exists); err != nil {
+		return fmt.Errorf("error ingesting book: %w", err)
+	}
+	_, err = tx.Exec(`
+		UPDATE books
+		SET page_count = ?, text_fingerprint = ?,
+			author = CASE WHEN author = '' THEN ? ELSE author END,
+			language = CASE WHEN language = '' THEN ? ELSE language END,
+			updated_at = ?
+		WHERE id = ?`,
+		book.PageCount, book.TextFingerprint, book.Author, book.Language, time.Now(), book.ID)
+	if err != nil {
+		return fmt.Errorf("error updating book: %v", err)
+	}
+
+	queries := []string{
+		"DELETE FROM segment_revisions WHERE segment_id IN (SELECT id FROM audio_segments WHERE book_id = ?)",
+		"DELETE FROM audio_segments WHERE book_id = ?",
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, book.ID); err != nil {
+			return fmt.Errorf("error clearing segments: %v", err)
+		}
+	}
+
+	if err := insertSegments(tx, segments); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// insertSegments writes segments in full batches through one prepared
+// statement, and the remainder through a second one
+func insertSegments(tx *sql.Tx, segments []models.AudioSegment) error {
+	var full *sql.Stmt
+	for start := 0; start < len(segments); start += segmentBatchSize {
+		batch := segments[start:min(start+segmentBatchSize, len(segments))]
+
+		stmt := full
+		if stmt == nil || len(batch) < segmentBatchSize {
+			prepared, err := tx.Prepare(insertSegmentsQuery(len(batch)))
+			if err != nil {
+				return fmt.Errorf("error preparing segment insert: %v", err)
+			}
+			defer prepared.Close()
+			stmt = prepared
+			if len(batch) == segmentBatchSize {
+				full = prepared
+			}
+		}
+
+		args := make([]interface{}, 0, len(batch)*strings.Count(audioSegmentPlaceholders, "?"))
+		for i := range batch {
+			args = append(args, audioSegmentValues(&batch[i])...)
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			return fmt.Errorf("error saving segments %d-%d: %v", batch[0].SegmentNumber, batch[len(batch)-1].SegmentNumber, err)
+		}
+	}
+	return nil
+}
+
+// insertSegmentsQuery returns an INSERT of n segments
+func insertSegmentsQuery(n int) string {
+	rows := make([]string, n)
+	for i := range rows {
+		rows[i] = audioSegmentPlaceholders
+	}
+	return `INSERT INTO audio_segments (` + audioSegmentInsertColumns + `) VALUES ` + strings.Join(rows, ", ")
+}
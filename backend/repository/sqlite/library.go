@@ -0,0 +1,169 @@
+package sqlite
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"backend/domain/models"
+	"backend/repository"
+)
+
+// ErrInvalidCursor is returned for a cursor that was not produced by ListBooks
+// with the same sort order
+var ErrInvalidCursor = repository.ErrInvalidCursor
+
+// bookSortKeys are the expressions each library sort order compares. Ties
+// are broken by book ID so every book has a unique position.
+var bookSortKeys = map[string]string{
+	models.BookSortTitle:    "books.title COLLATE NOCASE",
+	models.BookSortAuthor:   "COALESCE(books.author, '') COLLATE NOCASE",
+	models.BookSortAdded:    "CAST(books.created_at AS TEXT)",
+	models.BookSortLastRead: "COALESCE(CAST(rp.last_read_at AS TEXT), '')",
+}
+
+// Reading state conditions over the user's progress row, which may be missing
+const (
+	progressStarted  = "(COALESCE(rp.current_page, 0) > 0 OR COALESCE(rp.completion_percent, 0) > 0)"
+	progressFinished = "(COALESCE(rp.completion_percent, 0) >= 100 OR (rp.total_pages > 0 AND rp.current_page >= rp.total_pages))"
+)
+
+// bookCursor is the position after which the next page starts
+type bookCursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	ID   string `json:"id"`
+}
+
+// ListBooks returns the books matching filter in its sort order, and the
+// cursor of the next page, which is empty on the last page
+func (db *DB) ListBooks(filter models.BookFilter) ([]models.Book, string, error) {
+	sortKey, ok := bookSortKeys[filter.Sort]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown sort order %q", filter.Sort)
+	}
+
+	var where []string
+	args := []interface{}{filter.UserID}
+
+	if len(filter.Statuses) > 0 {
+		where = append(where, "books.status IN ("+placeholders(len(filter.Statuses))+")")
+		args = appendStrings(args, filter.Statuses)
+	}
+	if len(filter.Languages) > 0 {
+		where = append(where, "books.language IN ("+placeholders(len(filter.Languages))+")")
+		args = appendStrings(args, filter.Languages)
+	}
+	if filter.Author != "" {
+		where = append(where, `books.author LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(filter.Author)+"%")
+	}
+	for _, category := range filter.Categories {
+		where = append(where, `EXISTS (
+			SELECT 1 FROM book_categories bc JOIN categories c ON c.id = bc.category_id
+			WHERE bc.book_id = books.id AND (c.id = ? OR c.name = ? COLLATE NOCASE)
+		)`)
+		args = append(args, category, category)
+	}
+	for _, tag := range filter.Tags {
+		where = append(where, `EXISTS (
+			SELECT 1 FROM book_tags bt JOIN tags t ON t.id = bt.tag_id
+			WHERE bt.book_id = books.id AND (t.id = ? OR t.name = ? COLLATE NOCASE)
+		)`)
+		args = append(args, tag, tag)
+	}
+	switch filter.ReadingState {
+	case "":
+	case models.ReadingStateUnread:
+		where = append(where, "NOT "+progressStarted)
+	case models.ReadingStateReading:
+		where = append(where, progressStarted+" AND NOT "+progressFinished)
+	case models.ReadingStateFinished:
+		where = append(where, progressFinished)
+	default:
+		return nil, "", fmt.Errorf("unknown reading state %q", filter.ReadingState)
+	}
+
+	direction, after := "ASC", ">"
+	if filter.Descending {
+		direction, after = "DESC", "<"
+	}
+	if filter.Cursor != "" {
+		cursor, err := decodeBookCursor(filter.Cursor)
+		if err != nil || cursor.Sort != filter.Sort {
+			return nil, "", ErrInvalidCursor
+		}
+		where = append(where, fmt.Sprintf("(%s, books.id) %s (?, ?)", sortKey, after))
+		args = append(args, cursor.Key, cursor.ID)
+	}
+
+	query := `SELECT ` + bookColumns + `, ` + sortKey + `
+		FROM books
+		LEFT JOIN reading_progress rp ON rp.book_id = books.id AND rp.user_id = ?`
+	if len(where) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(where, "\n\t\t\tAND ")
+	}
+	query += fmt.Sprintf("\n\t\tORDER BY %s %s, books.id %s", sortKey, direction, direction)
+	if filter.Limit > 0 {
+		// One extra row tells whether there is a next page
+		query += "\n\t\tLIMIT ?"
+		args = append(args, filter.Limit+1)
+	}
+
+	rows, err := db.readers.Query(query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("error querying books: %v", err)
+	}
+	defer rows.Close()
+
+	books := []models.Book{}
+	var keys []string
+	for rows.Next() {
+		var book models.Book
+		var key string
+		if err := scanBook(rows, &book, &key); err != nil {
+			return nil, "", fmt.Errorf("error scanning book: %v", err)
+		}
+		books = append(books, book)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("error querying books: %v", err)
+	}
+
+	next := ""
+	if filter.Limit > 0 && len(books) > filter.Limit {
+		books = books[:filter.Limit]
+		last := filter.Limit - 1
+		next = encodeBookCursor(bookCursor{Sort: filter.Sort, Key: keys[last], ID: books[last].ID})
+	}
+	return books, next, nil
+}
+
+func encodeBookCursor(cursor bookCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeBookCursor(s string) (bookCursor, error) {
+	var cursor bookCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
+
+// placeholders returns n comma-separated query placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func appendStrings(args []interface{}, values []string) []interface{} {
+	for _, v := range values {
+		args = append(args, v)
+	}
+	return args
+}
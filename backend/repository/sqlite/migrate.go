@@ -0,0 +1,388 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationName matches files named <version>_<name>.<up|down>.sql
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer
+// version of the server than this one
+var ErrSchemaTooNew = errors.New("database schema is newer than this server supports")
+
+// Migration is a numbered schema change with the SQL that applies and reverts it
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Up      string `json:"-"`
+	Down    string `json:"-"`
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+}
+
+// Migrations returns the embedded migrations in version order
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %v", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("error reading migrations: unexpected file %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		data, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %v", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("error reading migrations: version %d is used by %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("error reading migrations: %04d_%s has no up migration", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// LatestVersion returns the version of the newest embedded migration
+func LatestVersion() (int, error) {
+	migrations, err := Migrations()
+	if err != nil || len(migrations) == 0 {
+		return 0, err
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// SchemaVersion returns the version of the newest migration applied to the database
+func (db *DB) SchemaVersion() (int, error) {
+	if err := db.ensureMigrationsTable(); err != nil {
+		return 0, err
+	}
+
+	var version int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("error reading schema version: %v", err)
+	}
+	return version, nil
+}
+
+// CheckSchema returns ErrSchemaTooNew if the database has migrations this
+// server does not know about, and an error if migrations are pending
+func (db *DB) CheckSchema() error {
+	version, latest, err := db.versions()
+	if err != nil {
+		return err
+	}
+	if version > latest {
+		return fmt.Errorf("%w: database is at version %d, latest known is %d", ErrSchemaTooNew, version, latest)
+	}
+	if version < latest {
+		return fmt.Errorf("database schema is at version %d, run migrate up to reach version %d", version, latest)
+	}
+	return nil
+}
+
+// MigrationStatus lists every known migration and whether it has been applied
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		statuses[i] = MigrationStatus{Migration: m}
+		if at, ok := applied[m.Version]; ok {
+			at := at
+			statuses[i].Applied = true
+			statuses[i].AppliedAt = &at
+		}
+	}
+	return statuses, nil
+}
+
+// MigrateUp applies pending migrations up to and including target, or all
+// of them when target is 0, and returns the migrations it applied
+func (db *DB) MigrateUp(target int) ([]Migration, error) {
+	version, latest, err := db.versions()
+	if err != nil {
+		return nil, err
+	}
+	if version > latest {
+		return nil, fmt.Errorf("%w: database is at version %d, latest known is %d", ErrSchemaTooNew, version, latest)
+	}
+
+	if version == 0 {
+		if err := db.adoptLegacySchema(); err != nil {
+			return nil, err
+		}
+	}
+
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if target > 0 && m.Version > target {
+			break
+		}
+		if err := db.applyMigration(m, m.Up, true); err != nil {
+			return ran, err
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// MigrateDown reverts the given number of most recently applied migrations
+// and returns the migrations it reverted
+func (db *DB) MigrateDown(steps int) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return reverted, fmt.Errorf("error reverting migration %04d_%s: no down migration", m.Version, m.Name)
+		}
+		if err := db.applyMigration(m, m.Down, false); err != nil {
+			return reverted, err
+		}
+		reverted = append(reverted, m)
+	}
+	return reverted, nil
+}
+
+// applyMigration runs one direction of a migration and records the result
+// in the same transaction
+func (db *DB) applyMigration(m Migration, script string, up bool) error {
+	direction := "applying"
+	if !up {
+		direction = "reverting"
+	}
+
+	// Foreign keys cannot be switched off inside a transaction, and tables a
+	// migration rebuilds would otherwise cascade their deletes
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting connection: %v", err)
+	}
+	defer conn.Close()
+	if db.foreignKeys {
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			return fmt.Errorf("error disabling foreign keys: %v", err)
+		}
+		defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(script); err != nil {
+		return fmt.Errorf("error %s migration %04d_%s: %v", direction, m.Version, m.Name, err)
+	}
+	if up {
+		_, err = tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.Version, m.Name, time.Now())
+	} else {
+		_, err = tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("error recording migration %04d_%s: %v", m.Version, m.Name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// versions returns the database's schema version and the latest known one
+func (db *DB) versions() (int, int, error) {
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return 0, 0, err
+	}
+	latest, err := LatestVersion()
+	if err != nil {
+		return 0, 0, err
+	}
+	return version, latest, nil
+}
+
+func (db *DB) ensureMigrationsTable() error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %v", err)
+	}
+	return nil
+}
+
+// appliedMigrations returns the applied migration versions with the time they were applied
+func (db *DB) appliedMigrations() (map[int]time.Time, error) {
+	if err := db.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("error querying schema migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("error scanning schema migration: %v", err)
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// adoptLegacySchema brings a database created before migrations existed up
+// to the initial migration, adding the columns that used to be added on
+// startup, and records that migration as applied. Empty databases are left
+// for the initial migration to create.
+func (db *DB) adoptLegacySchema() error {
+	var name string
+	err := db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'books'").Scan(&name)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error inspecting database: %v", err)
+	}
+
+	// The initial migration only creates what is missing, so it completes
+	// the legacy schema in place
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	initial := migrations[0]
+	if _, err := db.Exec(initial.Up); err != nil {
+		return fmt.Errorf("error applying migration %04d_%s: %v", initial.Version, initial.Name, err)
+	}
+
+	columns := []struct {
+		table      string
+		name       string
+		definition string
+	}{
+		{"audio_segments", "segment_number", "INTEGER NOT NULL DEFAULT 0"},
+		{"audio_segments", "duration", "REAL DEFAULT 0"},
+		{"audio_segments", "container", "TEXT DEFAULT ''"},
+		{"audio_segments", "codec", "TEXT DEFAULT ''"},
+		{"audio_segments", "mime_type", "TEXT DEFAULT ''"},
+		{"audio_segments", "page_number", "INTEGER DEFAULT 0"},
+		{"audio_segments", "skip", "INTEGER NOT NULL DEFAULT 0"},
+		{"audio_segments", "last_error", "TEXT DEFAULT ''"},
+		{"audio_segments", "audio_key", "TEXT DEFAULT ''"},
+		{"audio_segments", "audio_size", "INTEGER DEFAULT 0"},
+		{"books", "file_key", "TEXT DEFAULT ''"},
+		{"books", "cover_key", "TEXT DEFAULT ''"},
+		{"books", "user_id", "TEXT DEFAULT ''"},
+		{"books", "file_size", "INTEGER DEFAULT 0"},
+	}
+	for _, c := range columns {
+		if err := db.addColumnIfMissing(c.table, c.name, c.definition); err != nil {
+			return err
+		}
+	}
+
+	// Derive storage keys for files written before keys were recorded
+	backfill := []string{
+		`UPDATE audio_segments SET audio_key = substr(audio_url, 2)
+			WHERE COALESCE(audio_key, '') = '' AND audio_url LIKE '/audio/%'`,
+		`UPDATE audio_segments SET audio_key = audio_url
+			WHERE COALESCE(audio_key, '') = '' AND audio_url LIKE 'audio/%'`,
+		`UPDATE books SET cover_key = substr(cover_url, 2)
+			WHERE COALESCE(cover_key, '') = '' AND cover_url LIKE '/covers/%'`,
+	}
+	for _, query := range backfill {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("error backfilling storage keys: %v", err)
+		}
+	}
+
+	_, err = db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", initial.Version, initial.Name, time.Now())
+	if err != nil {
+		return fmt.Errorf("error recording migration %04d_%s: %v", initial.Version, initial.Name, err)
+	}
+	log.Printf("[DB] Recorded existing schema as migration %04d_%s", initial.Version, initial.Name)
+	return nil
+}
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS bookmarks;
+DROP TABLE IF EXISTS reading_progress;
+DROP TABLE IF EXISTS user_quotas;
+DROP TABLE IF EXISTS synthesis_usage;
+DROP TABLE IF EXISTS cover_thumbnails;
+DROP TABLE IF EXISTS book_stages;
+DROP TABLE IF EXISTS book_events;
+DROP TABLE IF EXISTS segment_revisions;
+DROP TABLE IF EXISTS audio_segments;
+DROP TABLE IF EXISTS book_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS book_categories;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS books;
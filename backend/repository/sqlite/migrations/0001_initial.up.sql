@@ -0,0 +1,167 @@
+-- Books table with enhanced metadata
+CREATE TABLE IF NOT EXISTS books (
+    id TEXT PRIMARY KEY,
+    title TEXT NOT NULL,
+    author TEXT,
+    cover_url TEXT,
+    file_url TEXT NOT NULL,
+    file_key TEXT DEFAULT '',
+    cover_key TEXT DEFAULT '',
+    user_id TEXT DEFAULT '',
+    file_size INTEGER DEFAULT 0,
+    page_count INTEGER DEFAULT 0,
+    current_page INTEGER DEFAULT 0,
+    language TEXT DEFAULT 'en',
+    status TEXT NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Categories for organizing books
+CREATE TABLE IF NOT EXISTS categories (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Book-Category relationship (many-to-many)
+CREATE TABLE IF NOT EXISTS book_categories (
+    book_id TEXT,
+    category_id TEXT,
+    PRIMARY KEY (book_id, category_id),
+    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
+
+-- Tags for flexible book organization
+CREATE TABLE IF NOT EXISTS tags (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Book-Tag relationship (many-to-many)
+CREATE TABLE IF NOT EXISTS book_tags (
+    book_id TEXT,
+    tag_id TEXT,
+    PRIMARY KEY (book_id, tag_id),
+    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+    FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+-- Audio synthesis tracking
+CREATE TABLE IF NOT EXISTS audio_segments (
+    id TEXT PRIMARY KEY,
+    book_id TEXT NOT NULL,
+    segment_number INTEGER NOT NULL DEFAULT 0,
+    page_number INTEGER DEFAULT 0,
+    content TEXT NOT NULL,
+    audio_url TEXT,
+    audio_key TEXT DEFAULT '',
+    audio_size INTEGER DEFAULT 0,
+    container TEXT DEFAULT '',
+    codec TEXT DEFAULT '',
+    mime_type TEXT DEFAULT '',
+    duration REAL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'pending',
+    last_error TEXT DEFAULT '',
+    skip INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+);
+
+-- Text revision history for audio segments
+CREATE TABLE IF NOT EXISTS segment_revisions (
+    id TEXT PRIMARY KEY,
+    segment_id TEXT NOT NULL,
+    revision INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    source TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (segment_id) REFERENCES audio_segments(id) ON DELETE CASCADE,
+    UNIQUE(segment_id, revision)
+);
+
+-- Recent processing events per book, replayed to reconnecting clients
+CREATE TABLE IF NOT EXISTS book_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    book_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    payload TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+);
+
+-- Processing stages each book went through, for status timelines
+CREATE TABLE IF NOT EXISTS book_stages (
+    id TEXT PRIMARY KEY,
+    book_id TEXT NOT NULL,
+    stage TEXT NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP,
+    error TEXT DEFAULT '',
+    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+);
+
+-- Resized copies of book covers
+CREATE TABLE IF NOT EXISTS cover_thumbnails (
+    book_id TEXT NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    key TEXT NOT NULL,
+    PRIMARY KEY (book_id, width),
+    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+);
+
+-- Characters sent for synthesis, for monthly quotas
+CREATE TABLE IF NOT EXISTS synthesis_usage (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL DEFAULT '',
+    book_id TEXT NOT NULL DEFAULT '',
+    segment_id TEXT NOT NULL DEFAULT '',
+    characters INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Per-user quota overrides; NULL limits fall back to the configured defaults
+CREATE TABLE IF NOT EXISTS user_quotas (
+    user_id TEXT PRIMARY KEY,
+    storage_bytes INTEGER,
+    books INTEGER,
+    monthly_characters INTEGER,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Reading progress tracking
+CREATE TABLE IF NOT EXISTS reading_progress (
+    id TEXT PRIMARY KEY,
+    book_id TEXT NOT NULL,
+    current_page INTEGER DEFAULT 0,
+    completion_percentage FLOAT DEFAULT 0,
+    last_read_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+    UNIQUE(book_id)
+);
+
+-- Bookmarks
+CREATE TABLE IF NOT EXISTS bookmarks (
+    id TEXT PRIMARY KEY,
+    book_id TEXT NOT NULL,
+    page_number INTEGER NOT NULL,
+    note TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+);
+
+-- Create indexes for better query performance
+CREATE INDEX IF NOT EXISTS idx_books_title ON books(title);
+CREATE INDEX IF NOT EXISTS idx_reading_progress_book ON reading_progress(book_id);
+CREATE INDEX IF NOT EXISTS idx_audio_segments_book_id ON audio_segments(book_id);
+CREATE INDEX IF NOT EXISTS idx_bookmarks_book ON bookmarks(book_id);
+CREATE INDEX IF NOT EXISTS idx_segment_revisions_segment ON segment_revisions(segment_id);
+CREATE INDEX IF NOT EXISTS idx_book_events_book ON book_events(book_id, id);
+CREATE INDEX IF NOT EXISTS idx_book_stages_book ON book_stages(book_id, started_at);
+CREATE INDEX IF NOT EXISTS idx_synthesis_usage_user ON synthesis_usage(user_id, created_at);
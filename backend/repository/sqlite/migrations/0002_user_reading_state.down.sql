@@ -0,0 +1,28 @@
+DROP INDEX IF EXISTS idx_bookmarks_user;
+ALTER TABLE bookmarks DROP COLUMN updated_at;
+ALTER TABLE bookmarks DROP COLUMN user_id;
+
+CREATE TABLE reading_progress_old (
+    id TEXT PRIMARY KEY,
+    book_id TEXT NOT NULL,
+    current_page INTEGER DEFAULT 0,
+    completion_percentage FLOAT DEFAULT 0,
+    last_read_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+    UNIQUE(book_id)
+);
+
+-- Only one user's progress per book fits the old table; keep the latest
+INSERT INTO reading_progress_old (id, book_id, current_page, completion_percentage, last_read_at)
+SELECT id, book_id, current_page, completion_percent, last_read_at FROM reading_progress
+WHERE id IN (
+    SELECT id FROM reading_progress p
+    WHERE last_read_at = (SELECT MAX(last_read_at) FROM reading_progress WHERE book_id = p.book_id)
+    GROUP BY book_id
+);
+
+DROP TABLE reading_progress;
+ALTER TABLE reading_progress_old RENAME TO reading_progress;
+CREATE INDEX IF NOT EXISTS idx_reading_progress_book ON reading_progress(book_id);
+
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,35 @@
+-- Accounts referenced by reading progress and bookmarks
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT PRIMARY KEY,
+    username TEXT NOT NULL UNIQUE,
+    email TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Reading progress is kept per user, so the table is rebuilt to change its key
+CREATE TABLE reading_progress_new (
+    id TEXT PRIMARY KEY,
+    book_id TEXT NOT NULL,
+    user_id TEXT NOT NULL DEFAULT '',
+    current_page INTEGER DEFAULT 0,
+    total_pages INTEGER DEFAULT 0,
+    completion_percent FLOAT DEFAULT 0,
+    last_read_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+    UNIQUE(book_id, user_id)
+);
+
+INSERT INTO reading_progress_new (id, book_id, current_page, completion_percent, last_read_at)
+SELECT id, book_id, current_page, completion_percentage, last_read_at FROM reading_progress;
+
+DROP TABLE reading_progress;
+ALTER TABLE reading_progress_new RENAME TO reading_progress;
+CREATE INDEX IF NOT EXISTS idx_reading_progress_book ON reading_progress(book_id);
+
+-- Bookmarks belong to a user and record when they were last edited
+ALTER TABLE bookmarks ADD COLUMN user_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE bookmarks ADD COLUMN updated_at TIMESTAMP;
+UPDATE bookmarks SET updated_at = created_at;
+CREATE INDEX IF NOT EXISTS idx_bookmarks_user ON bookmarks(book_id, user_id);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_reading_progress_user;
+DROP INDEX IF EXISTS idx_book_tags_tag;
+DROP INDEX IF EXISTS idx_book_categories_category;
+DROP INDEX IF EXISTS idx_books_status;
+DROP INDEX IF EXISTS idx_books_created_at;
+DROP INDEX IF EXISTS idx_books_author_nocase;
+DROP INDEX IF EXISTS idx_books_title_nocase;
@@ -0,0 +1,8 @@
+-- Indexes for filtering and sorting the library
+CREATE INDEX IF NOT EXISTS idx_books_title_nocase ON books(title COLLATE NOCASE, id);
+CREATE INDEX IF NOT EXISTS idx_books_author_nocase ON books(author COLLATE NOCASE, id);
+CREATE INDEX IF NOT EXISTS idx_books_created_at ON books(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_books_status ON books(status);
+CREATE INDEX IF NOT EXISTS idx_book_categories_category ON book_categories(category_id);
+CREATE INDEX IF NOT EXISTS idx_book_tags_tag ON book_tags(tag_id);
+CREATE INDEX IF NOT EXISTS idx_reading_progress_user ON reading_progress(user_id, book_id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_books_isbn;
+ALTER TABLE books DROP COLUMN isbn;
+ALTER TABLE books DROP COLUMN series;
+ALTER TABLE books DROP COLUMN description;
@@ -0,0 +1,6 @@
+-- Editable book metadata
+ALTER TABLE books ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE books ADD COLUMN series TEXT NOT NULL DEFAULT '';
+ALTER TABLE books ADD COLUMN isbn TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_books_isbn ON books(isbn) WHERE isbn != '';
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_books_text_fingerprint;
+DROP INDEX IF EXISTS idx_books_content_hash;
+ALTER TABLE books DROP COLUMN text_fingerprint;
+ALTER TABLE books DROP COLUMN content_hash;
@@ -0,0 +1,7 @@
+-- Fingerprints for detecting duplicate books: the SHA-256 of the source file
+-- and of its normalized text
+ALTER TABLE books ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE books ADD COLUMN text_fingerprint TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_books_content_hash ON books(user_id, content_hash) WHERE content_hash != '';
+CREATE INDEX IF NOT EXISTS idx_books_text_fingerprint ON books(user_id, text_fingerprint) WHERE text_fingerprint != '';
@@ -0,0 +1,2 @@
+ALTER TABLE cover_thumbnails DROP COLUMN size;
+ALTER TABLE books DROP COLUMN cover_size;
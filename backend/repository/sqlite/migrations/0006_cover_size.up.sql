@@ -0,0 +1,3 @@
+-- Bytes stored for covers and their thumbnails, counted against storage quotas
+ALTER TABLE books ADD COLUMN cover_size INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE cover_thumbnails ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,14 @@
+-- The full-text index refers to the columns, and is recreated on startup
+DROP TRIGGER IF EXISTS book_search_insert;
+DROP TRIGGER IF EXISTS book_search_delete;
+DROP TRIGGER IF EXISTS book_search_update;
+DROP TRIGGER IF EXISTS segment_search_insert;
+DROP TRIGGER IF EXISTS segment_search_delete;
+DROP TRIGGER IF EXISTS segment_search_update;
+DROP TABLE IF EXISTS book_search;
+DROP TABLE IF EXISTS segment_search;
+
+DROP INDEX idx_audio_segments_search_rowid;
+ALTER TABLE audio_segments DROP COLUMN search_rowid;
+DROP INDEX idx_books_search_rowid;
+ALTER TABLE books DROP COLUMN search_rowid;
@@ -0,0 +1,9 @@
+-- Stable row numbers for the full-text index. Implicit rowids of tables with
+-- TEXT primary keys may be renumbered by VACUUM; these never change.
+ALTER TABLE books ADD COLUMN search_rowid INTEGER;
+UPDATE books SET search_rowid = rowid;
+CREATE UNIQUE INDEX idx_books_search_rowid ON books(search_rowid);
+
+ALTER TABLE audio_segments ADD COLUMN search_rowid INTEGER;
+UPDATE audio_segments SET search_rowid = rowid;
+CREATE UNIQUE INDEX idx_audio_segments_search_rowid ON audio_segments(search_rowid);
@@ -42,7 +42,7 @@ func (db *DB) GetReadingProgress(bookID, userID string) (*models.ReadingProgress
 	`
 
 	progress := &models.ReadingProgress{}
-	err := db.QueryRow(query, bookID, userID).Scan(
+	err := db.readers.QueryRow(query, bookID, userID).Scan(
 		&progress.ID,
 		&progress.BookID,
 		&progress.UserID,
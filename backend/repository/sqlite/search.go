@@ -0,0 +1,339 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"backend/domain/models"
+)
+
+// Search engines reported with results
+const (
+	SearchEngineFTS5 = "fts5"
+	SearchEngineLike = "like"
+)
+
+// searchObject is a schema object of the full-text index
+type searchObject struct {
+	name string
+	sql  string
+}
+
+// searchIndex is created at runtime rather than by a migration, since FTS5 is
+// only compiled into SQLite with the sqlite_fts5 build tag. The tables use
+// the rows they index as external content, and triggers keep them in sync.
+// Rows are matched on search_rowid rather than the implicit rowid, which
+// VACUUM may renumber; the insert triggers number new rows. Objects whose
+// definition changes are recreated and the index rebuilt.
+var searchIndex = []searchObject{
+	{"book_search", `CREATE VIRTUAL TABLE book_search USING fts5(
+		title, author, content='books', content_rowid='search_rowid', tokenize='unicode61 remove_diacritics 2'
+	)`},
+	{"book_search_insert", `CREATE TRIGGER book_search_insert AFTER INSERT ON books BEGIN
+		UPDATE books SET search_rowid = (SELECT COALESCE(MAX(search_rowid), 0) + 1 FROM books) WHERE id = new.id;
+		INSERT INTO book_search (rowid, title, author) SELECT search_rowid, title, author FROM books WHERE id = new.id;
+	END`},
+	{"book_search_delete", `CREATE TRIGGER book_search_delete AFTER DELETE ON books BEGIN
+		INSERT INTO book_search (book_search, rowid, title, author) VALUES ('delete', old.search_rowid, old.title, old.author);
+	END`},
+	{"book_search_update", `CREATE TRIGGER book_search_update AFTER UPDATE OF title, author ON books BEGIN
+		INSERT INTO book_search (book_search, rowid, title, author) VALUES ('delete', old.search_rowid, old.title, old.author);
+		INSERT INTO book_search (rowid, title, author) VALUES (new.search_rowid, new.title, new.author);
+	END`},
+	{"segment_search", `CREATE VIRTUAL TABLE segment_search USING fts5(
+		content, content='audio_segments', content_rowid='search_rowid', tokenize='unicode61 remove_diacritics 2'
+	)`},
+	{"segment_search_insert", `CREATE TRIGGER segment_search_insert AFTER INSERT ON audio_segments BEGIN
+		UPDATE audio_segments SET search_rowid = (SELECT COALESCE(MAX(search_rowid), 0) + 1 FROM audio_segments) WHERE id = new.id;
+		INSERT INTO segment_search (rowid, content) SELECT search_rowid, content FROM audio_segments WHERE id = new.id;
+	END`},
+	{"segment_search_delete", `CREATE TRIGGER segment_search_delete AFTER DELETE ON audio_segments BEGIN
+		INSERT INTO segment_search (segment_search, rowid, content) VALUES ('delete', old.search_rowid, old.content);
+	END`},
+	{"segment_search_update", `CREATE TRIGGER segment_search_update AFTER UPDATE OF content ON audio_segments BEGIN
+		INSERT INTO segment_search (segment_search, rowid, content) VALUES ('delete', old.search_rowid, old.content);
+		INSERT INTO segment_search (rowid, content) VALUES (new.search_rowid, new.content);
+	END`},
+}
+
+// searchTables are the FTS5 tables in searchIndex
+var searchTables = []string{"book_search", "segment_search"}
+
+// InitSearch creates or repairs the full-text index when SQLite supports
+// FTS5. Without it, the index triggers are removed so writes keep working
+// and searches fall back to LIKE queries.
+func (db *DB) InitSearch() error {
+	if _, err := db.Exec("CREATE VIRTUAL TABLE temp.fts5_probe USING fts5(x)"); err != nil {
+		db.fts = false
+		for _, obj := range searchIndex {
+			if strings.HasPrefix(obj.sql, "CREATE TRIGGER") {
+				if _, err := db.Exec("DROP TRIGGER IF EXISTS " + obj.name); err != nil {
+					return fmt.Errorf("error dropping search trigger %s: %v", obj.name, err)
+				}
+			}
+		}
+		log.Printf("[Search] FTS5 is not available, searching with LIKE queries")
+		return nil
+	}
+	if _, err := db.Exec("DROP TABLE temp.fts5_probe"); err != nil {
+		return fmt.Errorf("error dropping FTS5 probe: %v", err)
+	}
+
+	// Any missing or changed object means writes may have been missed
+	rebuild := false
+	for _, obj := range searchIndex {
+		var current string
+		err := db.QueryRow("SELECT sql FROM sqlite_master WHERE name = ?", obj.name).Scan(&current)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("error inspecting search index: %v", err)
+		}
+		if current == obj.sql {
+			continue
+		}
+
+		if current != "" {
+			kind := "TRIGGER"
+			if strings.HasPrefix(obj.sql, "CREATE VIRTUAL TABLE") {
+				kind = "TABLE"
+			}
+			if _, err := db.Exec(fmt.Sprintf("DROP %s %s", kind, obj.name)); err != nil {
+				return fmt.Errorf("error dropping %s: %v", obj.name, err)
+			}
+		}
+		if _, err := db.Exec(obj.sql); err != nil {
+			return fmt.Errorf("error creating %s: %v", obj.name, err)
+		}
+		rebuild = true
+	}
+
+	if rebuild {
+		// Rows inserted while the triggers were missing have no number yet
+		for _, table := range []string{"books", "audio_segments"} {
+			query := fmt.Sprintf("UPDATE %s SET search_rowid = (SELECT COALESCE(MAX(search_rowid), 0) FROM %s) + rowid WHERE search_rowid IS NULL", table, table)
+			if _, err := db.Exec(query); err != nil {
+				return fmt.Errorf("error numbering %s for search: %v", table, err)
+			}
+		}
+		for _, table := range searchTables {
+			if _, err := db.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES ('rebuild')", table, table)); err != nil {
+				return fmt.Errorf("error rebuilding %s: %v", table, err)
+			}
+		}
+		log.Printf("[Search] Rebuilt full-text index")
+	}
+
+	db.fts = true
+	return nil
+}
+
+// Search returns the books whose title or author and the segments whose
+// text match every term of query, limited to one book if bookID is set
+func (db *DB) Search(query, bookID string, limit, offset int) (*models.SearchResults, error) {
+	results := &models.SearchResults{
+		Query:    query,
+		Engine:   SearchEngineLike,
+		Books:    []models.BookHit{},
+		Segments: []models.SegmentHit{},
+	}
+	if db.fts {
+		results.Engine = SearchEngineFTS5
+	}
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return results, nil
+	}
+
+	var err error
+	if db.fts {
+		err = db.searchFTS(results, matchExpression(terms), bookID, limit, offset)
+	} else {
+		err = db.searchLike(results, terms, bookID, limit, offset)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// segmentAudioOffset selects the start of segment s in its book's playlist,
+// which lists every segment with audio in order, or NULL if s has no audio
+const segmentAudioOffset = `
+	CASE WHEN COALESCE(s.audio_url, '') != '' AND s.skip = 0 THEN (
+		SELECT COALESCE(SUM(p.duration), 0) FROM audio_segments p
+		WHERE p.book_id = s.book_id AND p.segment_number < s.segment_number
+			AND p.skip = 0 AND COALESCE(p.audio_url, '') != '' AND p.duration > 0
+	) END
+`
+
+func (db *DB) searchFTS(results *models.SearchResults, match, bookID string, limit, offset int) error {
+	bookQuery := `SELECT ` + bookColumns + `, hits.title_highlight, hits.author_highlight
+		FROM books
+		JOIN (
+			SELECT rowid AS hit_rowid, rank AS hit_rank,
+				highlight(book_search, 0, '<mark>', '</mark>') AS title_highlight,
+				COALESCE(highlight(book_search, 1, '<mark>', '</mark>'), '') AS author_highlight
+			FROM book_search
+			WHERE book_search MATCH ?
+		) hits ON books.search_rowid = hits.hit_rowid
+		WHERE ? = '' OR books.id = ?
+		ORDER BY hits.hit_rank
+		LIMIT ? OFFSET ?
+	`
+	if err := db.queryBookHits(results, bookQuery, match, bookID, bookID, limit, offset); err != nil {
+		return err
+	}
+
+	segmentQuery := `
+		SELECT s.id, s.book_id, b.title, s.segment_number, s.page_number,
+			snippet(segment_search, 0, '<mark>', '</mark>', '…', 16), ` + segmentAudioOffset + `
+		FROM segment_search
+		JOIN audio_segments s ON s.search_rowid = segment_search.rowid
+		JOIN books b ON b.id = s.book_id
+		WHERE segment_search MATCH ? AND (? = '' OR s.book_id = ?)
+		ORDER BY segment_search.rank
+		LIMIT ? OFFSET ?
+	`
+	return db.querySegmentHits(results, nil, segmentQuery, match, bookID, bookID, limit, offset)
+}
+
+func (db *DB) searchLike(results *models.SearchResults, terms []string, bookID string, limit, offset int) error {
+	var bookWhere, segmentWhere []string
+	var bookArgs, segmentArgs []interface{}
+	for _, term := range terms {
+		pattern := "%" + likeEscaper.Replace(term) + "%"
+		bookWhere = append(bookWhere, `(title LIKE ? ESCAPE '\' OR author LIKE ? ESCAPE '\')`)
+		bookArgs = append(bookArgs, pattern, pattern)
+		segmentWhere = append(segmentWhere, `s.content LIKE ? ESCAPE '\'`)
+		segmentArgs = append(segmentArgs, pattern)
+	}
+	bookArgs = append(bookArgs, bookID, bookID, limit, offset)
+	segmentArgs = append(segmentArgs, bookID, bookID, limit, offset)
+
+	bookQuery := `SELECT ` + bookColumns + `, title, COALESCE(author, '')
+		FROM books
+		WHERE ` + strings.Join(bookWhere, " AND ") + ` AND (? = '' OR id = ?)
+		ORDER BY title COLLATE NOCASE
+		LIMIT ? OFFSET ?
+	`
+	if err := db.queryBookHits(results, bookQuery, bookArgs...); err != nil {
+		return err
+	}
+
+	// Highlights and snippets are built here, as FTS5 would build them
+	pattern := termPattern(terms)
+	for i := range results.Books {
+		hit := &results.Books[i]
+		hit.TitleHighlight = pattern.ReplaceAllString(hit.TitleHighlight, "<mark>$0</mark>")
+		hit.AuthorHighlight = pattern.ReplaceAllString(hit.AuthorHighlight, "<mark>$0</mark>")
+	}
+
+	segmentQuery := `
+		SELECT s.id, s.book_id, b.title, s.segment_number, s.page_number, s.content, ` + segmentAudioOffset + `
+		FROM audio_segments s
+		JOIN books b ON b.id = s.book_id
+		WHERE ` + strings.Join(segmentWhere, " AND ") + ` AND (? = '' OR s.book_id = ?)
+		ORDER BY b.title COLLATE NOCASE, s.book_id, s.segment_number
+		LIMIT ? OFFSET ?
+	`
+	return db.querySegmentHits(results, pattern, segmentQuery, segmentArgs...)
+}
+
+func (db *DB) queryBookHits(results *models.SearchResults, query string, args ...interface{}) error {
+	rows, err := db.readers.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("error searching books: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hit models.BookHit
+		if err := scanBook(rows, &hit.Book, &hit.TitleHighlight, &hit.AuthorHighlight); err != nil {
+			return fmt.Errorf("error scanning book: %v", err)
+		}
+		results.Books = append(results.Books, hit)
+	}
+	return rows.Err()
+}
+
+// querySegmentHits runs a segment search. When pattern is set the selected
+// text is the whole segment, which is cut down to a highlighted snippet.
+func (db *DB) querySegmentHits(results *models.SearchResults, pattern *regexp.Regexp, query string, args ...interface{}) error {
+	rows, err := db.readers.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("error searching segments: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hit models.SegmentHit
+		var audioOffset sql.NullFloat64
+		if err := rows.Scan(&hit.SegmentID, &hit.BookID, &hit.BookTitle, &hit.SegmentNumber,
+			&hit.PageNumber, &hit.Snippet, &audioOffset); err != nil {
+			return fmt.Errorf("error scanning segment: %v", err)
+		}
+		if audioOffset.Valid {
+			hit.AudioOffset = &audioOffset.Float64
+		}
+		if pattern != nil {
+			hit.Snippet = snippet(hit.Snippet, pattern, 16)
+		}
+		results.Segments = append(results.Segments, hit)
+	}
+	return rows.Err()
+}
+
+// matchExpression turns search terms into an FTS5 query matching every
+// term, with the last one matched as a prefix so results update as you type
+func matchExpression(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	quoted[len(quoted)-1] += "*"
+	return strings.Join(quoted, " ")
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// termPattern matches any of the terms, ignoring case
+func termPattern(terms []string) *regexp.Regexp {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	return regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+}
+
+// snippet returns about the given number of words of text around the first
+// match of pattern, with matches highlighted and cut text marked by an ellipsis
+func snippet(text string, pattern *regexp.Regexp, words int) string {
+	fields := strings.Fields(text)
+	first := 0
+	for i, field := range fields {
+		if pattern.MatchString(field) {
+			first = i
+			break
+		}
+	}
+
+	start := first - words/4
+	if start < 0 {
+		start = 0
+	}
+	end := start + words
+	if end > len(fields) {
+		end = len(fields)
+	}
+
+	out := pattern.ReplaceAllString(strings.Join(fields[start:end], " "), "<mark>$0</mark>")
+	if start > 0 {
+		out = "…" + out
+	}
+	if end < len(fields) {
+		out += "…"
+	}
+	return out
+}
@@ -0,0 +1,116 @@
+//go:build sqlite_fts5
+
+package sqlite
+
+import (
+	"testing"
+
+	"backend/domain/models"
+)
+
+func TestSearchFTS5(t *testing.T) {
+	db := newSearchDB(t)
+	if !db.fts {
+		t.Fatal("InitSearch did not enable FTS5 in a sqlite_fts5 build")
+	}
+	testSearch(t, db, SearchEngineFTS5)
+}
+
+func TestSearchFTS5Index(t *testing.T) {
+	db := newSearchDB(t)
+
+	// Accents are ignored
+	book := &models.Book{ID: "b4", Title: "Émile", Author: "Jean-Jacques Rousseau", Status: models.BookStatusReady}
+	if err := db.SaveBook(book); err != nil {
+		t.Fatal(err)
+	}
+	if results, err := db.Search("emile", "", 20, 0); err != nil || len(results.Books) != 1 {
+		t.Errorf("emile = %+v, %v; want Émile", results, err)
+	}
+
+	// Triggers keep the index in step with edits and deletions
+	segment, err := db.GetAudioSegmentByID("s3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	segment.Content = "A heron stands in the reeds"
+	if err := db.UpdateAudioSegment(segment); err != nil {
+		t.Fatal(err)
+	}
+	if results, err := db.Search("heron", "", 20, 0); err != nil || len(results.Segments) != 1 {
+		t.Errorf("heron after edit = %+v, %v; want s3", results, err)
+	}
+	if results, err := db.Search("nothing", "", 20, 0); err != nil || len(results.Segments) != 0 {
+		t.Errorf("nothing after edit = %+v, %v; want no segments", results, err)
+	}
+	if err := db.DeleteBook("b2"); err != nil {
+		t.Fatal(err)
+	}
+	if results, err := db.Search("persuasion", "", 20, 0); err != nil || len(results.Books) != 0 {
+		t.Errorf("persuasion after delete = %+v, %v; want none", results, err)
+	}
+
+	// A missing trigger is recreated and the index rebuilt on startup
+	if _, err := db.Exec("DROP TRIGGER segment_search_update"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE audio_segments SET content = 'An otter swims' WHERE id = 's3'"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InitSearch(); err != nil {
+		t.Fatalf("InitSearch: %v", err)
+	}
+	if results, err := db.Search("otter", "", 20, 0); err != nil || len(results.Segments) != 1 {
+		t.Errorf("otter after rebuild = %+v, %v; want s3", results, err)
+	}
+}
+
+func TestSearchFTS5SurvivesRenumbering(t *testing.T) {
+	db := newSearchDB(t)
+
+	// VACUUM may renumber implicit rowids; shifting them has the same effect
+	for _, table := range []string{"books", "audio_segments"} {
+		if _, err := db.Exec("UPDATE " + table + " SET rowid = rowid + 1000"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec("VACUUM"); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := db.Search("persuasion", "", 20, 0)
+	if err != nil || len(results.Books) != 1 || results.Books[0].Book.ID != "b2" {
+		t.Fatalf("persuasion after renumbering = %+v, %v; want b2", results, err)
+	}
+	if results.Books[0].TitleHighlight != "<mark>Persuasion</mark>" {
+		t.Errorf("highlight = %q", results.Books[0].TitleHighlight)
+	}
+	results, err = db.Search("autumn", "", 20, 0)
+	if err != nil || len(results.Segments) != 1 || results.Segments[0].SegmentID != "s4" {
+		t.Errorf("autumn after renumbering = %+v, %v; want s4", results, err)
+	}
+
+	// Edits, deletions and new rows still reach the right index entries
+	if _, err := db.Exec("UPDATE books SET title = 'Mansfield Park' WHERE id = 'b1'"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteBook("b3"); err != nil {
+		t.Fatal(err)
+	}
+	book := &models.Book{ID: "b4", Title: "Middlemarch", Author: "George Eliot", Status: models.BookStatusReady}
+	if err := db.SaveBook(book); err != nil {
+		t.Fatal(err)
+	}
+	for query, want := range map[string]int{"mansfield": 1, "emma": 0, "beloved": 0, "middlemarch": 1, "austen": 2} {
+		results, err := db.Search(query, "", 20, 0)
+		if err != nil || len(results.Books) != want {
+			t.Errorf("%s = %+v, %v; want %d books", query, results.Books, err, want)
+		}
+	}
+	if _, err := db.Exec("INSERT INTO book_search (book_search, rank) VALUES ('integrity-check', 1)"); err != nil {
+		t.Errorf("book_search integrity check: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO segment_search (segment_search, rank) VALUES ('integrity-check', 1)"); err != nil {
+		t.Errorf("segment_search integrity check: %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !sqlite_fts5
+
+package sqlite
+
+import "testing"
+
+func TestSearchWithoutFTS5(t *testing.T) {
+	db := newSearchDB(t)
+	if db.fts {
+		t.Fatal("InitSearch enabled FTS5 without the sqlite_fts5 build tag")
+	}
+
+	// The index triggers are dropped so writes keep working
+	var triggers int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE '%_search_%'").Scan(&triggers); err != nil {
+		t.Fatal(err)
+	}
+	if triggers != 0 {
+		t.Errorf("%d search triggers left without FTS5", triggers)
+	}
+	testSearch(t, db, SearchEngineLike)
+}
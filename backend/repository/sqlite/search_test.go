@@ -0,0 +1,179 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/domain/models"
+)
+
+// newSearchDB opens a migrated database holding three books, four segments
+// of which two have audio, and the search index if FTS5 is available
+func newSearchDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitDB(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InitSearch(); err != nil {
+		t.Fatalf("InitSearch: %v", err)
+	}
+
+	now := time.Now()
+	books := []models.Book{
+		{ID: "b1", Title: "Emma", Author: "Jane Austen"},
+		{ID: "b2", Title: "Persuasion", Author: "Jane Austen"},
+		{ID: "b3", Title: "Beloved", Author: "Toni Morrison"},
+	}
+	for _, book := range books {
+		book.Status = models.BookStatusReady
+		book.CreatedAt, book.UpdatedAt = now, now
+		if err := db.SaveBook(&book); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	segments := []models.AudioSegment{
+		{ID: "s1", BookID: "b1", SegmentNumber: 1, PageNumber: 1, Content: "The quick brown fox jumps", AudioURL: "/audio/s1.mp3", Duration: 2},
+		{ID: "s2", BookID: "b1", SegmentNumber: 2, PageNumber: 2, Content: "A lazy dog sleeps by the brown fence", AudioURL: "/audio/s2.mp3", Duration: 3},
+		{ID: "s3", BookID: "b1", SegmentNumber: 3, PageNumber: 3, Content: "Nothing to see here"},
+		{ID: "s4", BookID: "b2", SegmentNumber: 1, PageNumber: 1, Content: "Brown leaves fall in autumn"},
+	}
+	for _, segment := range segments {
+		segment.Status = models.SegmentStatusCompleted
+		segment.CreatedAt, segment.UpdatedAt = now, now
+		if err := db.SaveAudioSegment(&segment); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// testSearch checks the behavior both search engines share
+func testSearch(t *testing.T, db *DB, engine string) {
+	search := func(query, bookID string, limit, offset int) *models.SearchResults {
+		t.Helper()
+		results, err := db.Search(query, bookID, limit, offset)
+		if err != nil {
+			t.Fatalf("Search(%q): %v", query, err)
+		}
+		if results.Engine != engine {
+			t.Fatalf("Search(%q) engine = %s, want %s", query, results.Engine, engine)
+		}
+		return results
+	}
+	bookIDs := func(results *models.SearchResults) string {
+		ids := make([]string, len(results.Books))
+		for i, hit := range results.Books {
+			ids[i] = hit.Book.ID
+		}
+		sort.Strings(ids)
+		return strings.Join(ids, ",")
+	}
+	segmentIDs := func(results *models.SearchResults) string {
+		ids := make([]string, len(results.Segments))
+		for i, hit := range results.Segments {
+			ids[i] = hit.SegmentID
+		}
+		sort.Strings(ids)
+		return strings.Join(ids, ",")
+	}
+
+	if got := search("   ", "", 20, 0); got.Books == nil || got.Segments == nil || len(got.Books)+len(got.Segments) != 0 {
+		t.Errorf("blank query = %+v, want empty lists", got)
+	}
+
+	// Every term must match, and the last one matches as a prefix
+	if got := bookIDs(search("austen", "", 20, 0)); got != "b1,b2" {
+		t.Errorf("austen books = %s, want b1,b2", got)
+	}
+	if got := bookIDs(search("jane aus", "", 20, 0)); got != "b1,b2" {
+		t.Errorf("jane aus books = %s, want b1,b2", got)
+	}
+	if got := bookIDs(search("jane morrison", "", 20, 0)); got != "" {
+		t.Errorf("jane morrison books = %s, want none", got)
+	}
+	if got := segmentIDs(search("brown fence", "", 20, 0)); got != "s2" {
+		t.Errorf("brown fence segments = %s, want s2", got)
+	}
+
+	// Matching ignores case and is highlighted
+	results := search("EMMA", "", 20, 0)
+	if len(results.Books) != 1 || results.Books[0].TitleHighlight != "<mark>Emma</mark>" {
+		t.Errorf("EMMA = %+v, want Emma highlighted", results.Books)
+	}
+	results = search("austen", "b2", 20, 0)
+	if len(results.Books) != 1 || results.Books[0].AuthorHighlight != "Jane <mark>Austen</mark>" {
+		t.Errorf("austen in b2 = %+v, want Austen highlighted", results.Books)
+	}
+	results = search("lazy", "", 20, 0)
+	if len(results.Segments) != 1 || !strings.Contains(results.Segments[0].Snippet, "<mark>lazy</mark>") {
+		t.Fatalf("lazy = %+v, want s2 with a highlighted snippet", results.Segments)
+	}
+
+	// Segments report where they start in the book's playlist
+	hit := results.Segments[0]
+	if hit.BookTitle != "Emma" || hit.SegmentNumber != 2 || hit.PageNumber != 2 || hit.AudioOffset == nil || *hit.AudioOffset != 2 {
+		t.Errorf("lazy hit = %+v, want segment 2 of Emma at 2s", hit)
+	}
+	if results := search("nothing", "", 20, 0); len(results.Segments) != 1 || results.Segments[0].AudioOffset != nil {
+		t.Errorf("nothing = %+v, want s3 without an audio offset", results.Segments)
+	}
+
+	// Results can be limited to a book and paged
+	if got := segmentIDs(search("brown", "", 20, 0)); got != "s1,s2,s4" {
+		t.Errorf("brown segments = %s, want s1,s2,s4", got)
+	}
+	if got := segmentIDs(search("brown", "b1", 20, 0)); got != "s1,s2" {
+		t.Errorf("brown segments in b1 = %s, want s1,s2", got)
+	}
+	first, second := search("brown", "", 2, 0), search("brown", "", 2, 2)
+	if len(first.Segments) != 2 || len(second.Segments) != 1 {
+		t.Errorf("brown pages = %d then %d segments, want 2 then 1", len(first.Segments), len(second.Segments))
+	}
+	if all := segmentIDs(&models.SearchResults{Segments: append(first.Segments, second.Segments...)}); all != "s1,s2,s4" {
+		t.Errorf("brown pages together = %s, want s1,s2,s4", all)
+	}
+
+	// Query syntax and LIKE wildcards are taken literally
+	for _, query := range []string{`50%`, `a_b`, `"quoted`, `fox*`, `NOT OR`, `-dog`, `back\slash`} {
+		if _, err := db.Search(query, "", 20, 0); err != nil {
+			t.Errorf("Search(%q): %v", query, err)
+		}
+	}
+	if got := segmentIDs(search("%", "", 20, 0)); got != "" {
+		t.Errorf("%% segments = %s, want none", got)
+	}
+}
+
+func TestSearchLike(t *testing.T) {
+	db := newSearchDB(t)
+	// Search with LIKE queries even when FTS5 is compiled in
+	db.fts = false
+	testSearch(t, db, SearchEngineLike)
+}
+
+func TestSnippet(t *testing.T) {
+	text := "one two three four five six seven eight nine ten eleven twelve"
+	pattern := termPattern([]string{"seven"})
+	got := snippet(text, pattern, 4)
+	if want := "…six <mark>seven</mark> eight nine…"; got != want {
+		t.Errorf("snippet = %q, want %q", got, want)
+	}
+	if got := snippet("seven", pattern, 4); got != "<mark>seven</mark>" {
+		t.Errorf("snippet of one word = %q", got)
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	if got, want := matchExpression([]string{"jane", `au"s`}), `"jane" "au""s"*`; got != want {
+		t.Errorf("matchExpression = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,108 @@
+package sqlite
+
+import (
+	"fmt"
+	"time"
+
+	"backend/domain/models"
+
+	"github.com/google/uuid"
+)
+
+// ReviseAudioSegment saves a segment whose text changed and appends the new
+// text to its revision history in a single transaction. The first time a
+// segment is revised its previous text is recorded as the original revision.
+func (db *DB) ReviseAudioSegment(segment *models.AudioSegment, previousContent, source string) (*models.SegmentRevision, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var latest int
+	err = tx.QueryRow(
+		"SELECT COALESCE(MAX(revision), 0) FROM segment_revisions WHERE segment_id = ?",
+		segment.ID,
+	).Scan(&latest)
+	if err != nil {
+		return nil, fmt.Errorf("error getting latest revision: %v", err)
+	}
+
+	insert := `
+		INSERT INTO segment_revisions (id, segment_id, revision, content, source, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	if latest == 0 {
+		latest = 1
+		_, err = tx.Exec(insert, uuid.New().String(), segment.ID, latest, previousContent, models.RevisionSourceExtracted, segment.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error saving original revision: %v", err)
+		}
+	}
+
+	revision := &models.SegmentRevision{
+		ID:        uuid.New().String(),
+		SegmentID: segment.ID,
+		Revision:  latest + 1,
+		Content:   segment.Content,
+		Source:    source,
+		CreatedAt: now,
+	}
+	_, err = tx.Exec(insert, revision.ID, revision.SegmentID, revision.Revision, revision.Content, revision.Source, revision.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error saving revision: %v", err)
+	}
+
+	segment.UpdatedAt = now
+	_, err = tx.Exec(`
+		UPDATE audio_segments
+		SET content = ?, status = ?, skip = ?, updated_at = ?
+		WHERE id = ?
+	`, segment.Content, segment.Status, segment.Skip, segment.UpdatedAt, segment.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error updating audio segment: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing revision: %v", err)
+	}
+
+	return revision, nil
+}
+
+// GetSegmentRevisions retrieves the revision history of a segment, oldest first
+func (db *DB) GetSegmentRevisions(segmentID string) ([]models.SegmentRevision, error) {
+	query := `
+		SELECT id, segment_id, revision, content, source, created_at
+		FROM segment_revisions
+		WHERE segment_id = ?
+		ORDER BY revision ASC
+	`
+
+	rows, err := db.readers.Query(query, segmentID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying segment revisions: %v", err)
+	}
+	defer rows.Close()
+
+	var revisions []models.SegmentRevision
+	for rows.Next() {
+		var revision models.SegmentRevision
+		err := rows.Scan(
+			&revision.ID,
+			&revision.SegmentID,
+			&revision.Revision,
+			&revision.Content,
+			&revision.Source,
+			&revision.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning segment revision: %v", err)
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
@@ -0,0 +1,85 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"backend/domain/models"
+
+	"github.com/google/uuid"
+)
+
+// StartBookStage ends the stage a book is currently in and records the start of a new one
+func (db *DB) StartBookStage(bookID, stage string) (*models.BookStage, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.Exec("UPDATE book_stages SET ended_at = ? WHERE book_id = ? AND ended_at IS NULL", now, bookID)
+	if err != nil {
+		return nil, fmt.Errorf("error ending book stage: %v", err)
+	}
+
+	record := &models.BookStage{
+		ID:        uuid.New().String(),
+		BookID:    bookID,
+		Stage:     stage,
+		StartedAt: now,
+	}
+	_, err = tx.Exec(
+		"INSERT INTO book_stages (id, book_id, stage, started_at, error) VALUES (?, ?, ?, ?, '')",
+		record.ID, record.BookID, record.Stage, record.StartedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error saving book stage: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing book stage: %v", err)
+	}
+	return record, nil
+}
+
+// EndBookStage ends the stage a book is currently in, recording the error
+// that stopped it if there is one
+func (db *DB) EndBookStage(bookID, stageErr string) error {
+	_, err := db.Exec(
+		"UPDATE book_stages SET ended_at = ?, error = ? WHERE book_id = ? AND ended_at IS NULL",
+		time.Now(), stageErr, bookID,
+	)
+	if err != nil {
+		return fmt.Errorf("error ending book stage: %v", err)
+	}
+	return nil
+}
+
+// GetBookStages returns a book's processing timeline, oldest stage first
+func (db *DB) GetBookStages(bookID string) ([]models.BookStage, error) {
+	rows, err := db.readers.Query(
+		"SELECT id, book_id, stage, started_at, ended_at, error FROM book_stages WHERE book_id = ? ORDER BY started_at",
+		bookID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting book stages: %v", err)
+	}
+	defer rows.Close()
+
+	var stages []models.BookStage
+	for rows.Next() {
+		var stage models.BookStage
+		var endedAt sql.NullTime
+		if err := rows.Scan(&stage.ID, &stage.BookID, &stage.Stage, &stage.StartedAt, &endedAt, &stage.Error); err != nil {
+			return nil, fmt.Errorf("error scanning book stage: %v", err)
+		}
+		if endedAt.Valid {
+			stage.EndedAt = &endedAt.Time
+		}
+		stages = append(stages, stage)
+	}
+
+	return stages, rows.Err()
+}
@@ -0,0 +1,68 @@
+package sqlite_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"backend/domain/models"
+	"backend/repository"
+	"backend/repository/repotest"
+	"backend/repository/sqlite"
+)
+
+func TestStore(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.Store {
+		db, err := sqlite.NewDB(filepath.Join(t.TempDir(), "test.db"), sqlite.DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if err := db.InitDB(); err != nil {
+			t.Fatal(err)
+		}
+		return db
+	})
+}
+
+func TestStorageUsageCountsCovers(t *testing.T) {
+	db, err := sqlite.NewDB(filepath.Join(t.TempDir(), "test.db"), sqlite.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.InitDB(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	book := &models.Book{ID: "b1", Title: "Emma", UserID: "u1", FileSize: 1000, Status: models.BookStatusReady, CreatedAt: now, UpdatedAt: now}
+	if err := db.SaveBook(book); err != nil {
+		t.Fatal(err)
+	}
+	segment := &models.AudioSegment{ID: "s1", BookID: "b1", SegmentNumber: 1, AudioSize: 300, Status: models.SegmentStatusCompleted, CreatedAt: now, UpdatedAt: now}
+	if err := db.SaveAudioSegment(segment); err != nil {
+		t.Fatal(err)
+	}
+
+	book.CoverKey = "covers/b1.jpg"
+	book.CoverSize = 50
+	thumbnails := []models.CoverThumbnail{{Width: 200, Height: 300, Key: "covers/b1-200.jpg", Size: 7}}
+	if _, err := db.SetBookCover(book, thumbnails); err != nil {
+		t.Fatal(err)
+	}
+
+	bytes, books, err := db.GetStorageUsage("u1")
+	if err != nil || bytes != 1357 || books != 1 {
+		t.Errorf("GetStorageUsage = %d bytes, %d books, %v; want 1357 bytes, 1 book", bytes, books, err)
+	}
+
+	// Replacing the cover replaces what it is charged
+	book.CoverSize = 20
+	if _, err := db.SetBookCover(book, nil); err != nil {
+		t.Fatal(err)
+	}
+	if bytes, _, err := db.GetStorageUsage("u1"); err != nil || bytes != 1320 {
+		t.Errorf("GetStorageUsage after replacing the cover = %d, %v; want 1320", bytes, err)
+	}
+}
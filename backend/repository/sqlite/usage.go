@@ -0,0 +1,134 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"backend/domain/models"
+)
+
+// SaveSynthesisUsage records characters sent for synthesis
+func (db *DB) SaveSynthesisUsage(usage *models.SynthesisUsage) error {
+	query := `
+		INSERT INTO synthesis_usage (
+			id, user_id, book_id, segment_id, characters, created_at
+		) VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := db.Exec(query,
+		usage.ID,
+		usage.UserID,
+		usage.BookID,
+		usage.SegmentID,
+		usage.Characters,
+		usage.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving synthesis usage: %v", err)
+	}
+	return nil
+}
+
+// GetSynthesisUsage returns the characters a user has sent for synthesis since the given time
+func (db *DB) GetSynthesisUsage(userID string, since time.Time) (int64, error) {
+	var characters int64
+	err := db.readers.QueryRow(
+		"SELECT COALESCE(SUM(characters), 0) FROM synthesis_usage WHERE user_id = ? AND created_at >= ?",
+		userID, since,
+	).Scan(&characters)
+	if err != nil {
+		return 0, fmt.Errorf("error getting synthesis usage: %v", err)
+	}
+	return characters, nil
+}
+
+// GetStorageUsage returns the number of books a user owns and the bytes
+// stored for their source files, covers, cover thumbnails and audio
+func (db *DB) GetStorageUsage(userID string) (bytes int64, books int64, err error) {
+	var fileBytes, thumbnailBytes, audioBytes int64
+	err = db.readers.QueryRow(
+		"SELECT COUNT(*), COALESCE(SUM(file_size + cover_size), 0) FROM books WHERE COALESCE(user_id, '') = ?",
+		userID,
+	).Scan(&books, &fileBytes)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error getting storage usage: %v", err)
+	}
+
+	err = db.readers.QueryRow(`
+		SELECT COALESCE(SUM(t.size), 0)
+		FROM cover_thumbnails t
+		JOIN books b ON b.id = t.book_id
+		WHERE COALESCE(b.user_id, '') = ?
+	`, userID).Scan(&thumbnailBytes)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error getting storage usage: %v", err)
+	}
+
+	err = db.readers.QueryRow(`
+		SELECT COALESCE(SUM(s.audio_size), 0)
+		FROM audio_segments s
+		JOIN books b ON b.id = s.book_id
+		WHERE COALESCE(b.user_id, '') = ?
+	`, userID).Scan(&audioBytes)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error getting storage usage: %v", err)
+	}
+
+	return fileBytes + thumbnailBytes + audioBytes, books, nil
+}
+
+// GetUserQuota returns a user's quota overrides, or nil if they have none
+func (db *DB) GetUserQuota(userID string) (*models.UserQuota, error) {
+	var storageBytes, books, characters sql.NullInt64
+	quota := &models.UserQuota{UserID: userID}
+
+	err := db.readers.QueryRow(
+		"SELECT storage_bytes, books, monthly_characters, updated_at FROM user_quotas WHERE user_id = ?",
+		userID,
+	).Scan(&storageBytes, &books, &characters, &quota.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting user quota: %v", err)
+	}
+
+	quota.StorageBytes = nullableInt64(storageBytes)
+	quota.Books = nullableInt64(books)
+	quota.MonthlyCharacters = nullableInt64(characters)
+	return quota, nil
+}
+
+// SaveUserQuota creates or replaces a user's quota overrides
+func (db *DB) SaveUserQuota(quota *models.UserQuota) error {
+	query := `
+		INSERT INTO user_quotas (user_id, storage_bytes, books, monthly_characters, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			storage_bytes = excluded.storage_bytes,
+			books = excluded.books,
+			monthly_characters = excluded.monthly_characters,
+			updated_at = excluded.updated_at
+	`
+
+	quota.UpdatedAt = time.Now()
+	_, err := db.Exec(query,
+		quota.UserID,
+		quota.StorageBytes,
+		quota.Books,
+		quota.MonthlyCharacters,
+		quota.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving user quota: %v", err)
+	}
+	return nil
+}
+
+func nullableInt64(v sql.NullInt64) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Int64
+}
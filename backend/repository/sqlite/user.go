@@ -92,7 +92,7 @@ func (db *DB) GetUserByID(id string) (*models.User, error) {
 	`
 
 	user := &models.User{}
-	err := db.QueryRow(query, id).Scan(
+	err := db.readers.QueryRow(query, id).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
@@ -117,7 +117,7 @@ func (db *DB) GetUserByEmail(email string) (*models.User, error) {
 	`
 
 	user := &models.User{}
-	err := db.QueryRow(query, email).Scan(
+	err := db.readers.QueryRow(query, email).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
@@ -142,7 +142,7 @@ func (db *DB) GetUserByUsername(username string) (*models.User, error) {
 	`
 
 	user := &models.User{}
-	err := db.QueryRow(query, username).Scan(
+	err := db.readers.QueryRow(query, username).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
@@ -173,7 +173,7 @@ func (db *DB) ValidatePassword(userID, password string) (bool, error) {
 	var hashedPassword string
 	query := "SELECT password_hash FROM users WHERE id = ?"
 
-	err := db.QueryRow(query, userID).Scan(&hashedPassword)
+	err := db.readers.QueryRow(query, userID).Scan(&hashedPassword)
 	if err != nil {
 		return false, fmt.Errorf("error getting password hash: %v", err)
 	}
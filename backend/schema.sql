@@ -1,86 +0,0 @@
--- Books table with enhanced metadata
-CREATE TABLE IF NOT EXISTS books (
-    id TEXT PRIMARY KEY,
-    title TEXT NOT NULL,
-    author TEXT,
-    cover_url TEXT,
-    file_url TEXT NOT NULL,
-    page_count INTEGER DEFAULT 0,
-    current_page INTEGER DEFAULT 0,
-    language TEXT DEFAULT 'en',
-    status TEXT NOT NULL DEFAULT 'pending',
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
--- Categories for organizing books
-CREATE TABLE IF NOT EXISTS categories (
-    id TEXT PRIMARY KEY,
-    name TEXT NOT NULL UNIQUE,
-    description TEXT,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
--- Book-Category relationship (many-to-many)
-CREATE TABLE IF NOT EXISTS book_categories (
-    book_id TEXT,
-    category_id TEXT,
-    PRIMARY KEY (book_id, category_id),
-    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
-    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
-);
-
--- Tags for flexible book organization
-CREATE TABLE IF NOT EXISTS tags (
-    id TEXT PRIMARY KEY,
-    name TEXT NOT NULL UNIQUE,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
--- Book-Tag relationship (many-to-many)
-CREATE TABLE IF NOT EXISTS book_tags (
-    book_id TEXT,
-    tag_id TEXT,
-    PRIMARY KEY (book_id, tag_id),
-    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
-    FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
-);
-
--- Audio synthesis tracking
-CREATE TABLE IF NOT EXISTS audio_segments (
-    id TEXT PRIMARY KEY,
-    book_id TEXT NOT NULL,
-    content TEXT NOT NULL,
-    audio_url TEXT,
-    status TEXT NOT NULL DEFAULT 'pending',
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
-);
-
--- Reading progress tracking
-CREATE TABLE IF NOT EXISTS reading_progress (
-    id TEXT PRIMARY KEY,
-    book_id TEXT NOT NULL,
-    current_page INTEGER DEFAULT 0,
-    completion_percentage FLOAT DEFAULT 0,
-    last_read_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
-    UNIQUE(book_id)
-);
-
--- Bookmarks
-CREATE TABLE IF NOT EXISTS bookmarks (
-    id TEXT PRIMARY KEY,
-    book_id TEXT NOT NULL,
-    page_number INTEGER NOT NULL,
-    note TEXT,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
-);
-
--- Create indexes for better query performance
-CREATE INDEX IF NOT EXISTS idx_books_title ON books(title);
-CREATE INDEX IF NOT EXISTS idx_reading_progress_book ON reading_progress(book_id);
-CREATE INDEX IF NOT EXISTS idx_audio_segments_book_id ON audio_segments(book_id);
-CREATE INDEX IF NOT EXISTS idx_bookmarks_book ON bookmarks(book_id); 
\ No newline at end of file
@@ -0,0 +1,132 @@
+package audio
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Break describes the kind of boundary that follows a segment of text
+type Break int
+
+const (
+	// BreakNone means the text continues mid-sentence into the next segment
+	BreakNone Break = iota
+	// BreakParagraph means the segment ends a paragraph
+	BreakParagraph
+	// BreakSection means a scene or section break follows
+	BreakSection
+	// BreakChapter means the next segment starts a new chapter
+	BreakChapter
+)
+
+// String returns the name of the break kind
+func (b Break) String() string {
+	switch b {
+	case BreakParagraph:
+		return "paragraph"
+	case BreakSection:
+		return "section"
+	case BreakChapter:
+		return "chapter"
+	}
+	return "none"
+}
+
+var (
+	chapterHeading = regexp.MustCompile(`(?i)^(chapter|part|book|prologue|epilogue|introduction|preface|afterword|appendix)\b`)
+	romanHeading   = regexp.MustCompile(`^[IVXLC]+\.?$`)
+	sectionMarker  = regexp.MustCompile(`^[\s*#~•·—–-]{3,}$|^§`)
+)
+
+// ClassifyBreak decides what kind of boundary lies between a segment's text
+// and the text of the segment that follows it. An empty next text means the
+// segment is the last one.
+func ClassifyBreak(current, next string) Break {
+	if strings.TrimSpace(next) == "" {
+		return BreakNone
+	}
+
+	nextLine := firstLine(next)
+	if chapterHeading.MatchString(nextLine) || romanHeading.MatchString(nextLine) {
+		return BreakChapter
+	}
+
+	if sectionMarker.MatchString(lastLine(current)) || sectionMarker.MatchString(nextLine) {
+		return BreakSection
+	}
+
+	trimmed := strings.TrimRightFunc(current, unicode.IsSpace)
+	trimmed = strings.TrimRight(trimmed, "\"'”’)]")
+	if trimmed == "" {
+		return BreakNone
+	}
+	switch trimmed[len(trimmed)-1] {
+	case '.', '!', '?', ':':
+		return BreakParagraph
+	}
+
+	return BreakNone
+}
+
+func firstLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+func lastLine(text string) string {
+	lines := strings.Split(text, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// Chapter is a run of consecutive segments that starts after a chapter break
+type Chapter struct {
+	Number int
+	Title  string
+	// Start and End are inclusive indexes into the texts passed to SplitChapters
+	Start int
+	End   int
+}
+
+// SplitChapters groups consecutive segment texts into chapters, starting a
+// new chapter wherever ClassifyBreak reports a chapter break. Text before the
+// first heading forms a chapter of its own.
+func SplitChapters(texts []string) []Chapter {
+	if len(texts) == 0 {
+		return nil
+	}
+
+	chapters := []Chapter{{Number: 1, Title: headingOf(texts[0]), Start: 0}}
+	for i := 0; i < len(texts)-1; i++ {
+		if ClassifyBreak(texts[i], texts[i+1]) != BreakChapter {
+			continue
+		}
+		chapters[len(chapters)-1].End = i
+		chapters = append(chapters, Chapter{
+			Number: len(chapters) + 1,
+			Title:  headingOf(texts[i+1]),
+			Start:  i + 1,
+		})
+	}
+	chapters[len(chapters)-1].End = len(texts) - 1
+
+	return chapters
+}
+
+// headingOf returns the first line of text if it looks like a chapter heading
+func headingOf(text string) string {
+	line := firstLine(text)
+	if chapterHeading.MatchString(line) || romanHeading.MatchString(line) {
+		return line
+	}
+	return ""
+}
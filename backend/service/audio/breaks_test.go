@@ -0,0 +1,63 @@
+package audio
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassifyBreak(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		next    string
+		want    Break
+	}{
+		{"mid sentence", "She walked into the", "room and sat down.", BreakNone},
+		{"end of paragraph", "She sat down.", "The clock struck nine.", BreakParagraph},
+		{"question", "Who was there?", "Nobody answered.", BreakParagraph},
+		{"closing quote", "\"Leave now.\"\n", "He left.", BreakParagraph},
+		{"curly quote", "“Leave now!”", "He left.", BreakParagraph},
+		{"colon", "He listed them:", "Apples, pears.", BreakParagraph},
+		{"last segment", "The end.", "  \n", BreakNone},
+		{"scene break after", "The door closed.\n* * *", "Morning came.", BreakSection},
+		{"scene break before", "The door closed.", "\n~~~\nMorning came.", BreakSection},
+		{"section sign", "The rules follow", "§ 2 Scope", BreakSection},
+		{"chapter heading", "The door closed.", "Chapter 2\nMorning came.", BreakChapter},
+		{"prologue", "Contents", "PROLOGUE", BreakChapter},
+		{"roman numeral", "The door closed.", "IV.\nMorning came.", BreakChapter},
+		{"word starting with a heading", "It was over.", "Booking the trip took hours.", BreakParagraph},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyBreak(tt.current, tt.next); got != tt.want {
+				t.Errorf("ClassifyBreak = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitChapters(t *testing.T) {
+	texts := []string{
+		"A note on the text.",
+		"Chapter 1\nIt began.",
+		"It went on.",
+		"II\nIt ended.",
+		"Epilogue",
+	}
+	want := []Chapter{
+		{Number: 1, Title: "", Start: 0, End: 0},
+		{Number: 2, Title: "Chapter 1", Start: 1, End: 2},
+		{Number: 3, Title: "II", Start: 3, End: 3},
+		{Number: 4, Title: "Epilogue", Start: 4, End: 4},
+	}
+	if got := SplitChapters(texts); !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitChapters = %+v, want %+v", got, want)
+	}
+
+	if got := SplitChapters(nil); got != nil {
+		t.Errorf("SplitChapters(nil) = %+v", got)
+	}
+	if got := SplitChapters([]string{"Chapter 1", "Text."}); len(got) != 1 || got[0].Title != "Chapter 1" || got[0].End != 1 {
+		t.Errorf("single chapter = %+v", got)
+	}
+}
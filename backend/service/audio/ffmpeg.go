@@ -0,0 +1,50 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// findFFmpeg resolves the configured ffmpeg binary, returning "" if it is not installed
+func findFFmpeg(name string) string {
+	if name == "" {
+		name = "ffmpeg"
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// runFFmpeg feeds input to ffmpeg on stdin and returns what it writes to a
+// temporary output file. A file is used rather than stdout because some
+// muxers, such as MP4, need a seekable output. ffmpeg is killed if ctx is
+// canceled.
+func runFFmpeg(ctx context.Context, ffmpegPath string, input []byte, outExt string, args ...string) ([]byte, error) {
+	out, err := os.CreateTemp("", "ffmpeg-*"+outExt)
+	if err != nil {
+		return nil, fmt.Errorf("error creating temp file: %v", err)
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+
+	cmdArgs := append([]string{"-hide_banner", "-loglevel", "error", "-y", "-i", "pipe:0"}, args...)
+	cmdArgs = append(cmdArgs, out.Name())
+
+	cmd := exec.CommandContext(ctx, ffmpegPath, cmdArgs...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("error running ffmpeg: %v: %s", err, stderr.String())
+	}
+
+	return os.ReadFile(out.Name())
+}
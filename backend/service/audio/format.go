@@ -0,0 +1,40 @@
+package audio
+
+// Format is the stored representation of an encoded audio file
+type Format struct {
+	Container string `json:"container"`
+	Codec     string `json:"codec"`
+	Extension string `json:"extension"`
+	MimeType  string `json:"mimeType"`
+}
+
+// FormatOf derives the file extension and MIME type for probed audio.
+// A nil info describes data that could not be identified.
+func FormatOf(info *Info) Format {
+	if info == nil {
+		return Format{Extension: ".bin", MimeType: "application/octet-stream"}
+	}
+
+	f := Format{Container: info.Container, Codec: info.Codec}
+	switch info.Container {
+	case "mp3":
+		f.Extension, f.MimeType = ".mp3", "audio/mpeg"
+	case "wav":
+		f.Extension, f.MimeType = ".wav", "audio/wav"
+	case "ogg":
+		if info.Codec == "opus" {
+			f.Extension, f.MimeType = ".opus", "audio/ogg; codecs=opus"
+		} else {
+			f.Extension, f.MimeType = ".ogg", "audio/ogg; codecs=vorbis"
+		}
+	case "mp4":
+		f.Extension, f.MimeType = ".m4a", "audio/mp4"
+	case "flac":
+		f.Extension, f.MimeType = ".flac", "audio/flac"
+	case "aac":
+		f.Extension, f.MimeType = ".aac", "audio/aac"
+	default:
+		f.Extension, f.MimeType = ".bin", "application/octet-stream"
+	}
+	return f
+}
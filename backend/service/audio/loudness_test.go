@@ -0,0 +1,78 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// sine returns seconds of a sine wave at freq with the given peak amplitude
+// on every channel
+func sine(sampleRate, channels int, freq, amplitude, seconds float64) *PCM {
+	frames := int(seconds * float64(sampleRate))
+	p := &PCM{SampleRate: sampleRate, Channels: channels, Samples: make([]float64, frames*channels)}
+	for i := 0; i < frames; i++ {
+		v := amplitude * math.Sin(2*math.Pi*freq*float64(i)/float64(sampleRate))
+		for c := 0; c < channels; c++ {
+			p.Samples[i*channels+c] = v
+		}
+	}
+	return p
+}
+
+// silence returns seconds of silence
+func silence(sampleRate, channels int, seconds float64) *PCM {
+	frames := int(seconds * float64(sampleRate))
+	return &PCM{SampleRate: sampleRate, Channels: channels, Samples: make([]float64, frames*channels)}
+}
+
+func TestLoudness(t *testing.T) {
+	// BS.1770 calibrates a full-scale 997 Hz sine on one channel to -3.01 LUFS
+	tests := []struct {
+		name string
+		pcm  *PCM
+		want float64
+	}{
+		{"full scale mono 48k", sine(48000, 1, 997, 1, 3), -3.01},
+		{"full scale mono 44.1k", sine(44100, 1, 997, 1, 3), -3.01},
+		{"half scale mono", sine(48000, 1, 997, 0.5, 3), -9.03},
+		{"full scale stereo", sine(48000, 2, 997, 1, 3), 0},
+		{"quiet mono 24k", sine(24000, 1, 997, 0.01, 3), -43.01},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Loudness(tt.pcm); math.Abs(got-tt.want) > 0.05 {
+				t.Errorf("Loudness = %.3f LUFS, want %.2f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoudnessGating(t *testing.T) {
+	// Blocks of pure silence are gated out, so padding the tone to three
+	// times its length costs well under the 4.8 dB an ungated mean would;
+	// only the blocks straddling its edges count
+	tone := sine(48000, 1, 997, 0.5, 2)
+	padded := &PCM{SampleRate: 48000, Channels: 1}
+	padded.Samples = append(padded.Samples, silence(48000, 1, 2).Samples...)
+	padded.Samples = append(padded.Samples, tone.Samples...)
+	padded.Samples = append(padded.Samples, silence(48000, 1, 2).Samples...)
+	if got, want := Loudness(padded), Loudness(tone); math.Abs(got-want) > 1 {
+		t.Errorf("Loudness with silence = %.3f, want %.3f", got, want)
+	}
+
+	if got := Loudness(silence(48000, 1, 1)); !math.IsInf(got, -1) {
+		t.Errorf("Loudness of silence = %v, want -Inf", got)
+	}
+	if got := Loudness(&PCM{SampleRate: 48000, Channels: 1}); !math.IsInf(got, -1) {
+		t.Errorf("Loudness of nothing = %v, want -Inf", got)
+	}
+}
+
+func TestPeak(t *testing.T) {
+	if got := Peak(&PCM{Channels: 1, Samples: []float64{0.1, -0.5, 0.25}}); math.Abs(got-(-6.02)) > 0.01 {
+		t.Errorf("Peak = %.3f dBFS, want -6.02", got)
+	}
+	if got := Peak(silence(8000, 1, 0.1)); !math.IsInf(got, -1) {
+		t.Errorf("Peak of silence = %v, want -Inf", got)
+	}
+}
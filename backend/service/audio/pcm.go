@@ -0,0 +1,146 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// WAV sample formats
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+// PCM holds decoded linear audio as interleaved samples in the range [-1, 1]
+type PCM struct {
+	SampleRate int
+	Channels   int
+	Samples    []float64
+}
+
+// Frames returns the number of sample frames (samples per channel)
+func (p *PCM) Frames() int {
+	if p.Channels == 0 {
+		return 0
+	}
+	return len(p.Samples) / p.Channels
+}
+
+// DecodeWAV decodes 8, 16, 24 or 32-bit integer and 32-bit float WAV data
+func DecodeWAV(data []byte) (*PCM, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("not a wav file")
+	}
+
+	var (
+		format        int
+		channels      int
+		sampleRate    int
+		bitsPerSample int
+		haveFmt       bool
+	)
+
+	pos := 12
+	for pos+8 <= len(data) {
+		chunkID := string(data[pos : pos+4])
+		chunkSize := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := pos + 8
+
+		switch chunkID {
+		case "fmt ":
+			if body+16 > len(data) {
+				return nil, fmt.Errorf("truncated wav fmt chunk")
+			}
+			format = int(binary.LittleEndian.Uint16(data[body : body+2]))
+			channels = int(binary.LittleEndian.Uint16(data[body+2 : body+4]))
+			sampleRate = int(binary.LittleEndian.Uint32(data[body+4 : body+8]))
+			bitsPerSample = int(binary.LittleEndian.Uint16(data[body+14 : body+16]))
+			// The real format of an extensible file is the first two bytes of its sub-format GUID
+			if format == wavFormatExtensible && chunkSize >= 26 && body+26 <= len(data) {
+				format = int(binary.LittleEndian.Uint16(data[body+24 : body+26]))
+			}
+			haveFmt = true
+		case "data":
+			if !haveFmt {
+				return nil, fmt.Errorf("wav data chunk before fmt chunk")
+			}
+			if chunkSize < 0 || body+chunkSize > len(data) {
+				chunkSize = len(data) - body
+			}
+			return decodeSamples(data[body:body+chunkSize], format, channels, sampleRate, bitsPerSample)
+		}
+
+		pos = body + chunkSize + chunkSize%2
+	}
+
+	return nil, fmt.Errorf("wav file has no data chunk")
+}
+
+func decodeSamples(raw []byte, format, channels, sampleRate, bits int) (*PCM, error) {
+	if channels <= 0 || sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid wav header")
+	}
+
+	width := bits / 8
+	if width == 0 {
+		return nil, fmt.Errorf("unsupported bits per sample: %d", bits)
+	}
+	count := len(raw) / width
+	count -= count % channels
+
+	pcm := &PCM{SampleRate: sampleRate, Channels: channels, Samples: make([]float64, count)}
+	for i := 0; i < count; i++ {
+		b := raw[i*width : (i+1)*width]
+		switch {
+		case format == wavFormatFloat && bits == 32:
+			pcm.Samples[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		case format == wavFormatPCM && bits == 8:
+			pcm.Samples[i] = (float64(b[0]) - 128) / 128
+		case format == wavFormatPCM && bits == 16:
+			pcm.Samples[i] = float64(int16(binary.LittleEndian.Uint16(b))) / 32768
+		case format == wavFormatPCM && bits == 24:
+			v := int32(b[0]) | int32(b[1])<<8 | int32(int8(b[2]))<<16
+			pcm.Samples[i] = float64(v) / 8388608
+		case format == wavFormatPCM && bits == 32:
+			pcm.Samples[i] = float64(int32(binary.LittleEndian.Uint32(b))) / 2147483648
+		default:
+			return nil, fmt.Errorf("unsupported wav format %d with %d bits per sample", format, bits)
+		}
+	}
+
+	return pcm, nil
+}
+
+// EncodeWAV encodes PCM audio as a 16-bit WAV file
+func EncodeWAV(p *PCM) []byte {
+	dataSize := len(p.Samples) * 2
+	var buf bytes.Buffer
+	buf.Grow(44 + dataSize)
+
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVE")
+
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, uint16(wavFormatPCM))
+	binary.Write(&buf, binary.LittleEndian, uint16(p.Channels))
+	binary.Write(&buf, binary.LittleEndian, uint32(p.SampleRate))
+	binary.Write(&buf, binary.LittleEndian, uint32(p.SampleRate*p.Channels*2))
+	binary.Write(&buf, binary.LittleEndian, uint16(p.Channels*2))
+	binary.Write(&buf, binary.LittleEndian, uint16(16))
+
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+	sample := make([]byte, 2)
+	for _, s := range p.Samples {
+		s = math.Max(-1, math.Min(1, s))
+		binary.LittleEndian.PutUint16(sample, uint16(int16(math.Round(s*32767))))
+		buf.Write(sample)
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,348 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Info describes the container, codec and length of an encoded audio file
+type Info struct {
+	Container  string        `json:"container"`
+	Codec      string        `json:"codec"`
+	Duration   time.Duration `json:"duration"`
+	SampleRate int           `json:"sampleRate"`
+	Channels   int           `json:"channels"`
+}
+
+// Probe inspects encoded audio data and reports its format and duration
+func Probe(data []byte) (*Info, error) {
+	switch {
+	case len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WAVE")):
+		return probeWAV(data)
+	case len(data) >= 4 && bytes.Equal(data[0:4], []byte("OggS")):
+		return probeOgg(data)
+	case len(data) >= 4 && bytes.Equal(data[0:4], []byte("fLaC")):
+		return probeFLAC(data)
+	case len(data) >= 8 && bytes.Equal(data[4:8], []byte("ftyp")):
+		return probeMP4(data)
+	case len(data) >= 3 && bytes.Equal(data[0:3], []byte("ID3")):
+		return probeMP3(data)
+	case len(data) >= 2 && data[0] == 0xFF && data[1]&0xF6 == 0xF0:
+		return probeADTS(data)
+	case len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0:
+		return probeMP3(data)
+	}
+	return nil, fmt.Errorf("unrecognized audio format")
+}
+
+// probeWAV reads the fmt and data chunks of a RIFF/WAVE file
+func probeWAV(data []byte) (*Info, error) {
+	info := &Info{Container: "wav", Codec: "pcm"}
+	var byteRate uint32
+
+	pos := 12
+	for pos+8 <= len(data) {
+		chunkID := string(data[pos : pos+4])
+		chunkSize := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := pos + 8
+
+		switch chunkID {
+		case "fmt ":
+			if body+16 > len(data) {
+				return nil, fmt.Errorf("truncated wav fmt chunk")
+			}
+			info.Channels = int(binary.LittleEndian.Uint16(data[body+2 : body+4]))
+			info.SampleRate = int(binary.LittleEndian.Uint32(data[body+4 : body+8]))
+			byteRate = binary.LittleEndian.Uint32(data[body+8 : body+12])
+		case "data":
+			if byteRate == 0 {
+				return nil, fmt.Errorf("wav data chunk before fmt chunk")
+			}
+			// Streaming encoders write a placeholder size, so clamp to what we have
+			if chunkSize < 0 || body+chunkSize > len(data) {
+				chunkSize = len(data) - body
+			}
+			info.Duration = time.Duration(float64(chunkSize) / float64(byteRate) * float64(time.Second))
+			return info, nil
+		}
+
+		// Chunks are padded to an even number of bytes
+		pos = body + chunkSize + chunkSize%2
+	}
+
+	return nil, fmt.Errorf("wav file has no data chunk")
+}
+
+var (
+	mp3BitratesV1 = [3][16]int{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0}, // Layer I
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},    // Layer II
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},     // Layer III
+	}
+	mp3BitratesV2 = [3][16]int{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0}, // Layer I
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},      // Layer II
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},      // Layer III
+	}
+	mp3SampleRates = map[int][3]int{
+		3: {44100, 48000, 32000}, // MPEG 1
+		2: {22050, 24000, 16000}, // MPEG 2
+		0: {11025, 12000, 8000},  // MPEG 2.5
+	}
+)
+
+// mp3Frame holds the fields of an MPEG audio frame header needed for timing
+type mp3Frame struct {
+	length     int
+	samples    int
+	sampleRate int
+	channels   int
+}
+
+// parseMP3Frame decodes the four byte MPEG audio frame header at the start of b
+func parseMP3Frame(b []byte) (mp3Frame, bool) {
+	if len(b) < 4 || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return mp3Frame{}, false
+	}
+
+	version := int(b[1]>>3) & 0x03
+	layer := int(b[1]>>1) & 0x03
+	bitrateIndex := int(b[2] >> 4)
+	sampleRateIndex := int(b[2]>>2) & 0x03
+	padding := int(b[2]>>1) & 0x01
+	channelMode := int(b[3] >> 6)
+
+	rates, ok := mp3SampleRates[version]
+	if !ok || layer == 0 || sampleRateIndex == 3 {
+		return mp3Frame{}, false
+	}
+
+	// Layer bits count down: 3 = Layer I, 1 = Layer III
+	layerIndex := 3 - layer
+	var kbps int
+	if version == 3 {
+		kbps = mp3BitratesV1[layerIndex][bitrateIndex]
+	} else {
+		kbps = mp3BitratesV2[layerIndex][bitrateIndex]
+	}
+	if kbps == 0 {
+		return mp3Frame{}, false
+	}
+
+	frame := mp3Frame{sampleRate: rates[sampleRateIndex], channels: 2}
+	if channelMode == 3 {
+		frame.channels = 1
+	}
+
+	switch {
+	case layerIndex == 0:
+		frame.samples = 384
+		frame.length = (12*kbps*1000/frame.sampleRate + padding) * 4
+	case layerIndex == 2 && version != 3:
+		frame.samples = 576
+		frame.length = 72*kbps*1000/frame.sampleRate + padding
+	default:
+		frame.samples = 1152
+		frame.length = 144*kbps*1000/frame.sampleRate + padding
+	}
+
+	return frame, frame.length > 4
+}
+
+// probeMP3 walks the MPEG audio frames and sums their playback time
+func probeMP3(data []byte) (*Info, error) {
+	pos := 0
+
+	// Skip an ID3v2 tag if present
+	if len(data) >= 10 && bytes.Equal(data[0:3], []byte("ID3")) {
+		size := int(data[6])<<21 | int(data[7])<<14 | int(data[8])<<7 | int(data[9])
+		pos = 10 + size
+		if data[5]&0x10 != 0 {
+			pos += 10
+		}
+	}
+
+	info := &Info{Container: "mp3", Codec: "mp3"}
+	var seconds float64
+	frames := 0
+
+	for pos+4 <= len(data) {
+		frame, ok := parseMP3Frame(data[pos:])
+		if !ok {
+			pos++
+			continue
+		}
+
+		// Guard against false syncs by requiring the first frame to be followed by another
+		if frames == 0 && pos+frame.length+4 <= len(data) {
+			if _, next := parseMP3Frame(data[pos+frame.length:]); !next {
+				pos++
+				continue
+			}
+		}
+
+		if frames == 0 {
+			info.SampleRate = frame.sampleRate
+			info.Channels = frame.channels
+		}
+		seconds += float64(frame.samples) / float64(frame.sampleRate)
+		frames++
+		pos += frame.length
+	}
+
+	if frames == 0 {
+		return nil, fmt.Errorf("no mp3 frames found")
+	}
+
+	info.Duration = time.Duration(seconds * float64(time.Second))
+	return info, nil
+}
+
+// probeOgg reads the codec from the first page and the length from the
+// granule position of the last page of an Ogg stream
+func probeOgg(data []byte) (*Info, error) {
+	if len(data) < 27 {
+		return nil, fmt.Errorf("truncated ogg page")
+	}
+	segments := int(data[26])
+	body := 27 + segments
+	if body > len(data) {
+		return nil, fmt.Errorf("truncated ogg page")
+	}
+	head := data[body:]
+
+	info := &Info{Container: "ogg"}
+	var preSkip int64
+	switch {
+	case len(head) >= 19 && bytes.Equal(head[0:8], []byte("OpusHead")):
+		info.Codec = "opus"
+		info.Channels = int(head[9])
+		preSkip = int64(binary.LittleEndian.Uint16(head[10:12]))
+		// Opus granule positions always count 48 kHz samples
+		info.SampleRate = 48000
+	case len(head) >= 16 && head[0] == 0x01 && bytes.Equal(head[1:7], []byte("vorbis")):
+		info.Codec = "vorbis"
+		info.Channels = int(head[11])
+		info.SampleRate = int(binary.LittleEndian.Uint32(head[12:16]))
+	default:
+		return nil, fmt.Errorf("unsupported ogg codec")
+	}
+
+	last := bytes.LastIndex(data, []byte("OggS"))
+	if last < 0 || last+14 > len(data) || info.SampleRate == 0 {
+		return info, nil
+	}
+	granule := int64(binary.LittleEndian.Uint64(data[last+6 : last+14]))
+	if samples := granule - preSkip; samples > 0 {
+		info.Duration = time.Duration(float64(samples) / float64(info.SampleRate) * float64(time.Second))
+	}
+
+	return info, nil
+}
+
+// probeFLAC reads the STREAMINFO block, which always comes first
+func probeFLAC(data []byte) (*Info, error) {
+	if len(data) < 8+34 {
+		return nil, fmt.Errorf("truncated flac header")
+	}
+	si := data[8:]
+
+	info := &Info{Container: "flac", Codec: "flac"}
+	info.SampleRate = int(si[10])<<12 | int(si[11])<<4 | int(si[12])>>4
+	info.Channels = int(si[12]>>1&0x07) + 1
+	total := int64(si[13]&0x0F)<<32 | int64(binary.BigEndian.Uint32(si[14:18]))
+	if info.SampleRate > 0 {
+		info.Duration = time.Duration(float64(total) / float64(info.SampleRate) * float64(time.Second))
+	}
+
+	return info, nil
+}
+
+// probeMP4 reads the movie header of an MP4/M4A file
+func probeMP4(data []byte) (*Info, error) {
+	info := &Info{Container: "mp4", Codec: "aac"}
+
+	moov, ok := findBox(data, "moov")
+	if !ok {
+		// Not fast-started and the movie box is missing; the container is still known
+		return info, nil
+	}
+	mvhd, ok := findBox(moov, "mvhd")
+	if !ok || len(mvhd) < 20 {
+		return info, nil
+	}
+
+	var timescale uint32
+	var duration uint64
+	if mvhd[0] == 1 && len(mvhd) >= 32 {
+		timescale = binary.BigEndian.Uint32(mvhd[20:24])
+		duration = binary.BigEndian.Uint64(mvhd[24:32])
+	} else {
+		timescale = binary.BigEndian.Uint32(mvhd[12:16])
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	}
+	if timescale > 0 {
+		info.Duration = time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+	}
+
+	return info, nil
+}
+
+// findBox returns the payload of the first box of the given type at this level
+func findBox(data []byte, boxType string) ([]byte, bool) {
+	pos := 0
+	for pos+8 <= len(data) {
+		size := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		header := 8
+		if size == 1 && pos+16 <= len(data) {
+			size = int(binary.BigEndian.Uint64(data[pos+8 : pos+16]))
+			header = 16
+		} else if size == 0 {
+			size = len(data) - pos
+		}
+		if size < header || pos+size > len(data) {
+			return nil, false
+		}
+		if string(data[pos+4:pos+8]) == boxType {
+			return data[pos+header : pos+size], true
+		}
+		pos += size
+	}
+	return nil, false
+}
+
+var adtsSampleRates = [16]int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// probeADTS walks the frames of a raw AAC stream
+func probeADTS(data []byte) (*Info, error) {
+	info := &Info{Container: "aac", Codec: "aac"}
+	frames := 0
+
+	pos := 0
+	for pos+7 <= len(data) {
+		b := data[pos:]
+		if b[0] != 0xFF || b[1]&0xF6 != 0xF0 {
+			break
+		}
+		rate := adtsSampleRates[(b[2]>>2)&0x0F]
+		length := int(b[3]&0x03)<<11 | int(b[4])<<3 | int(b[5])>>5
+		if rate == 0 || length < 7 {
+			break
+		}
+		if frames == 0 {
+			info.SampleRate = rate
+			info.Channels = int(b[2]&0x01)<<2 | int(b[3])>>6
+		}
+		frames++
+		pos += length
+	}
+
+	if frames == 0 {
+		return nil, fmt.Errorf("no aac frames found")
+	}
+
+	info.Duration = time.Duration(float64(frames*1024) / float64(info.SampleRate) * float64(time.Second))
+	return info, nil
+}
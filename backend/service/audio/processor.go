@@ -0,0 +1,186 @@
+package audio
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"backend/config"
+)
+
+// Options control post-synthesis processing of a single segment
+type Options struct {
+	// TargetLUFS is the integrated loudness each segment is normalized to
+	TargetLUFS float64
+	// PeakCeiling is the highest sample peak allowed after normalization, in dBFS
+	PeakCeiling float64
+	// SilenceThreshold is the level below which leading and trailing audio is trimmed, in dBFS
+	SilenceThreshold float64
+	// PadEnd is silence appended after the trimmed audio
+	PadEnd time.Duration
+}
+
+// Processor normalizes loudness, trims silence and pads segments with pauses.
+// WAV audio is processed natively; other formats require ffmpeg and are
+// passed through unchanged when it is not available.
+type Processor struct {
+	config     *config.Config
+	ffmpegPath string
+}
+
+// NewProcessor creates a new audio processor
+func NewProcessor(cfg *config.Config) *Processor {
+	return &Processor{config: cfg, ffmpegPath: findFFmpeg(cfg.FFmpegPath)}
+}
+
+// Enabled reports whether post-synthesis processing is turned on
+func (p *Processor) Enabled() bool {
+	return p.config.AudioProcessing
+}
+
+// OptionsFor returns the processing options for a segment followed by the given break
+func (p *Processor) OptionsFor(b Break) Options {
+	return Options{
+		TargetLUFS:       p.config.AudioTargetLUFS,
+		PeakCeiling:      p.config.AudioPeakCeiling,
+		SilenceThreshold: p.config.AudioSilenceThreshold,
+		PadEnd:           p.PauseFor(b),
+	}
+}
+
+// PauseFor returns the configured pause inserted after a break
+func (p *Processor) PauseFor(b Break) time.Duration {
+	switch b {
+	case BreakParagraph:
+		return time.Duration(p.config.AudioParagraphPauseMs) * time.Millisecond
+	case BreakSection:
+		return time.Duration(p.config.AudioSectionPauseMs) * time.Millisecond
+	case BreakChapter:
+		return time.Duration(p.config.AudioChapterPauseMs) * time.Millisecond
+	}
+	return 0
+}
+
+// Process applies loudness normalization, silence trimming and padding to
+// encoded audio and returns audio in the same container
+func (p *Processor) Process(ctx context.Context, data []byte, opts Options) ([]byte, error) {
+	if !p.Enabled() {
+		return data, nil
+	}
+
+	info, err := Probe(data)
+	if err != nil {
+		return nil, fmt.Errorf("error probing audio: %v", err)
+	}
+
+	if info.Container == "wav" {
+		pcm, err := DecodeWAV(data)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding wav: %v", err)
+		}
+		return EncodeWAV(ProcessPCM(pcm, opts)), nil
+	}
+
+	if p.ffmpegPath == "" {
+		log.Printf("[Audio] ffmpeg not available, skipping processing of %s audio", info.Container)
+		return data, nil
+	}
+	return p.processFFmpeg(ctx, data, info, opts)
+}
+
+// ProcessPCM trims, normalizes and pads decoded audio in place and returns it
+func ProcessPCM(pcm *PCM, opts Options) *PCM {
+	trimSilence(pcm, opts.SilenceThreshold)
+
+	if loudness := Loudness(pcm); !math.IsInf(loudness, -1) {
+		gain := opts.TargetLUFS - loudness
+		// Back off the gain if it would push peaks over the ceiling
+		if peak := Peak(pcm); peak+gain > opts.PeakCeiling {
+			gain = opts.PeakCeiling - peak
+		}
+		factor := math.Pow(10, gain/20)
+		for i := range pcm.Samples {
+			pcm.Samples[i] *= factor
+		}
+	}
+
+	if opts.PadEnd > 0 {
+		frames := int(opts.PadEnd.Seconds() * float64(pcm.SampleRate))
+		pcm.Samples = append(pcm.Samples, make([]float64, frames*pcm.Channels)...)
+	}
+
+	return pcm
+}
+
+// trimSilence removes leading and trailing audio whose 10 ms RMS stays below
+// the threshold, keeping a short margin so word onsets are not clipped
+func trimSilence(pcm *PCM, thresholdDB float64) {
+	frames := pcm.Frames()
+	window := pcm.SampleRate / 100
+	if window == 0 || frames < window {
+		return
+	}
+	threshold := math.Pow(10, thresholdDB/20)
+
+	loud := func(start int) bool {
+		var sum float64
+		for i := start * pcm.Channels; i < (start+window)*pcm.Channels; i++ {
+			sum += pcm.Samples[i] * pcm.Samples[i]
+		}
+		return math.Sqrt(sum/float64(window*pcm.Channels)) >= threshold
+	}
+
+	first, last := -1, -1
+	for start := 0; start+window <= frames; start += window {
+		if loud(start) {
+			first = start
+			break
+		}
+	}
+	if first < 0 {
+		return
+	}
+	for start := frames - window; start >= first; start -= window {
+		if loud(start) {
+			last = start + window
+			break
+		}
+	}
+
+	margin := pcm.SampleRate * 30 / 1000
+	first = max(0, first-margin)
+	last = min(frames, last+margin)
+	pcm.Samples = pcm.Samples[first*pcm.Channels : last*pcm.Channels]
+}
+
+// processFFmpeg runs the equivalent filter chain through ffmpeg for
+// compressed formats, re-encoding to the input's container
+func (p *Processor) processFFmpeg(ctx context.Context, data []byte, info *Info, opts Options) ([]byte, error) {
+	trim := fmt.Sprintf("silenceremove=start_periods=1:start_threshold=%gdB:start_silence=0.03", opts.SilenceThreshold)
+	filter := fmt.Sprintf("%s,areverse,%s,areverse,loudnorm=I=%g:TP=%g:LRA=11",
+		trim, trim, opts.TargetLUFS, opts.PeakCeiling)
+	if opts.PadEnd > 0 {
+		filter += fmt.Sprintf(",apad=pad_dur=%.3f", opts.PadEnd.Seconds())
+	}
+
+	args := []string{"-af", filter}
+	// loudnorm upsamples internally, so restore the original rate
+	if info.SampleRate > 0 {
+		args = append(args, "-ar", fmt.Sprint(info.SampleRate))
+	}
+
+	// Re-encode to the input's codec so later stages see the same container
+	switch info.Codec {
+	case "mp3":
+		return runFFmpeg(ctx, p.ffmpegPath, data, ".mp3", append(args, "-c:a", "libmp3lame", "-q:a", "2", "-f", "mp3")...)
+	case "opus":
+		return runFFmpeg(ctx, p.ffmpegPath, data, ".opus", append(args, "-c:a", "libopus", "-f", "ogg")...)
+	case "aac":
+		return runFFmpeg(ctx, p.ffmpegPath, data, ".m4a", append(args, "-c:a", "aac", "-f", "ipod")...)
+	case "flac":
+		return runFFmpeg(ctx, p.ffmpegPath, data, ".flac", append(args, "-c:a", "flac", "-f", "flac")...)
+	}
+	return nil, fmt.Errorf("unsupported codec for processing: %s", info.Codec)
+}
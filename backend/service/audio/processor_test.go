@@ -0,0 +1,113 @@
+package audio
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"backend/config"
+)
+
+// concat joins PCM clips with the same format
+func concat(clips ...*PCM) *PCM {
+	p := &PCM{SampleRate: clips[0].SampleRate, Channels: clips[0].Channels}
+	for _, clip := range clips {
+		p.Samples = append(p.Samples, clip.Samples...)
+	}
+	return p
+}
+
+func TestProcessPCMTrimsAndPads(t *testing.T) {
+	const rate = 48000
+	pcm := concat(silence(rate, 1, 0.5), sine(rate, 1, 440, 0.1, 1), silence(rate, 1, 0.5))
+
+	opts := Options{TargetLUFS: -20, PeakCeiling: -1, SilenceThreshold: -50, PadEnd: 600 * time.Millisecond}
+	out := ProcessPCM(pcm, opts)
+
+	// The tone is kept with a 30 ms margin on each side, then the pause added
+	margin := rate * 30 / 1000
+	want := rate + 2*margin + rate*600/1000
+	if got := out.Frames(); got != want {
+		t.Errorf("frames = %d, want %d", got, want)
+	}
+	for i := out.Frames() - rate*600/1000; i < out.Frames(); i++ {
+		if out.Samples[i] != 0 {
+			t.Fatalf("padding sample %d = %v, want silence", i, out.Samples[i])
+		}
+	}
+	// The gain is set before the pause is appended
+	speech := &PCM{SampleRate: rate, Channels: 1, Samples: out.Samples[:rate+2*margin]}
+	if got := Loudness(speech); math.Abs(got-(-20)) > 0.1 {
+		t.Errorf("Loudness = %.2f, want -20", got)
+	}
+}
+
+func TestProcessPCMPeakCeiling(t *testing.T) {
+	pcm := sine(48000, 1, 997, 0.5, 1)
+
+	// Reaching -3 LUFS would need +6 dB, which the ceiling does not allow
+	out := ProcessPCM(pcm, Options{TargetLUFS: -3, PeakCeiling: -2, SilenceThreshold: -60})
+	if got := Peak(out); math.Abs(got-(-2)) > 0.01 {
+		t.Errorf("Peak = %.3f dBFS, want -2", got)
+	}
+}
+
+func TestProcessPCMSilence(t *testing.T) {
+	// Audio that is silent throughout is left alone apart from the padding
+	pcm := silence(8000, 2, 0.5)
+	out := ProcessPCM(pcm, Options{TargetLUFS: -16, PeakCeiling: -1, SilenceThreshold: -50, PadEnd: 250 * time.Millisecond})
+	if got, want := out.Frames(), 4000+2000; got != want {
+		t.Errorf("frames = %d, want %d", got, want)
+	}
+	if got := Peak(out); !math.IsInf(got, -1) {
+		t.Errorf("Peak = %v, want silence", got)
+	}
+}
+
+func TestProcessorWAV(t *testing.T) {
+	cfg := &config.Config{
+		AudioProcessing:       true,
+		AudioTargetLUFS:       -18,
+		AudioPeakCeiling:      -1,
+		AudioSilenceThreshold: -50,
+		AudioParagraphPauseMs: 600,
+		AudioSectionPauseMs:   1200,
+		AudioChapterPauseMs:   2000,
+	}
+	p := &Processor{config: cfg}
+
+	for b, want := range map[Break]time.Duration{
+		BreakNone:      0,
+		BreakParagraph: 600 * time.Millisecond,
+		BreakSection:   1200 * time.Millisecond,
+		BreakChapter:   2 * time.Second,
+	} {
+		if got := p.OptionsFor(b).PadEnd; got != want {
+			t.Errorf("PadEnd after %s = %v, want %v", b, got, want)
+		}
+	}
+
+	input := EncodeWAV(concat(silence(24000, 1, 0.2), sine(24000, 1, 997, 0.05, 1)))
+	data, err := p.Process(context.Background(), input, p.OptionsFor(BreakChapter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := DecodeWAV(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.Frames(), 24000+24000*30/1000+2*24000; got != want {
+		t.Errorf("frames = %d, want %d", got, want)
+	}
+	speech := &PCM{SampleRate: 24000, Channels: 1, Samples: out.Samples[:24000+24000*30/1000]}
+	if got := Loudness(speech); math.Abs(got-(-18)) > 0.2 {
+		t.Errorf("Loudness = %.2f, want -18", got)
+	}
+
+	// Processing can be turned off
+	cfg.AudioProcessing = false
+	if data, err := p.Process(context.Background(), input, p.OptionsFor(BreakChapter)); err != nil || len(data) != len(input) {
+		t.Errorf("disabled Process changed the audio: %d bytes, %v", len(data), err)
+	}
+}
@@ -0,0 +1,213 @@
+package audio
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"backend/config"
+)
+
+// Profile describes an output encoding applied to synthesized audio
+type Profile struct {
+	Name string `json:"name"`
+	// Codec is one of mp3, opus, aac, flac, pcm, or copy to keep the provider's output
+	Codec string `json:"codec"`
+	// Bitrate in kbit/s, ignored by lossless codecs
+	Bitrate int `json:"bitrate,omitempty"`
+	// SampleRate and Channels are left unchanged when zero
+	SampleRate int `json:"sampleRate,omitempty"`
+	Channels   int `json:"channels,omitempty"`
+}
+
+// BuiltinProfiles are always available in addition to those from AUDIO_PROFILES
+var BuiltinProfiles = map[string]Profile{
+	"source":  {Name: "source", Codec: "copy"},
+	"mp3-128": {Name: "mp3-128", Codec: "mp3", Bitrate: 128},
+	"mp3-64":  {Name: "mp3-64", Codec: "mp3", Bitrate: 64, Channels: 1},
+	"opus-32": {Name: "opus-32", Codec: "opus", Bitrate: 32, Channels: 1},
+	"aac-64":  {Name: "aac-64", Codec: "aac", Bitrate: 64},
+	"flac":    {Name: "flac", Codec: "flac"},
+	"wav":     {Name: "wav", Codec: "pcm"},
+}
+
+// Satisfied reports whether audio of size bytes described by info already
+// matches the profile, so encoding it again would only lose quality. The
+// bitrate is averaged over the whole file and matches when it is no higher
+// than the profile's, allowing 5% for container overhead.
+func (p Profile) Satisfied(info *Info, size int) bool {
+	if info.Codec != p.Codec {
+		return false
+	}
+	if p.SampleRate > 0 && info.SampleRate != p.SampleRate {
+		return false
+	}
+	if p.Channels > 0 && info.Channels != p.Channels {
+		return false
+	}
+	if p.Bitrate > 0 && p.Codec != "flac" && p.Codec != "pcm" {
+		if info.Duration <= 0 {
+			return false
+		}
+		kbps := float64(size) * 8 / info.Duration.Seconds() / 1000
+		if kbps > float64(p.Bitrate)*1.05 {
+			return false
+		}
+	}
+	return true
+}
+
+// encoders maps a profile codec to the ffmpeg encoder, muxer and output extension
+var encoders = map[string]struct {
+	encoder string
+	muxer   string
+	ext     string
+}{
+	"mp3":  {"libmp3lame", "mp3", ".mp3"},
+	"opus": {"libopus", "ogg", ".opus"},
+	"aac":  {"aac", "ipod", ".m4a"},
+	"flac": {"flac", "flac", ".flac"},
+	"pcm":  {"pcm_s16le", "wav", ".wav"},
+}
+
+// ParseProfiles parses profile definitions of the form
+// "name=codec:bitrate[:sampleRate[:channels]]" separated by commas,
+// for example "mobile=opus:32:24000:1,compat=mp3:128"
+func ParseProfiles(spec string) (map[string]Profile, error) {
+	profiles := make(map[string]Profile)
+	for _, def := range strings.Split(spec, ",") {
+		def = strings.TrimSpace(def)
+		if def == "" {
+			continue
+		}
+
+		name, rest, ok := strings.Cut(def, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid audio profile %q", def)
+		}
+		fields := strings.Split(rest, ":")
+		profile := Profile{Name: name, Codec: fields[0]}
+		if _, ok := encoders[profile.Codec]; !ok && profile.Codec != "copy" {
+			return nil, fmt.Errorf("unsupported codec %q in audio profile %q", profile.Codec, name)
+		}
+
+		values := []*int{&profile.Bitrate, &profile.SampleRate, &profile.Channels}
+		for i, field := range fields[1:] {
+			if i >= len(values) {
+				return nil, fmt.Errorf("too many fields in audio profile %q", name)
+			}
+			n, err := strconv.Atoi(strings.TrimSuffix(field, "k"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q in audio profile %q", field, name)
+			}
+			*values[i] = n
+		}
+
+		profiles[name] = profile
+	}
+	return profiles, nil
+}
+
+// Transcoder encodes synthesized audio into output profiles with ffmpeg
+type Transcoder struct {
+	ffmpegPath     string
+	profiles       map[string]Profile
+	defaultProfile string
+}
+
+// NewTranscoder creates a transcoder with the built-in profiles, any custom
+// profiles from the configuration and the configured default profile
+func NewTranscoder(cfg *config.Config) (*Transcoder, error) {
+	profiles := make(map[string]Profile, len(BuiltinProfiles))
+	for name, p := range BuiltinProfiles {
+		profiles[name] = p
+	}
+
+	custom, err := ParseProfiles(cfg.AudioProfiles)
+	if err != nil {
+		return nil, err
+	}
+	for name, p := range custom {
+		profiles[name] = p
+	}
+
+	if _, ok := profiles[cfg.AudioProfile]; !ok {
+		return nil, fmt.Errorf("unknown default audio profile %q", cfg.AudioProfile)
+	}
+
+	t := &Transcoder{
+		ffmpegPath:     findFFmpeg(cfg.FFmpegPath),
+		profiles:       profiles,
+		defaultProfile: cfg.AudioProfile,
+	}
+	if t.ffmpegPath == "" {
+		log.Printf("[Audio] ffmpeg not found, audio will be stored in the provider's format")
+	}
+	return t, nil
+}
+
+// Profile looks up a profile by name
+func (t *Transcoder) Profile(name string) (Profile, bool) {
+	p, ok := t.profiles[name]
+	return p, ok
+}
+
+// Default returns the configured default profile
+func (t *Transcoder) Default() Profile {
+	return t.profiles[t.defaultProfile]
+}
+
+// Profiles returns all available profiles sorted by name
+func (t *Transcoder) Profiles() []Profile {
+	list := make([]Profile, 0, len(t.profiles))
+	for _, p := range t.profiles {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Transcode encodes audio into a profile and returns the encoded data along
+// with what it actually contains. Audio is returned unchanged when the
+// profile keeps the source, the source already satisfies the profile (to
+// avoid a lossy re-encode) or ffmpeg is unavailable.
+func (t *Transcoder) Transcode(ctx context.Context, data []byte, profile Profile) ([]byte, *Info, error) {
+	info, err := Probe(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error probing audio: %v", err)
+	}
+
+	enc, ok := encoders[profile.Codec]
+	if !ok || profile.Satisfied(info, len(data)) || t.ffmpegPath == "" {
+		return data, info, nil
+	}
+
+	args := []string{"-vn", "-c:a", enc.encoder}
+	if profile.Bitrate > 0 && profile.Codec != "flac" && profile.Codec != "pcm" {
+		args = append(args, "-b:a", fmt.Sprintf("%dk", profile.Bitrate))
+	}
+	if profile.SampleRate > 0 {
+		args = append(args, "-ar", strconv.Itoa(profile.SampleRate))
+	}
+	if profile.Channels > 0 {
+		args = append(args, "-ac", strconv.Itoa(profile.Channels))
+	}
+	args = append(args, "-f", enc.muxer)
+
+	encoded, err := runFFmpeg(ctx, t.ffmpegPath, data, enc.ext, args...)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("error encoding %s profile: %v", profile.Name, err)
+	}
+
+	encodedInfo, err := Probe(encoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error probing encoded audio: %v", err)
+	}
+	return encoded, encodedInfo, nil
+}
@@ -0,0 +1,58 @@
+package audio
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProfileSatisfied(t *testing.T) {
+	// One minute of audio; 480000 bytes averages 64 kbit/s
+	mono := &Info{Codec: "mp3", Duration: time.Minute, SampleRate: 44100, Channels: 1}
+	stereo := &Info{Codec: "mp3", Duration: time.Minute, SampleRate: 44100, Channels: 2}
+	wav := &Info{Codec: "pcm", Duration: time.Minute, SampleRate: 24000, Channels: 1}
+
+	tests := []struct {
+		name    string
+		profile Profile
+		info    *Info
+		size    int
+		want    bool
+	}{
+		{"same codec and bitrate", BuiltinProfiles["mp3-64"], mono, 480000, true},
+		{"container overhead", BuiltinProfiles["mp3-64"], mono, 500000, true},
+		{"higher bitrate", BuiltinProfiles["mp3-64"], mono, 960000, false},
+		{"lower bitrate", BuiltinProfiles["mp3-128"], mono, 480000, true},
+		{"more channels", BuiltinProfiles["mp3-64"], stereo, 480000, false},
+		{"unchanged channels", BuiltinProfiles["mp3-128"], stereo, 960000, true},
+		{"sample rate", Profile{Codec: "mp3", SampleRate: 22050}, mono, 480000, false},
+		{"unknown duration", BuiltinProfiles["mp3-64"], &Info{Codec: "mp3", Channels: 1}, 480000, false},
+		{"other codec", BuiltinProfiles["opus-32"], mono, 480000, false},
+		{"lossless ignores bitrate", Profile{Codec: "pcm", Bitrate: 64}, wav, 2880000, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.profile.Satisfied(tt.info, tt.size); got != tt.want {
+				t.Errorf("Satisfied = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseProfiles(t *testing.T) {
+	profiles, err := ParseProfiles("mobile=opus:32k:24000:1, compat=mp3:128")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := profiles["mobile"], (Profile{Name: "mobile", Codec: "opus", Bitrate: 32, SampleRate: 24000, Channels: 1}); got != want {
+		t.Errorf("mobile = %+v, want %+v", got, want)
+	}
+	if got := profiles["compat"]; got.Codec != "mp3" || got.Bitrate != 128 {
+		t.Errorf("compat = %+v", got)
+	}
+
+	for _, spec := range []string{"x", "x=vorbis:64", "x=mp3:fast", "x=mp3:1:2:3:4"} {
+		if _, err := ParseProfiles(spec); err == nil {
+			t.Errorf("ParseProfiles(%q) succeeded", spec)
+		}
+	}
+}
@@ -0,0 +1,456 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/repository"
+	"backend/repository/sqlite"
+	"backend/service/storage"
+)
+
+// ManifestVersion is the archive format written by Create
+const ManifestVersion = 1
+
+// Names of the entries in a backup archive. Stored files are kept under
+// FilesDir followed by their storage key.
+const (
+	DatabaseEntry = "database.db"
+	ManifestEntry = "manifest.json"
+	FilesDir      = "files/"
+)
+
+// Layout of a restored data directory
+const (
+	DatabaseFile = "ereader.db"
+	UploadsDir   = "uploads"
+)
+
+// FileEntry describes a file in a backup archive
+type FileEntry struct {
+	Key    string `json:"key,omitempty"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest lists the contents of a backup archive
+type Manifest struct {
+	Version       int         `json:"version"`
+	CreatedAt     time.Time   `json:"createdAt"`
+	SchemaVersion int         `json:"schemaVersion"`
+	Database      FileEntry   `json:"database"`
+	Files         []FileEntry `json:"files"`
+	// Missing lists referenced files that were not in storage when the backup was taken
+	Missing []string `json:"missing,omitempty"`
+}
+
+// Create writes a gzipped tarball to w holding a snapshot of the database,
+// every stored file the snapshot refers to, and a manifest of both. The
+// manifest is the last entry, since it records the checksums of the others.
+func Create(ctx context.Context, db repository.Snapshots, files *storage.FileStorage, w io.Writer) (*Manifest, error) {
+	tmpDir, err := os.MkdirTemp("", "ereader-backup-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Work from the snapshot so the files match the rows exactly
+	snapshotPath := filepath.Join(tmpDir, DatabaseEntry)
+	if err := db.Backup(ctx, snapshotPath); err != nil {
+		return nil, err
+	}
+	schemaVersion, keys, err := snapshotContents(snapshotPath, files)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		Version:       ManifestVersion,
+		CreatedAt:     time.Now().UTC(),
+		SchemaVersion: schemaVersion,
+		Files:         []FileEntry{},
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	entry, err := addFile(tw, DatabaseEntry, snapshotPath, manifest.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Database = *entry
+
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		entry, err := addStoredFile(ctx, tw, files, key, tmpDir, manifest.CreatedAt)
+		if errors.Is(err, storage.ErrNotFound) {
+			manifest.Missing = append(manifest.Missing, key)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, *entry)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding manifest: %v", err)
+	}
+	header := &tar.Header{Name: ManifestEntry, Mode: 0644, Size: int64(len(data)), ModTime: manifest.CreatedAt}
+	if err := tw.WriteHeader(header); err != nil {
+		return nil, fmt.Errorf("error writing archive: %v", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, fmt.Errorf("error writing archive: %v", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("error writing archive: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("error writing archive: %v", err)
+	}
+	return manifest, nil
+}
+
+// snapshotContents returns the schema version of a database snapshot and
+// the sorted storage keys of the files it refers to
+func snapshotContents(snapshotPath string, files *storage.FileStorage) (int, []string, error) {
+	snapshot, err := openDatabase(snapshotPath)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer snapshot.Close()
+
+	schemaVersion, err := snapshot.SchemaVersion()
+	if err != nil {
+		return 0, nil, err
+	}
+	refs, err := snapshot.GetFileReferences()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	seen := make(map[string]bool, len(refs))
+	keys := []string{}
+	for _, ref := range refs {
+		key, err := files.KeyFor(ref)
+		if err != nil || seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return schemaVersion, keys, nil
+}
+
+// addStoredFile copies a stored file into the archive. Files on remote
+// backends are spooled to tmpDir first, since tar needs each size up front.
+func addStoredFile(ctx context.Context, tw *tar.Writer, files *storage.FileStorage, key, tmpDir string, modTime time.Time) (*FileEntry, error) {
+	filePath, ok := files.LocalFile(key)
+	if ok {
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			return nil, storage.ErrNotFound
+		}
+	} else {
+		rc, _, err := files.Open(ctx, key)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("error reading %s: %v", key, err)
+		}
+		spool, err := os.CreateTemp(tmpDir, "file-*")
+		if err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("error creating temporary file: %v", err)
+		}
+		_, err = io.Copy(spool, rc)
+		rc.Close()
+		spool.Close()
+		defer os.Remove(spool.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", key, err)
+		}
+		filePath = spool.Name()
+	}
+
+	entry, err := addFile(tw, FilesDir+key, filePath, modTime)
+	if err != nil {
+		return nil, err
+	}
+	entry.Key = key
+	return entry, nil
+}
+
+// addFile writes the file at filePath to the archive under name
+func addFile(tw *tar.Writer, name, filePath string, modTime time.Time) (*FileEntry, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %v", name, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %v", name, err)
+	}
+
+	header := &tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: modTime}
+	if err := tw.WriteHeader(header); err != nil {
+		return nil, fmt.Errorf("error writing archive: %v", err)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(tw, io.TeeReader(f, hash)); err != nil {
+		return nil, fmt.Errorf("error writing %s to archive: %v", name, err)
+	}
+	return &FileEntry{Size: info.Size(), SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// Restore unpacks an archive written by Create into dataDir, which must be
+// empty or not exist yet. The database is written to DatabaseFile and stored
+// files to UploadsDir, laid out for the local storage backend. The archive
+// is checked against its manifest and the database for integrity; if
+// anything is wrong, everything restored is removed again.
+func Restore(r io.Reader, dataDir string) (manifest *Manifest, err error) {
+	created, err := prepareDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if created {
+			os.RemoveAll(dataDir)
+			return
+		}
+		os.Remove(filepath.Join(dataDir, DatabaseFile))
+		os.RemoveAll(filepath.Join(dataDir, UploadsDir))
+	}()
+
+	uploads, err := storage.NewLocalBackend(filepath.Join(dataDir, UploadsDir))
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading archive: %v", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	var database *FileEntry
+	restored := make(map[string]FileEntry)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading archive: %v", err)
+		}
+		// Archives repacked by hand may list directories, which need nothing
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("unexpected archive entry %s", header.Name)
+		}
+
+		switch {
+		case header.Name == ManifestEntry:
+			if manifest != nil {
+				return nil, fmt.Errorf("archive has more than one manifest")
+			}
+			manifest = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("error decoding manifest: %v", err)
+			}
+
+		case header.Name == DatabaseEntry:
+			if database != nil {
+				return nil, fmt.Errorf("archive has more than one database")
+			}
+			database, err = restoreDatabase(tr, filepath.Join(dataDir, DatabaseFile))
+			if err != nil {
+				return nil, err
+			}
+
+		case strings.HasPrefix(header.Name, FilesDir):
+			key := strings.TrimPrefix(header.Name, FilesDir)
+			if !validKey(key) {
+				return nil, fmt.Errorf("invalid file name in archive: %q", header.Name)
+			}
+			if _, ok := restored[key]; ok {
+				return nil, fmt.Errorf("archive has %s more than once", key)
+			}
+			hash := sha256.New()
+			counter := &countingWriter{}
+			if err := uploads.Put(context.Background(), key, io.TeeReader(tr, io.MultiWriter(hash, counter)), ""); err != nil {
+				return nil, fmt.Errorf("error restoring %s: %v", key, err)
+			}
+			restored[key] = FileEntry{Key: key, Size: counter.n, SHA256: hex.EncodeToString(hash.Sum(nil))}
+
+		default:
+			return nil, fmt.Errorf("unexpected archive entry %s", header.Name)
+		}
+	}
+
+	if err := verify(manifest, database, restored); err != nil {
+		return nil, err
+	}
+	if err := checkDatabase(filepath.Join(dataDir, DatabaseFile), manifest.SchemaVersion); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// prepareDir creates dataDir, or makes sure it is empty if it exists, and
+// reports whether it was created
+func prepareDir(dataDir string) (bool, error) {
+	entries, err := os.ReadDir(dataDir)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(dataDir, 0755); err != nil {
+			return false, fmt.Errorf("error creating directory %s: %v", dataDir, err)
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error reading directory %s: %v", dataDir, err)
+	}
+	if len(entries) > 0 {
+		return false, fmt.Errorf("%s is not empty", dataDir)
+	}
+	return false, nil
+}
+
+// restoreDatabase writes the database entry to dbPath
+func restoreDatabase(r io.Reader, dbPath string) (*FileEntry, error) {
+	f, err := os.OpenFile(dbPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error creating database: %v", err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, hash), r)
+	if err != nil {
+		return nil, fmt.Errorf("error restoring database: %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		return nil, fmt.Errorf("error restoring database: %v", err)
+	}
+	return &FileEntry{Size: n, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// verify checks that what was restored is exactly what the manifest lists
+func verify(manifest *Manifest, database *FileEntry, restored map[string]FileEntry) error {
+	if manifest == nil {
+		return fmt.Errorf("archive has no manifest")
+	}
+	if manifest.Version != ManifestVersion {
+		return fmt.Errorf("unsupported backup version %d", manifest.Version)
+	}
+	if database == nil {
+		return fmt.Errorf("archive has no database")
+	}
+	if *database != manifest.Database {
+		return fmt.Errorf("database does not match the manifest")
+	}
+
+	for _, want := range manifest.Files {
+		got, ok := restored[want.Key]
+		if !ok {
+			return fmt.Errorf("archive is missing %s", want.Key)
+		}
+		if got != want {
+			return fmt.Errorf("%s does not match the manifest", want.Key)
+		}
+		delete(restored, want.Key)
+	}
+	for key := range restored {
+		return fmt.Errorf("%s is not in the manifest", key)
+	}
+	return nil
+}
+
+// checkDatabase makes sure a restored database is intact and that this
+// server can run against it
+func checkDatabase(dbPath string, schemaVersion int) error {
+	restored, err := openDatabase(dbPath)
+	if err != nil {
+		return err
+	}
+	defer restored.Close()
+
+	problems, err := restored.IntegrityCheck()
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("restored database is corrupt: %s", strings.Join(problems, "; "))
+	}
+
+	version, err := restored.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version != schemaVersion {
+		return fmt.Errorf("database schema version %d does not match the manifest's %d", version, schemaVersion)
+	}
+	latest, err := sqlite.LatestVersion()
+	if err != nil {
+		return err
+	}
+	if version > latest {
+		return fmt.Errorf("backup has schema version %d, newer than this server's %d", version, latest)
+	}
+	return nil
+}
+
+// openDatabase opens a standalone database file with a single connection
+func openDatabase(dbPath string) (*sqlite.DB, error) {
+	opts := sqlite.DefaultOptions()
+	opts.JournalMode = "DELETE"
+	opts.MaxReaders = 0
+	return sqlite.NewDB(dbPath, opts)
+}
+
+// validKey reports whether an archived file name is a storage key that
+// stays inside the uploads directory
+func validKey(key string) bool {
+	if key == "" || strings.Contains(key, "\\") || path.IsAbs(key) || path.Clean(key) != key {
+		return false
+	}
+	return key != ".." && !strings.HasPrefix(key, "../")
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
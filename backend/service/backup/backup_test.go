@@ -0,0 +1,293 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/domain/models"
+	"backend/repository/sqlite"
+	"backend/service/storage"
+)
+
+// stored are the files newBackup writes for the rows it saves
+var stored = map[string]string{
+	"pdfs/b1.pdf":      "%PDF-1.4 book",
+	"audio/s1.mp3":     "ID3 audio",
+	"covers/b1.jpg":    "JFIF cover",
+	"covers/other.jpg": "not referenced",
+}
+
+// newBackup creates an archive of a database with one book and segment and
+// the files they refer to, one of which is missing from storage
+func newBackup(t *testing.T) ([]byte, *Manifest) {
+	t.Helper()
+	dir := t.TempDir()
+
+	db, err := sqlite.NewDB(filepath.Join(dir, "source.db"), sqlite.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.InitDB(); err != nil {
+		t.Fatal(err)
+	}
+
+	backend, err := storage.NewLocalBackend(filepath.Join(dir, "uploads"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := storage.NewFileStorage(dir, backend, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, content := range stored {
+		if err := backend.Put(context.Background(), key, strings.NewReader(content), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	book := &models.Book{
+		ID: "b1", Title: "Emma", FileKey: "pdfs/b1.pdf", CoverKey: "covers/b1.jpg",
+		Status: models.BookStatusReady, CreatedAt: now, UpdatedAt: now,
+	}
+	if err := db.SaveBook(book); err != nil {
+		t.Fatal(err)
+	}
+	segments := []models.AudioSegment{
+		{ID: "s1", BookID: "b1", SegmentNumber: 1, Content: "One", AudioKey: "audio/s1.mp3"},
+		{ID: "s2", BookID: "b1", SegmentNumber: 2, Content: "Two", AudioKey: "audio/gone.mp3"},
+	}
+	for _, segment := range segments {
+		segment.Status = models.SegmentStatusCompleted
+		segment.CreatedAt, segment.UpdatedAt = now, now
+		if err := db.SaveAudioSegment(&segment); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	manifest, err := Create(context.Background(), db, files, &buf)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return buf.Bytes(), manifest
+}
+
+// rewrite repacks an archive, passing each entry through edit. Entries for
+// which edit returns false are dropped, and extra entries are appended.
+func rewrite(t *testing.T, archive []byte, edit func(name string, data []byte) ([]byte, bool), extra map[string]string) []byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	write := func(name string, data []byte) {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, keep := edit(header.Name, data); keep {
+			write(header.Name, data)
+		}
+	}
+	for name, data := range extra {
+		write(name, []byte(data))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	archive, created := newBackup(t)
+
+	if len(created.Files) != 3 {
+		t.Errorf("manifest files = %+v, want the PDF, audio and cover", created.Files)
+	}
+	if len(created.Missing) != 1 || created.Missing[0] != "audio/gone.mp3" {
+		t.Errorf("manifest missing = %v, want audio/gone.mp3", created.Missing)
+	}
+	latest, err := sqlite.LatestVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.SchemaVersion != latest {
+		t.Errorf("schema version = %d, want %d", created.SchemaVersion, latest)
+	}
+
+	dataDir := filepath.Join(t.TempDir(), "restored")
+	manifest, err := Restore(bytes.NewReader(archive), dataDir)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if manifest.Database != created.Database || len(manifest.Files) != len(created.Files) {
+		t.Errorf("restored manifest = %+v, want %+v", manifest, created)
+	}
+
+	// Referenced files come back under their keys; others are left behind
+	for key, content := range stored {
+		data, err := os.ReadFile(filepath.Join(dataDir, UploadsDir, filepath.FromSlash(key)))
+		if key == "covers/other.jpg" {
+			if !os.IsNotExist(err) {
+				t.Errorf("unreferenced %s was restored", key)
+			}
+			continue
+		}
+		if err != nil || string(data) != content {
+			t.Errorf("restored %s = %q, %v; want %q", key, data, err, content)
+		}
+	}
+
+	db, err := sqlite.NewDB(filepath.Join(dataDir, DatabaseFile), sqlite.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	book, err := db.GetBookByID("b1")
+	if err != nil || book.Title != "Emma" || book.FileKey != "pdfs/b1.pdf" {
+		t.Errorf("restored book = %+v, %v", book, err)
+	}
+	if segments, err := db.GetAudioSegments("b1"); err != nil || len(segments) != 2 {
+		t.Errorf("restored segments = %d, %v; want 2", len(segments), err)
+	}
+}
+
+func TestRestoreRejects(t *testing.T) {
+	archive, _ := newBackup(t)
+	keep := func(name string, data []byte) ([]byte, bool) { return data, true }
+
+	tests := []struct {
+		name    string
+		archive []byte
+		want    string
+	}{
+		{
+			name:    "traversal",
+			archive: rewrite(t, archive, keep, map[string]string{FilesDir + "../escaped": "x"}),
+			want:    "invalid file name",
+		},
+		{
+			name:    "absolute path",
+			archive: rewrite(t, archive, keep, map[string]string{FilesDir + "/etc/escaped": "x"}),
+			want:    "invalid file name",
+		},
+		{
+			name: "tampered file",
+			archive: rewrite(t, archive, func(name string, data []byte) ([]byte, bool) {
+				if name == FilesDir+"pdfs/b1.pdf" {
+					data = append([]byte(nil), data...)
+					data[0] ^= 0xFF
+				}
+				return data, true
+			}, nil),
+			want: "pdfs/b1.pdf does not match the manifest",
+		},
+		{
+			name: "tampered database",
+			archive: rewrite(t, archive, func(name string, data []byte) ([]byte, bool) {
+				if name == DatabaseEntry {
+					data = append(append([]byte(nil), data...), 0)
+				}
+				return data, true
+			}, nil),
+			want: "database does not match the manifest",
+		},
+		{
+			name: "missing file",
+			archive: rewrite(t, archive, func(name string, data []byte) ([]byte, bool) {
+				return data, name != FilesDir+"audio/s1.mp3"
+			}, nil),
+			want: "archive is missing audio/s1.mp3",
+		},
+		{
+			name:    "unlisted file",
+			archive: rewrite(t, archive, keep, map[string]string{FilesDir + "audio/extra.mp3": "x"}),
+			want:    "audio/extra.mp3 is not in the manifest",
+		},
+		{
+			name: "missing manifest",
+			archive: rewrite(t, archive, func(name string, data []byte) ([]byte, bool) {
+				return data, name != ManifestEntry
+			}, nil),
+			want: "archive has no manifest",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			dataDir := filepath.Join(parent, "restored")
+			_, err := Restore(bytes.NewReader(tt.archive), dataDir)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Restore = %v, want error containing %q", err, tt.want)
+			}
+
+			// Nothing is left behind, inside the data directory or beside it
+			if _, err := os.Stat(dataDir); !os.IsNotExist(err) {
+				t.Errorf("%s left after a failed restore", dataDir)
+			}
+			if entries, _ := os.ReadDir(parent); len(entries) != 0 {
+				t.Errorf("files left beside the data directory: %v", entries)
+			}
+		})
+	}
+}
+
+func TestRestoreKeepsExistingDirectory(t *testing.T) {
+	archive, _ := newBackup(t)
+
+	dataDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dataDir, "notes.txt"), []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Restore(bytes.NewReader(archive), dataDir); err == nil || !strings.Contains(err.Error(), "not empty") {
+		t.Fatalf("Restore into a non-empty directory = %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dataDir, "notes.txt")); err != nil || string(data) != "mine" {
+		t.Errorf("existing file = %q, %v", data, err)
+	}
+
+	// An empty directory is kept, but emptied again when the restore fails
+	empty := t.TempDir()
+	broken := rewrite(t, archive, func(name string, data []byte) ([]byte, bool) {
+		return data, name != ManifestEntry
+	}, nil)
+	if _, err := Restore(bytes.NewReader(broken), empty); err == nil {
+		t.Fatal("Restore without a manifest succeeded")
+	}
+	if entries, err := os.ReadDir(empty); err != nil || len(entries) != 0 {
+		t.Errorf("directory after a failed restore = %v, %v; want it empty", entries, err)
+	}
+}
@@ -0,0 +1,325 @@
+package cover
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// ErrNoCover is returned when a document has no usable cover image
+var ErrNoCover = errors.New("no cover image found")
+
+// minDimension is the smallest image, in pixels on each side, taken as a
+// cover. Smaller first-page images are usually logos or decorations.
+const minDimension = 100
+
+// maxCoverBytes bounds how much of an encoded cover is read from a document.
+// Sizes in a document are chosen by whoever uploaded it, so none is trusted.
+const maxCoverBytes = 20 << 20
+
+// Image is an encoded cover image extracted from a document
+type Image struct {
+	Data     []byte
+	Filename string // name with the extension of the image format
+}
+
+// Extract returns the cover image of a PDF or EPUB file. PDFs use the
+// largest image embedded in the first page; EPUBs use the image their
+// package declares as the cover.
+func Extract(filePath string) (*Image, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening document: %v", err)
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return nil, fmt.Errorf("error reading document: %v", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("%PDF")):
+		return extractPDF(filePath)
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		return extractEPUB(filePath)
+	}
+	return nil, fmt.Errorf("unsupported document type")
+}
+
+// extractPDF returns the largest image drawn on the first page of a PDF
+func extractPDF(filePath string) (img *Image, err error) {
+	// The PDF reader panics on streams it cannot parse
+	defer func() {
+		if r := recover(); r != nil {
+			img, err = nil, fmt.Errorf("error reading PDF images: %v", r)
+		}
+	}()
+
+	f, reader, err := pdf.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening PDF: %v", err)
+	}
+	defer f.Close()
+
+	if reader.NumPage() == 0 {
+		return nil, ErrNoCover
+	}
+	page := reader.Page(1)
+	if page.V.IsNull() {
+		return nil, ErrNoCover
+	}
+	encrypted := !reader.Trailer().Key("Encrypt").IsNull()
+
+	var best pdf.Value
+	var bestArea int64
+	xobjects := page.Resources().Key("XObject")
+	for _, name := range xobjects.Keys() {
+		xobj := xobjects.Key(name)
+		if xobj.Key("Subtype").Name() != "Image" {
+			continue
+		}
+		width, height := xobj.Key("Width").Int64(), xobj.Key("Height").Int64()
+		if width < minDimension || height < minDimension || width > maxPixels/height {
+			continue
+		}
+		if area := width * height; area > bestArea {
+			best, bestArea = xobj, area
+		}
+	}
+	if bestArea == 0 {
+		return nil, ErrNoCover
+	}
+
+	switch imageFilter(best) {
+	case "DCTDecode":
+		// JPEG data is stored as is, but the reader cannot return it undecoded
+		if encrypted {
+			return nil, ErrNoCover
+		}
+		data, err := rawStream(f, best)
+		if err != nil {
+			return nil, err
+		}
+		return &Image{Data: data, Filename: "cover.jpg"}, nil
+	case "", "FlateDecode":
+		return decodeRawImage(best)
+	}
+	return nil, ErrNoCover
+}
+
+// imageFilter returns the only filter applied to an image stream, or "" when
+// it is unfiltered. Chained filters are reported as unsupported.
+func imageFilter(v pdf.Value) string {
+	filter := v.Key("Filter")
+	switch filter.Kind() {
+	case pdf.Name:
+		return filter.Name()
+	case pdf.Array:
+		if filter.Len() == 1 {
+			return filter.Index(0).Name()
+		}
+		return "unsupported"
+	}
+	return ""
+}
+
+// rawStream reads a stream's bytes without applying its filters. The reader
+// only exposes a stream's file offset through its string form, "<<...>>@offset".
+func rawStream(f io.ReaderAt, v pdf.Value) ([]byte, error) {
+	s := v.String()
+	at := strings.LastIndex(s, "@")
+	if at < 0 {
+		return nil, fmt.Errorf("error locating image stream")
+	}
+	offset, err := strconv.ParseInt(s[at+1:], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error locating image stream: %v", err)
+	}
+
+	length := v.Key("Length").Int64()
+	if length <= 0 || length > maxCoverBytes {
+		return nil, ErrNoCover
+	}
+	data, err := io.ReadAll(io.NewSectionReader(f, offset, length))
+	if err != nil {
+		return nil, fmt.Errorf("error reading image stream: %v", err)
+	}
+	if int64(len(data)) != length {
+		return nil, fmt.Errorf("error reading image stream: truncated")
+	}
+	return data, nil
+}
+
+// decodeRawImage converts an 8-bit gray or RGB pixel stream into a JPEG
+func decodeRawImage(v pdf.Value) (*Image, error) {
+	if v.Key("BitsPerComponent").Int64() != 8 {
+		return nil, ErrNoCover
+	}
+
+	var components int
+	switch v.Key("ColorSpace").Name() {
+	case "DeviceGray":
+		components = 1
+	case "DeviceRGB":
+		components = 3
+	default:
+		return nil, ErrNoCover
+	}
+
+	w, h := v.Key("Width").Int64(), v.Key("Height").Int64()
+	if w <= 0 || h <= 0 || w > maxPixels/h {
+		return nil, ErrNoCover
+	}
+	width, height := int(w), int(h)
+	rc := v.Reader()
+	defer rc.Close()
+	pixels := make([]byte, width*height*components)
+	if _, err := io.ReadFull(rc, pixels); err != nil {
+		return nil, fmt.Errorf("error reading image stream: %v", err)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := (y*width + x) * components
+			c := color.RGBA{A: 255}
+			if components == 1 {
+				c.R, c.G, c.B = pixels[i], pixels[i], pixels[i]
+			} else {
+				c.R, c.G, c.B = pixels[i], pixels[i+1], pixels[i+2]
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, fmt.Errorf("error encoding cover: %v", err)
+	}
+	return &Image{Data: buf.Bytes(), Filename: "cover.jpg"}, nil
+}
+
+// epubContainer is META-INF/container.xml, which locates the package document
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// epubPackage is the part of an OPF package document that declares the cover
+type epubPackage struct {
+	Meta []struct {
+		Name    string `xml:"name,attr"`
+		Content string `xml:"content,attr"`
+	} `xml:"metadata>meta"`
+	Items []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+}
+
+// extractEPUB returns the cover image declared by an EPUB's package, using
+// the EPUB 3 cover-image property or the EPUB 2 cover meta element
+func extractEPUB(filePath string) (*Image, error) {
+	zr, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening EPUB: %v", err)
+	}
+	defer zr.Close()
+
+	var container epubContainer
+	if err := readZipXML(&zr.Reader, "META-INF/container.xml", &container); err != nil {
+		return nil, err
+	}
+	if len(container.Rootfiles) == 0 {
+		return nil, fmt.Errorf("error reading EPUB: no package document")
+	}
+	opfPath := container.Rootfiles[0].FullPath
+
+	var pkg epubPackage
+	if err := readZipXML(&zr.Reader, opfPath, &pkg); err != nil {
+		return nil, err
+	}
+
+	coverID := ""
+	for _, meta := range pkg.Meta {
+		if meta.Name == "cover" {
+			coverID = meta.Content
+		}
+	}
+
+	href := ""
+	for _, item := range pkg.Items {
+		if !strings.HasPrefix(item.MediaType, "image/") {
+			continue
+		}
+		if strings.Contains(" "+item.Properties+" ", " cover-image ") {
+			href = item.Href
+			break
+		}
+		if coverID != "" && item.ID == coverID {
+			href = item.Href
+		}
+	}
+	if href == "" {
+		return nil, ErrNoCover
+	}
+
+	// Manifest hrefs are URLs relative to the package document
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	name := path.Join(path.Dir(opfPath), href)
+	rc, err := openZipFile(&zr.Reader, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxCoverBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading EPUB cover: %v", err)
+	}
+	if len(data) > maxCoverBytes {
+		return nil, ErrNoCover
+	}
+	return &Image{Data: data, Filename: path.Base(name)}, nil
+}
+
+func readZipXML(zr *zip.Reader, name string, v interface{}) error {
+	rc, err := openZipFile(zr, name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("error parsing %s: %v", name, err)
+	}
+	return nil
+}
+
+func openZipFile(zr *zip.Reader, name string) (io.ReadCloser, error) {
+	for _, f := range zr.File {
+		if f.Name == name {
+			return f.Open()
+		}
+	}
+	return nil, fmt.Errorf("error reading EPUB: %s not found", name)
+}
@@ -0,0 +1,128 @@
+package cover
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+
+	// Registered for image.Decode
+	_ "image/gif"
+	_ "image/png"
+)
+
+var (
+	// ErrUnsupportedImage is returned for covers that are not JPEG, PNG or GIF images
+	ErrUnsupportedImage = errors.New("unsupported image format")
+	// ErrImageTooLarge is returned for covers with more than maxPixels pixels
+	ErrImageTooLarge = errors.New("image is too large")
+)
+
+// jpegQuality is used for thumbnails and covers converted from raw pixels
+const jpegQuality = 85
+
+// maxPixels is the largest cover decoded, in pixels. Decoding allocates
+// memory for every pixel, so larger images are refused before decoding.
+const maxPixels = 40_000_000
+
+// Thumbnail is a resized cover encoded as JPEG
+type Thumbnail struct {
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// Thumbnails decodes a JPEG, PNG or GIF cover and returns a copy resized to
+// each of the given widths, keeping its aspect ratio, along with the cover's
+// format name. Covers are never scaled up, so widths beyond the original
+// produce one full-size copy.
+func Thumbnails(data []byte, widths []int) ([]Thumbnail, string, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupportedImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > maxPixels/cfg.Height {
+		return nil, "", ErrImageTooLarge
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupportedImage
+	}
+	bounds := src.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return nil, "", ErrUnsupportedImage
+	}
+
+	// Resample from RGBA, the fastest format to read pixels from
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	var thumbs []Thumbnail
+	done := make(map[int]bool)
+	for _, width := range widths {
+		if width <= 0 {
+			continue
+		}
+		if width > rgba.Bounds().Dx() {
+			width = rgba.Bounds().Dx()
+		}
+		if done[width] {
+			continue
+		}
+		done[width] = true
+
+		height := rgba.Bounds().Dy() * width / rgba.Bounds().Dx()
+		if height < 1 {
+			height = 1
+		}
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, resize(rgba, width, height), &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, "", fmt.Errorf("error encoding thumbnail: %v", err)
+		}
+		thumbs = append(thumbs, Thumbnail{Width: width, Height: height, Data: buf.Bytes()})
+	}
+	return thumbs, format, nil
+}
+
+// resize scales src down to width x height by averaging the source pixels
+// that fall within each destination pixel
+func resize(src *image.RGBA, width, height int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if sw == width && sh == height {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, (y+1)*sh/height
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, (x+1)*sw/width
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(src.Pix[i])
+					g += uint32(src.Pix[i+1])
+					b += uint32(src.Pix[i+2])
+					a += uint32(src.Pix[i+3])
+					i += 4
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)})
+		}
+	}
+	return dst
+}
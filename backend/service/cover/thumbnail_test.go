@@ -0,0 +1,50 @@
+package cover
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestThumbnails(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for i := range src.Pix {
+		src.Pix[i] = 0xff
+	}
+	src.SetRGBA(0, 0, color.RGBA{A: 0xff})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	thumbs, format, err := Thumbnails(buf.Bytes(), []int{100, 800, 400})
+	if err != nil {
+		t.Fatalf("Thumbnails: %v", err)
+	}
+	if format != "png" || len(thumbs) != 2 {
+		t.Fatalf("Thumbnails = %d thumbnails of %s, want 2 of png", len(thumbs), format)
+	}
+	if thumbs[0].Width != 100 || thumbs[0].Height != 50 || thumbs[1].Width != 400 || thumbs[1].Height != 200 {
+		t.Errorf("thumbnail sizes = %dx%d, %dx%d", thumbs[0].Width, thumbs[0].Height, thumbs[1].Width, thumbs[1].Height)
+	}
+
+	if _, _, err := Thumbnails([]byte("not an image"), []int{100}); !errors.Is(err, ErrUnsupportedImage) {
+		t.Errorf("Thumbnails of garbage = %v, want ErrUnsupportedImage", err)
+	}
+}
+
+func TestThumbnailsRefusesHugeImages(t *testing.T) {
+	// A GIF header claiming 65535x65535 pixels, about 17 GB once decoded
+	header := []byte("GIF89a")
+	header = binary.LittleEndian.AppendUint16(header, 0xffff)
+	header = binary.LittleEndian.AppendUint16(header, 0xffff)
+	header = append(header, 0, 0, 0, ';')
+
+	if _, _, err := Thumbnails(header, []int{100}); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("Thumbnails of a huge image = %v, want ErrImageTooLarge", err)
+	}
+}
@@ -0,0 +1,82 @@
+package events
+
+import (
+	"time"
+
+	"backend/domain/models"
+)
+
+// SchemaVersion is the version of the event format sent to clients. It is
+// bumped whenever a change would break existing consumers.
+const SchemaVersion = 1
+
+// Event types
+const (
+	TypeBookStatus       = "book.status"
+	TypeBookProgress     = "book.progress"
+	TypeBookStage        = "book.stage"
+	TypeSegmentStarted   = "segment.started"
+	TypeSegmentCompleted = "segment.completed"
+	TypeSegmentFailed    = "segment.failed"
+	TypeSegmentCanceled  = "segment.canceled"
+	TypeChapterReady     = "chapter.ready"
+)
+
+// Event is a book or segment lifecycle notification
+type Event struct {
+	// ID orders the events of a book and is assigned when the event is logged
+	ID      int64       `json:"id,omitempty"`
+	Version int         `json:"v"`
+	Type    string      `json:"type"`
+	BookID  string      `json:"bookId"`
+	Time    time.Time   `json:"time"`
+	Data    interface{} `json:"data"`
+}
+
+// BookStatusData is the payload of a book.status event
+type BookStatusData struct {
+	Status         string `json:"status"`
+	PreviousStatus string `json:"previousStatus,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// StageData is the payload of a book.stage event
+type StageData struct {
+	Stage string `json:"stage"`
+}
+
+// SegmentData is the payload of segment.started, segment.completed,
+// segment.failed and segment.canceled events
+type SegmentData struct {
+	Segment *models.AudioSegment `json:"segment"`
+	Error   string               `json:"error,omitempty"`
+}
+
+// ProgressData is the payload of a book.progress event
+type ProgressData struct {
+	Total     int     `json:"total"`
+	Completed int     `json:"completed"`
+	Failed    int     `json:"failed"`
+	Skipped   int     `json:"skipped"`
+	Percent   float64 `json:"percent"`
+}
+
+// ChapterData is the payload of a chapter.ready event
+type ChapterData struct {
+	Chapter     int     `json:"chapter"`
+	Title       string  `json:"title,omitempty"`
+	FromSegment int     `json:"fromSegment"`
+	ToSegment   int     `json:"toSegment"`
+	Duration    float64 `json:"duration"`
+}
+
+// New creates an event of the given type for a book
+func New(eventType, bookID string, data interface{}) Event {
+	return Event{
+		Version: SchemaVersion,
+		Type:    eventType,
+		BookID:  bookID,
+		Time:    time.Now(),
+		Data:    data,
+	}
+}
@@ -0,0 +1,155 @@
+package events
+
+import (
+	"log"
+	"sync"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before it is dropped
+const subscriberBuffer = 64
+
+// Hub fans events out to the subscribers watching each book. It is safe for
+// concurrent use by processing goroutines and connection handlers.
+type Hub struct {
+	log     Log
+	present Presenter
+
+	// publishMu orders logging and delivery so subscribers see events in ID order
+	publishMu   sync.Mutex
+	mu          sync.RWMutex
+	subscribers map[string]map[*Subscription]struct{}
+}
+
+// Subscription receives the events published for one book
+type Subscription struct {
+	BookID string
+	// C is closed when the subscription ends, either through Close or
+	// because the subscriber fell too far behind
+	C <-chan Event
+
+	ch        chan Event
+	hub       *Hub
+	closeOnce sync.Once
+}
+
+// Presenter prepares an event for delivery to clients, for example by
+// signing the media URLs it refers to
+type Presenter func(Event) Event
+
+// NewHub creates an empty hub. Published events are recorded in log when it
+// is not nil, and passed through present, when it is not nil, as they are
+// delivered or replayed. Only what was published is logged, so signed URLs
+// and other short-lived values added by present are never persisted.
+func NewHub(log Log, present Presenter) *Hub {
+	return &Hub{
+		log:         log,
+		present:     present,
+		subscribers: make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe registers a new subscriber for a book's events
+func (h *Hub) Subscribe(bookID string) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.subscribe(bookID)
+}
+
+// SubscribeFrom registers a new subscriber and returns the logged events
+// published after lastID. No event is both replayed and delivered live, and
+// none is lost between the two.
+func (h *Hub) SubscribeFrom(bookID string, lastID int64) (*Subscription, []Event, error) {
+	h.publishMu.Lock()
+	defer h.publishMu.Unlock()
+
+	var backlog []Event
+	if h.log != nil && lastID > 0 {
+		var err error
+		if backlog, err = h.log.Since(bookID, lastID); err != nil {
+			return nil, nil, err
+		}
+	}
+	for i := range backlog {
+		backlog[i] = h.presented(backlog[i])
+	}
+
+	return h.Subscribe(bookID), backlog, nil
+}
+
+func (h *Hub) subscribe(bookID string) *Subscription {
+	ch := make(chan Event, subscriberBuffer)
+	sub := &Subscription{BookID: bookID, C: ch, ch: ch, hub: h}
+
+	if h.subscribers[bookID] == nil {
+		h.subscribers[bookID] = make(map[*Subscription]struct{})
+	}
+	h.subscribers[bookID][sub] = struct{}{}
+
+	return sub
+}
+
+// Close unregisters the subscription and closes its channel
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		h := s.hub
+		h.mu.Lock()
+		if subs, ok := h.subscribers[s.BookID]; ok {
+			delete(subs, s)
+			if len(subs) == 0 {
+				delete(h.subscribers, s.BookID)
+			}
+		}
+		h.mu.Unlock()
+		close(s.ch)
+	})
+}
+
+// Publish records an event in the log and delivers it to every subscriber of
+// its book without blocking. Subscribers whose buffer is full are
+// disconnected so that one slow client cannot stall processing.
+func (h *Hub) Publish(e Event) {
+	if e.Version == 0 {
+		e.Version = SchemaVersion
+	}
+
+	h.publishMu.Lock()
+	defer h.publishMu.Unlock()
+
+	if h.log != nil {
+		if err := h.log.Append(&e); err != nil {
+			log.Printf("[Events] Error logging %s event for book %s: %v", e.Type, e.BookID, err)
+		}
+	}
+	e = h.presented(e)
+
+	h.mu.RLock()
+	var slow []*Subscription
+	for sub := range h.subscribers[e.BookID] {
+		select {
+		case sub.ch <- e:
+		default:
+			slow = append(slow, sub)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, sub := range slow {
+		log.Printf("[Events] Dropping slow subscriber for book %s", sub.BookID)
+		sub.Close()
+	}
+}
+
+// presented returns an event as it is delivered to clients
+func (h *Hub) presented(e Event) Event {
+	if h.present == nil {
+		return e
+	}
+	return h.present(e)
+}
+
+// Subscribers returns the number of subscribers watching a book
+func (h *Hub) Subscribers(bookID string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subscribers[bookID])
+}
@@ -0,0 +1,72 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"backend/domain/models"
+	"backend/repository"
+)
+
+// Log persists published events so that clients can catch up on what they
+// missed while disconnected
+type Log interface {
+	// Append records an event and assigns its ID
+	Append(e *Event) error
+	// Since returns a book's events with an ID greater than afterID, oldest first
+	Since(bookID string, afterID int64) ([]Event, error)
+}
+
+// DBLog keeps the most recent events of each book in the database
+type DBLog struct {
+	db   repository.Events
+	keep int
+}
+
+// NewDBLog creates a log that keeps up to keep events per book
+func NewDBLog(db repository.Events, keep int) *DBLog {
+	return &DBLog{db: db, keep: keep}
+}
+
+// Append records an event and assigns its ID
+func (l *DBLog) Append(e *Event) error {
+	payload, err := json.Marshal(e.Data)
+	if err != nil {
+		return fmt.Errorf("error encoding event payload: %v", err)
+	}
+
+	record := &models.BookEvent{
+		BookID:    e.BookID,
+		Type:      e.Type,
+		Version:   e.Version,
+		Payload:   payload,
+		CreatedAt: e.Time,
+	}
+	if err := l.db.SaveBookEvent(record, l.keep); err != nil {
+		return err
+	}
+
+	e.ID = record.ID
+	return nil
+}
+
+// Since returns a book's events with an ID greater than afterID, oldest first
+func (l *DBLog) Since(bookID string, afterID int64) ([]Event, error) {
+	records, err := l.db.GetBookEventsSince(bookID, afterID)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, 0, len(records))
+	for _, record := range records {
+		events = append(events, Event{
+			ID:      record.ID,
+			Version: record.Version,
+			Type:    record.Type,
+			BookID:  record.BookID,
+			Time:    record.CreatedAt,
+			Data:    record.Payload,
+		})
+	}
+	return events, nil
+}
@@ -0,0 +1,105 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"backend/domain/models"
+	"backend/repository/sqlite"
+)
+
+// newTestLog returns a log keeping keep events per book, with books b1 and b2
+func newTestLog(t *testing.T, keep int) *DBLog {
+	t.Helper()
+	db, err := sqlite.NewDB(filepath.Join(t.TempDir(), "events.db"), sqlite.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitDB(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"b1", "b2"} {
+		book := &models.Book{ID: id, Title: id, Status: models.BookStatusProcessing, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		if err := db.SaveBook(book); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewDBLog(db, keep)
+}
+
+// payloads returns the encoded payload of each event
+func payloads(t *testing.T, events []Event) []string {
+	t.Helper()
+	var out []string
+	for _, e := range events {
+		payload, err := json.Marshal(e.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, string(payload))
+	}
+	return out
+}
+
+func TestDBLogTrimsToKeep(t *testing.T) {
+	l := newTestLog(t, 3)
+
+	var ids []int64
+	for i := 1; i <= 5; i++ {
+		for _, bookID := range []string{"b1", "b2"} {
+			e := New(TypeBookStage, bookID, StageData{Stage: fmt.Sprint(i)})
+			if err := l.Append(&e); err != nil {
+				t.Fatal(err)
+			}
+			if bookID == "b1" {
+				ids = append(ids, e.ID)
+			}
+		}
+	}
+	for i := 1; i < len(ids); i++ {
+		if ids[i] <= ids[i-1] {
+			t.Fatalf("IDs not increasing: %v", ids)
+		}
+	}
+
+	// Each book keeps its own three most recent events
+	for _, bookID := range []string{"b1", "b2"} {
+		events, err := l.Since(bookID, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := fmt.Sprint(payloads(t, events))
+		if want := `[{"stage":"3"} {"stage":"4"} {"stage":"5"}]`; got != want {
+			t.Errorf("%s events = %s, want %s", bookID, got, want)
+		}
+		for _, e := range events {
+			if e.BookID != bookID || e.Type != TypeBookStage || e.Version != SchemaVersion {
+				t.Errorf("event = %+v", e)
+			}
+		}
+	}
+
+	events, err := l.Since("b1", ids[3])
+	if err != nil || len(events) != 1 || events[0].ID != ids[4] {
+		t.Errorf("Since(%d) = %+v, %v; want only %d", ids[3], events, err, ids[4])
+	}
+}
+
+func TestDBLogKeepsEverythingWithoutLimit(t *testing.T) {
+	l := newTestLog(t, 0)
+
+	for i := 0; i < 10; i++ {
+		e := New(TypeBookStage, "b1", StageData{Stage: fmt.Sprint(i)})
+		if err := l.Append(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if events, err := l.Since("b1", 0); err != nil || len(events) != 10 {
+		t.Errorf("Since = %d events, %v; want 10", len(events), err)
+	}
+}
@@ -0,0 +1,107 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// sseKeepAlive is how often a comment is sent to keep idle proxies from closing the stream
+	sseKeepAlive = 25 * time.Second
+	// sseRetry is the reconnection delay suggested to clients, in milliseconds
+	sseRetry = 3000
+)
+
+// LastEventID returns the ID of the last event a client has seen, taken from
+// the Last-Event-ID header sent by reconnecting EventSource clients or the
+// lastEventId query parameter. It returns zero if neither is set.
+func LastEventID(r *http.Request) int64 {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0
+	}
+	return id
+}
+
+// ServeSSE streams a book's events as Server-Sent Events, replaying the
+// logged events the client missed. It blocks until the client goes away or
+// falls too far behind.
+func ServeSSE(hub *Hub, w http.ResponseWriter, r *http.Request, bookID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sub, backlog, err := hub.SubscribeFrom(bookID, LastEventID(r))
+	if err != nil {
+		log.Printf("[SSE] Error loading events for book %s: %v", bookID, err)
+		http.Error(w, "Error loading events", http.StatusInternalServerError)
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry)
+	for _, event := range backlog {
+		if err := writeSSE(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+	log.Printf("[SSE] New stream established for book: %s", bookID)
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Printf("[SSE] Stream closed for book: %s", bookID)
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := writeSSE(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeSSE writes one event in the text/event-stream format
+func writeSSE(w http.ResponseWriter, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if event.ID > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", event.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
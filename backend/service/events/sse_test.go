@@ -0,0 +1,148 @@
+package events
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readSSE reads n events from a stream, returning their id, event and data lines
+func readSSE(t *testing.T, r *bufio.Reader, n int) [][]string {
+	t.Helper()
+	var events [][]string
+	var fields []string
+	for len(events) < n {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading stream after %d events: %v", len(events), err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && len(fields) > 0:
+			events = append(events, fields)
+			fields = nil
+		case strings.HasPrefix(line, "id: "), strings.HasPrefix(line, "event: "):
+			fields = append(fields, line)
+		case strings.HasPrefix(line, "data: "):
+			// Only the stage is compared; the rest of the payload varies
+			fields = append(fields, line[strings.Index(line, `"data":`):])
+		}
+	}
+	return events
+}
+
+func TestServeSSEReplaysAfterLastEventID(t *testing.T) {
+	l := newTestLog(t, 3)
+	hub := NewHub(l, nil)
+
+	var ids []int64
+	for _, stage := range []string{"one", "two", "three", "four"} {
+		hub.Publish(New(TypeBookStage, "b1", StageData{Stage: stage}))
+		events, err := l.Since("b1", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, events[len(events)-1].ID)
+	}
+	hub.Publish(New(TypeBookStage, "b2", StageData{Stage: "other"}))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeSSE(hub, w, r, "b1")
+	}))
+	defer server.Close()
+
+	connect := func(header, query string) (*bufio.Reader, func()) {
+		req, err := http.NewRequest("GET", server.URL+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header != "" {
+			req.Header.Set("Last-Event-ID", header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		return bufio.NewReader(resp.Body), func() { resp.Body.Close() }
+	}
+	waitForSubscriber := func(want int) {
+		deadline := time.Now().Add(5 * time.Second)
+		for hub.Subscribers("b1") != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("subscribers = %d, want %d", hub.Subscribers("b1"), want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// A reconnecting client gets what it missed, then live events, each once
+	r, closeStream := connect(itoa(ids[1]), "")
+	waitForSubscriber(1)
+	hub.Publish(New(TypeBookStage, "b1", StageData{Stage: "five"}))
+	logged, err := l.Since("b1", ids[3])
+	if err != nil || len(logged) != 1 {
+		t.Fatalf("Since = %+v, %v", logged, err)
+	}
+	got := readSSE(t, r, 3)
+	closeStream()
+	want := [][]string{
+		{"id: " + itoa(ids[2]), "event: book.stage", `"data":{"stage":"three"}}`},
+		{"id: " + itoa(ids[3]), "event: book.stage", `"data":{"stage":"four"}}`},
+		{"id: " + itoa(logged[0].ID), "event: book.stage", `"data":{"stage":"five"}}`},
+	}
+	if strings.Join(flatten(got), "\n") != strings.Join(flatten(want), "\n") {
+		t.Errorf("events =\n%v\nwant\n%v", got, want)
+	}
+	waitForSubscriber(0)
+
+	// Events trimmed from the log are gone; the query parameter works too
+	r, closeStream = connect("", "?lastEventId=1")
+	got = readSSE(t, r, 3)
+	closeStream()
+	if got[0][1] != "event: book.stage" || got[0][2] != `"data":{"stage":"three"}}` || got[2][2] != `"data":{"stage":"five"}}` {
+		t.Errorf("events after trimmed ID = %v, want three to five", got)
+	}
+}
+
+func TestLastEventID(t *testing.T) {
+	tests := []struct {
+		header string
+		query  string
+		want   int64
+	}{
+		{"", "", 0},
+		{"42", "", 42},
+		{"", "?lastEventId=7", 7},
+		{"42", "?lastEventId=7", 42},
+		{"-3", "", 0},
+		{"abc", "", 0},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/events"+tt.query, nil)
+		if tt.header != "" {
+			r.Header.Set("Last-Event-ID", tt.header)
+		}
+		if got := LastEventID(r); got != tt.want {
+			t.Errorf("LastEventID(%q, %q) = %d, want %d", tt.header, tt.query, got, tt.want)
+		}
+	}
+}
+
+func flatten(events [][]string) []string {
+	var out []string
+	for _, fields := range events {
+		out = append(out, fields...)
+	}
+	return out
+}
+
+func itoa(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
@@ -0,0 +1,103 @@
+package events
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait is the time allowed to write a message to the client
+	writeWait = 10 * time.Second
+	// pongWait is the time allowed to read the next pong from the client
+	pongWait = 60 * time.Second
+	// pingPeriod must be shorter than pongWait so pings arrive in time
+	pingPeriod = pongWait * 9 / 10
+	// maxMessageSize limits what clients may send; they are not expected to send anything but control frames
+	maxMessageSize = 4096
+)
+
+// ServeWebSocket streams a book's events over an upgraded connection,
+// starting with the logged events published after lastID. It blocks until
+// the client disconnects, stops answering pings or falls too far behind, and
+// closes the connection before returning.
+func ServeWebSocket(hub *Hub, conn *websocket.Conn, bookID string, lastID int64) {
+	sub, backlog, err := hub.SubscribeFrom(bookID, lastID)
+	if err != nil {
+		log.Printf("[WS] Error loading events for book %s: %v", bookID, err)
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, ""))
+		conn.Close()
+		return
+	}
+	log.Printf("[WS] New connection established for book: %s", bookID)
+
+	done := make(chan struct{})
+	go func() {
+		writePump(conn, sub, backlog)
+		close(done)
+	}()
+
+	readPump(conn)
+
+	// The client is gone: stop the writer and wait for it to close the socket
+	sub.Close()
+	<-done
+	log.Printf("[WS] Connection closed for book: %s", bookID)
+}
+
+// readPump consumes client frames so that pongs and close frames are
+// processed, returning once the connection fails or is closed
+func readPump(conn *websocket.Conn) {
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("[WS] Read error: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// writePump is the only goroutine that writes to the connection
+func writePump(conn *websocket.Conn, sub *Subscription, backlog []Event) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+
+	for _, event := range backlog {
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := conn.WriteJSON(event); err != nil {
+			log.Printf("[WS] Error replaying event: %v", err)
+			return
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-sub.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			if err := conn.WriteJSON(event); err != nil {
+				log.Printf("[WS] Error sending event: %v", err)
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
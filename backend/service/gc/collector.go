@@ -0,0 +1,229 @@
+package gc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"backend/domain/models"
+	"backend/repository"
+	"backend/service/hls"
+	"backend/service/storage"
+)
+
+// prefixes are the parts of storage the collector reconciles. Other keys,
+// such as the local PDF cache, are never touched.
+var prefixes = []string{storage.PDFPrefix, storage.CoverPrefix, storage.AudioPrefix}
+
+// Orphan is a stored file that nothing in the database references
+type Orphan struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// Report describes a collection run
+type Report struct {
+	DryRun      bool      `json:"dryRun"`
+	Scanned     int       `json:"scanned"`
+	Referenced  int       `json:"referenced"`
+	Recent      int       `json:"recent"`
+	Orphans     []Orphan  `json:"orphans"`
+	OrphanBytes int64     `json:"orphanBytes"`
+	Deleted     int       `json:"deleted"`
+	Errors      []string  `json:"errors,omitempty"`
+	StartedAt   time.Time `json:"startedAt"`
+	FinishedAt  time.Time `json:"finishedAt"`
+}
+
+// Store is what the Collector reads references from and deletes rows through
+type Store interface {
+	repository.FileReferences
+	DeleteBook(id string) error
+	DeleteAudioSegment(id string) error
+}
+
+// Collector deletes stored files that are no longer referenced by any book or segment
+type Collector struct {
+	db       Store
+	files    *storage.FileStorage
+	packager *hls.Packager
+	grace    time.Duration
+
+	// mu allows one run at a time
+	mu sync.Mutex
+}
+
+// NewCollector creates a Collector. Files modified within grace are kept
+// even when unreferenced, since audio is written before its segment is saved.
+func NewCollector(db Store, files *storage.FileStorage, packager *hls.Packager, grace time.Duration) *Collector {
+	return &Collector{
+		db:       db,
+		files:    files,
+		packager: packager,
+		grace:    grace,
+	}
+}
+
+// Run reconciles storage against the database and deletes orphaned files,
+// or only reports them when dryRun is set
+func (c *Collector) Run(ctx context.Context, dryRun bool) (*Report, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	report := &Report{DryRun: dryRun, Orphans: []Orphan{}, StartedAt: time.Now()}
+
+	// Load references before listing so files written meanwhile fall within the grace period
+	referenced, err := c.referencedKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := report.StartedAt.Add(-c.grace)
+	for _, prefix := range prefixes {
+		objects, err := c.files.List(ctx, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %v", prefix, err)
+		}
+
+		for _, obj := range objects {
+			report.Scanned++
+			if referenced[obj.Key] {
+				report.Referenced++
+				continue
+			}
+			if obj.ModTime.After(cutoff) {
+				report.Recent++
+				continue
+			}
+
+			report.Orphans = append(report.Orphans, Orphan{Key: obj.Key, Size: obj.Size, ModTime: obj.ModTime})
+			report.OrphanBytes += obj.Size
+			if dryRun {
+				continue
+			}
+			if err := c.files.Delete(ctx, obj.Key); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", obj.Key, err))
+				continue
+			}
+			report.Deleted++
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// Schedule runs the collector every interval until ctx is done
+func (c *Collector) Schedule(ctx context.Context, interval time.Duration, dryRun bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := c.Run(ctx, dryRun)
+		if err != nil {
+			log.Printf("[GC] Error collecting orphaned files: %v", err)
+			continue
+		}
+		if dryRun {
+			log.Printf("[GC] Found %d orphaned files (%d bytes) in %d scanned, dry run", len(report.Orphans), report.OrphanBytes, report.Scanned)
+			continue
+		}
+		log.Printf("[GC] Deleted %d of %d orphaned files (%d bytes) in %d scanned", report.Deleted, len(report.Orphans), report.OrphanBytes, report.Scanned)
+		for _, e := range report.Errors {
+			log.Printf("[GC] Error deleting %s", e)
+		}
+	}
+}
+
+// DeleteBook deletes a book with its segments and other rows, then the
+// files they referenced that nothing else refers to
+func (c *Collector) DeleteBook(ctx context.Context, bookID string) error {
+	refs, err := c.db.GetBookFileReferences(bookID)
+	if err != nil {
+		return err
+	}
+	if err := c.db.DeleteBook(bookID); err != nil {
+		return err
+	}
+
+	if err := c.packager.RemoveBook(bookID); err != nil {
+		log.Printf("[GC] Error removing HLS files of book %s: %v", bookID, err)
+	}
+	return c.Release(ctx, refs)
+}
+
+// DeleteSegment deletes a segment and its audio file, unless another row still refers to it
+func (c *Collector) DeleteSegment(ctx context.Context, segment *models.AudioSegment) error {
+	if err := c.db.DeleteAudioSegment(segment.ID); err != nil {
+		return err
+	}
+
+	if err := c.packager.Remove(segment.BookID, segment.ID); err != nil {
+		log.Printf("[GC] Error removing HLS file of segment %s: %v", segment.ID, err)
+	}
+	return c.Release(ctx, []string{segment.AudioKey, segment.AudioURL})
+}
+
+// ReleaseBookFile deletes a source file a book no longer refers to. The
+// book's own download key counts as referenced for as long as the book
+// exists, so it is deleted outright; callers must make sure no download into
+// it is in progress.
+func (c *Collector) ReleaseBookFile(ctx context.Context, bookID, key string) error {
+	if key == "" {
+		return nil
+	}
+	if key != storage.BookPDFKey(bookID) {
+		return c.Release(ctx, []string{key})
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.files.Delete(ctx, key)
+}
+
+// Release deletes the files behind refs that are no longer referenced
+func (c *Collector) Release(ctx context.Context, refs []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	referenced, err := c.referencedKeys()
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		key, err := c.files.KeyFor(ref)
+		if err != nil || referenced[key] {
+			continue
+		}
+		if err := c.files.Delete(ctx, key); err != nil {
+			log.Printf("[GC] Error deleting %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// referencedKeys returns the storage keys of every file the database refers to
+func (c *Collector) referencedKeys() (map[string]bool, error) {
+	refs, err := c.db.GetFileReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		if key, err := c.files.KeyFor(ref); err == nil {
+			keys[key] = true
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,232 @@
+package gc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/domain/models"
+	"backend/repository/sqlite"
+	"backend/service/hls"
+	"backend/service/storage"
+)
+
+const grace = time.Hour
+
+// fixture is a database and storage shared by two books
+type fixture struct {
+	db        *sqlite.DB
+	backend   *storage.LocalBackend
+	files     *storage.FileStorage
+	collector *Collector
+}
+
+// newFixture stores book b1 with a PDF, cover and two segments, and book b2
+// whose segment shares b1's first audio file. Every file is older than the
+// grace period unless touched again.
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	dir := t.TempDir()
+
+	db, err := sqlite.NewDB(filepath.Join(dir, "gc.db"), sqlite.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitDB(); err != nil {
+		t.Fatal(err)
+	}
+
+	backend, err := storage.NewLocalBackend(filepath.Join(dir, "uploads"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := storage.NewFileStorage(dir, backend, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packager, err := hls.NewPackager(filepath.Join(dir, "hls"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fixture{db: db, backend: backend, files: files, collector: NewCollector(db, files, packager, grace)}
+
+	now := time.Now()
+	books := []*models.Book{
+		{ID: "b1", Title: "Dune", FileKey: "pdfs/b1.pdf", CoverKey: "covers/b1.jpg", Status: models.BookStatusReady, CreatedAt: now, UpdatedAt: now},
+		{ID: "b2", Title: "Emma", Status: models.BookStatusReady, CreatedAt: now, UpdatedAt: now},
+	}
+	for _, book := range books {
+		if err := db.SaveBook(book); err != nil {
+			t.Fatal(err)
+		}
+	}
+	segments := []models.AudioSegment{
+		{ID: "s1", BookID: "b1", SegmentNumber: 1, AudioKey: "audio/s1.mp3"},
+		{ID: "s2", BookID: "b1", SegmentNumber: 2, AudioURL: "/audio/s2.mp3"},
+		{ID: "s3", BookID: "b2", SegmentNumber: 1, AudioKey: "audio/s1.mp3"},
+	}
+	for _, segment := range segments {
+		segment.Content, segment.Status = "text", models.SegmentStatusCompleted
+		segment.CreatedAt, segment.UpdatedAt = now, now
+		if err := db.SaveAudioSegment(&segment); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, key := range []string{"pdfs/b1.pdf", "covers/b1.jpg", "audio/s1.mp3", "audio/s2.mp3"} {
+		f.put(t, key, now.Add(-2*grace))
+	}
+	return f
+}
+
+// put stores a file with the given modification time
+func (f *fixture) put(t *testing.T, key string, modTime time.Time) {
+	t.Helper()
+	if err := f.backend.Put(context.Background(), key, strings.NewReader(key), ""); err != nil {
+		t.Fatal(err)
+	}
+	p, err := f.backend.Path(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(p, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// keys returns the stored keys under the collected prefixes and "other/"
+func (f *fixture) keys(t *testing.T) []string {
+	t.Helper()
+	var keys []string
+	for _, prefix := range append(prefixes, "other/") {
+		objects, err := f.files.List(context.Background(), prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, obj := range objects {
+			keys = append(keys, obj.Key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func orphanKeys(report *Report) []string {
+	var keys []string
+	for _, orphan := range report.Orphans {
+		keys = append(keys, orphan.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestRun(t *testing.T) {
+	f := newFixture(t)
+	old := time.Now().Add(-2 * grace)
+	f.put(t, "audio/orphan.mp3", old)
+	f.put(t, "covers/orphan.jpg", old)
+	f.put(t, "pdfs/orphan.pdf", old)
+	f.put(t, "audio/recent.mp3", time.Now().Add(-grace/2))
+	f.put(t, "other/old.txt", old)
+	all := f.keys(t)
+	orphans := []string{"audio/orphan.mp3", "covers/orphan.jpg", "pdfs/orphan.pdf"}
+
+	// A dry run reports orphans without deleting anything
+	report, err := f.collector.Run(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !report.DryRun || report.Scanned != 8 || report.Referenced != 4 || report.Recent != 1 || report.Deleted != 0 {
+		t.Errorf("dry run report = %+v", report)
+	}
+	if got := orphanKeys(report); strings.Join(got, " ") != strings.Join(orphans, " ") {
+		t.Errorf("dry run orphans = %v, want %v", got, orphans)
+	}
+	if report.OrphanBytes != int64(len(strings.Join(orphans, ""))) {
+		t.Errorf("orphan bytes = %d", report.OrphanBytes)
+	}
+	if got := f.keys(t); strings.Join(got, " ") != strings.Join(all, " ") {
+		t.Errorf("dry run deleted files: %v, want %v", got, all)
+	}
+
+	// A real run deletes only old orphans under the collected prefixes
+	report, err = f.collector.Run(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if report.DryRun || report.Deleted != 3 || len(report.Errors) != 0 {
+		t.Errorf("report = %+v", report)
+	}
+	want := []string{"audio/recent.mp3", "audio/s1.mp3", "audio/s2.mp3", "covers/b1.jpg", "other/old.txt", "pdfs/b1.pdf"}
+	if got := f.keys(t); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("files after Run = %v, want %v", got, want)
+	}
+
+	// Once out of its grace period the unreferenced recent file goes too
+	f.collector.grace = grace / 4
+	if report, err = f.collector.Run(context.Background(), false); err != nil || report.Deleted != 1 {
+		t.Errorf("Run after grace = %+v, %v; want the recent file deleted", report, err)
+	}
+}
+
+func TestDeleteBook(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	progress := &models.ReadingProgress{ID: "p1", BookID: "b1", UserID: "user-1", CurrentPage: 3}
+	if err := f.db.UpdateReadingProgress(progress); err != nil {
+		t.Fatal(err)
+	}
+	bookmark := &models.Bookmark{ID: "m1", BookID: "b1", UserID: "user-1", PageNumber: 3, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := f.db.CreateBookmark(bookmark); err != nil {
+		t.Fatal(err)
+	}
+	hlsFile := f.collector.packager.SegmentPath("b1", "s1")
+	if err := os.MkdirAll(filepath.Dir(hlsFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(hlsFile, []byte("ts"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.collector.DeleteBook(ctx, "b1"); err != nil {
+		t.Fatalf("DeleteBook: %v", err)
+	}
+
+	if _, err := f.db.GetBookByID("b1"); err == nil {
+		t.Error("book left after DeleteBook")
+	}
+	if segments, _ := f.db.GetAudioSegments("b1"); len(segments) != 0 {
+		t.Errorf("%d segments left after DeleteBook", len(segments))
+	}
+	if _, err := f.db.GetReadingProgress("b1", "user-1"); err == nil {
+		t.Error("reading progress left after DeleteBook")
+	}
+	if bookmarks, _ := f.db.GetBookmarks("b1", "user-1"); len(bookmarks) != 0 {
+		t.Errorf("%d bookmarks left after DeleteBook", len(bookmarks))
+	}
+	if _, err := os.Stat(hlsFile); !os.IsNotExist(err) {
+		t.Errorf("HLS file left after DeleteBook: %v", err)
+	}
+
+	// Files only the book referred to are released; shared audio is kept
+	if got, want := strings.Join(f.keys(t), " "), "audio/s1.mp3"; got != want {
+		t.Errorf("files after DeleteBook = %s, want %s", got, want)
+	}
+	if segments, _ := f.db.GetAudioSegments("b2"); len(segments) != 1 {
+		t.Errorf("DeleteBook removed another book's segments")
+	}
+
+	// Deleting the last reference releases the shared file
+	if err := f.collector.DeleteBook(ctx, "b2"); err != nil {
+		t.Fatalf("DeleteBook: %v", err)
+	}
+	if keys := f.keys(t); len(keys) != 0 {
+		t.Errorf("files after deleting both books = %v", keys)
+	}
+}
@@ -0,0 +1,105 @@
+package hls
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Packager re-muxes segment audio into MPEG-TS files suitable for HLS
+type Packager struct {
+	dir        string
+	ffmpegPath string
+}
+
+// NewPackager creates a Packager that writes into dir. If ffmpeg cannot be
+// found the packager is disabled and playlists reference the original files,
+// which HLS players accept as packed audio for MP3 and AAC.
+func NewPackager(dir, ffmpegPath string) (*Packager, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating hls directory: %v", err)
+	}
+
+	if ffmpegPath == "" {
+		ffmpegPath = "ffmpeg"
+	}
+	path, err := exec.LookPath(ffmpegPath)
+	if err != nil {
+		log.Printf("[HLS] ffmpeg not found, segments will be served without re-muxing")
+		path = ""
+	}
+
+	return &Packager{dir: dir, ffmpegPath: path}, nil
+}
+
+// Enabled reports whether segments are re-muxed to MPEG-TS
+func (p *Packager) Enabled() bool {
+	return p.ffmpegPath != ""
+}
+
+// SegmentPath returns the path of the packaged file for a segment
+func (p *Packager) SegmentPath(bookID, segmentID string) string {
+	return filepath.Join(p.dir, bookID, segmentID+".ts")
+}
+
+// Exists reports whether a packaged file is present for a segment
+func (p *Packager) Exists(bookID, segmentID string) bool {
+	_, err := os.Stat(p.SegmentPath(bookID, segmentID))
+	return err == nil
+}
+
+// Package re-muxes a segment's audio into MPEG-TS. MP3 and AAC are copied
+// as-is and any other codec is encoded to AAC, since HLS cannot carry it in TS.
+func (p *Packager) Package(bookID, segmentID string, data []byte, codec string) error {
+	if !p.Enabled() {
+		return nil
+	}
+
+	outPath := p.SegmentPath(bookID, segmentID)
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return fmt.Errorf("error creating hls directory: %v", err)
+	}
+
+	codecArgs := []string{"-c:a", "copy"}
+	if codec != "mp3" && codec != "aac" {
+		codecArgs = []string{"-c:a", "aac", "-b:a", "128k"}
+	}
+
+	args := []string{"-hide_banner", "-loglevel", "error", "-y", "-i", "pipe:0"}
+	args = append(args, codecArgs...)
+	args = append(args, "-f", "mpegts", outPath)
+
+	cmd := exec.Command(p.ffmpegPath, args...)
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(outPath)
+		return fmt.Errorf("error re-muxing segment %s: %v: %s", segmentID, err, stderr.String())
+	}
+
+	return nil
+}
+
+// Remove deletes the packaged file for a segment, if any
+func (p *Packager) Remove(bookID, segmentID string) error {
+	err := os.Remove(p.SegmentPath(bookID, segmentID))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing hls segment: %v", err)
+	}
+	return nil
+}
+
+// RemoveBook deletes every packaged file of a book
+func (p *Packager) RemoveBook(bookID string) error {
+	if bookID == "" {
+		return nil
+	}
+	if err := os.RemoveAll(filepath.Join(p.dir, bookID)); err != nil {
+		return fmt.Errorf("error removing hls segments: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package hls
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Entry is a single media segment referenced by a playlist
+type Entry struct {
+	URI      string
+	Duration float64
+	Title    string
+}
+
+// Playlist types
+const (
+	// TypeEvent promises that entries are only ever appended
+	TypeEvent = "EVENT"
+	// TypeVOD promises that the playlist never changes
+	TypeVOD = "VOD"
+)
+
+// Playlist is an HLS media playlist for one book
+type Playlist struct {
+	Entries []Entry
+	// Type is TypeEvent, TypeVOD or empty when listed entries may still change
+	Type string
+	// Complete marks the playlist as final so players stop polling for new segments
+	Complete bool
+}
+
+// TargetDuration returns the EXT-X-TARGETDURATION value for the playlist
+func (p *Playlist) TargetDuration() int {
+	target := 1
+	for _, e := range p.Entries {
+		if d := int(math.Ceil(e.Duration)); d > target {
+			target = d
+		}
+	}
+	return target
+}
+
+// Write renders the playlist in m3u8 format.
+//
+// The playlist type is declared only when set, since players rely on it to
+// cache entries they have already seen. EXT-X-ENDLIST is added once the
+// playlist is complete. Each segment is a separately encoded file whose
+// timestamps start at zero, so every segment after the first is preceded by a
+// discontinuity tag.
+func (p *Playlist) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "#EXTM3U")
+	fmt.Fprintln(bw, "#EXT-X-VERSION:3")
+	fmt.Fprintf(bw, "#EXT-X-TARGETDURATION:%d\n", p.TargetDuration())
+	fmt.Fprintln(bw, "#EXT-X-MEDIA-SEQUENCE:0")
+	fmt.Fprintln(bw, "#EXT-X-DISCONTINUITY-SEQUENCE:0")
+	if p.Type != "" {
+		fmt.Fprintf(bw, "#EXT-X-PLAYLIST-TYPE:%s\n", p.Type)
+	}
+	fmt.Fprintln(bw, "#EXT-X-INDEPENDENT-SEGMENTS")
+
+	for i, e := range p.Entries {
+		if i > 0 {
+			fmt.Fprintln(bw, "#EXT-X-DISCONTINUITY")
+		}
+		fmt.Fprintf(bw, "#EXTINF:%.3f,%s\n", e.Duration, e.Title)
+		fmt.Fprintln(bw, e.URI)
+	}
+
+	if p.Complete {
+		fmt.Fprintln(bw, "#EXT-X-ENDLIST")
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,85 @@
+package hls
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPlaylistWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist Playlist
+		want     string
+	}{
+		{
+			name:     "empty",
+			playlist: Playlist{Type: TypeEvent},
+			want: `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:1
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-DISCONTINUITY-SEQUENCE:0
+#EXT-X-PLAYLIST-TYPE:EVENT
+#EXT-X-INDEPENDENT-SEGMENTS
+`,
+		},
+		{
+			name: "complete",
+			playlist: Playlist{
+				Entries: []Entry{
+					{URI: "/hls/b/s1.ts", Duration: 4.2},
+					{URI: "/hls/b/s2.ts", Duration: 9.25, Title: "Chapter 2"},
+				},
+				Type:     TypeVOD,
+				Complete: true,
+			},
+			want: `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-DISCONTINUITY-SEQUENCE:0
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXTINF:4.200,
+/hls/b/s1.ts
+#EXT-X-DISCONTINUITY
+#EXTINF:9.250,Chapter 2
+/hls/b/s2.ts
+#EXT-X-ENDLIST
+`,
+		},
+		{
+			name: "untyped",
+			playlist: Playlist{
+				Entries: []Entry{{URI: "/hls/b/s1.ts", Duration: 3}},
+			},
+			want: `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:3
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-DISCONTINUITY-SEQUENCE:0
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXTINF:3.000,
+/hls/b/s1.ts
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := tt.playlist.Write(&b); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("Write =\n%s\nwant\n%s", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetDuration(t *testing.T) {
+	p := Playlist{Entries: []Entry{{Duration: 0.4}, {Duration: 6.01}, {Duration: 6}}}
+	if got := p.TargetDuration(); got != 7 {
+		t.Errorf("TargetDuration = %d, want 7", got)
+	}
+}
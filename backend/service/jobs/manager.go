@@ -0,0 +1,166 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrRunning is returned when a book already has a processing job
+	ErrRunning = errors.New("book is already being processed")
+	// ErrNotRunning is returned when a book has no processing job
+	ErrNotRunning = errors.New("book is not being processed")
+)
+
+// Kind is the work a job does on its book
+type Kind string
+
+const (
+	// KindProcessing jobs take a book through its statuses
+	KindProcessing Kind = "processing"
+	// KindRegeneration jobs redo segments of a book and leave its status alone
+	KindRegeneration Kind = "regeneration"
+)
+
+// Job is the background processing of one book. It can be paused between
+// units of work and canceled at any time through its context.
+type Job struct {
+	BookID string
+	Kind   Kind
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	paused bool
+	resume chan struct{}
+}
+
+// Context returns a context that is canceled when the job is canceled
+func (j *Job) Context() context.Context {
+	return j.ctx
+}
+
+// Paused reports whether the job has been asked to pause
+func (j *Job) Paused() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.paused
+}
+
+// Wait blocks while the job is paused. It returns the context's error once
+// the job is canceled, and nil when work may continue.
+func (j *Job) Wait() error {
+	for {
+		j.mu.Lock()
+		paused, resume := j.paused, j.resume
+		j.mu.Unlock()
+
+		if !paused {
+			return j.ctx.Err()
+		}
+
+		select {
+		case <-resume:
+		case <-j.ctx.Done():
+			return j.ctx.Err()
+		}
+	}
+}
+
+func (j *Job) pause() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.paused {
+		j.paused = true
+		j.resume = make(chan struct{})
+	}
+}
+
+func (j *Job) unpause() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.paused {
+		j.paused = false
+		close(j.resume)
+	}
+}
+
+// Manager tracks the processing job of each book so it can be paused,
+// resumed or canceled. It is safe for concurrent use.
+type Manager struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewManager creates an empty job manager
+func NewManager() *Manager {
+	return &Manager{jobs: make(map[string]*Job)}
+}
+
+// Start registers a new job for a book. It fails with ErrRunning if the book
+// already has one of any kind. Callers must call Finish when the job's work ends.
+func (m *Manager) Start(bookID string, kind Kind) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.jobs[bookID]; ok {
+		return nil, ErrRunning
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{BookID: bookID, Kind: kind, ctx: ctx, cancel: cancel}
+	m.jobs[bookID] = job
+	return job, nil
+}
+
+// Finish unregisters a job and releases its context
+func (m *Manager) Finish(job *Job) {
+	m.mu.Lock()
+	if m.jobs[job.BookID] == job {
+		delete(m.jobs, job.BookID)
+	}
+	m.mu.Unlock()
+
+	job.cancel()
+}
+
+// Get returns the job processing a book, if any
+func (m *Manager) Get(bookID string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[bookID]
+	return job, ok
+}
+
+// Pause asks a book's job to stop before its next unit of work
+func (m *Manager) Pause(bookID string) error {
+	job, ok := m.Get(bookID)
+	if !ok {
+		return ErrNotRunning
+	}
+	job.pause()
+	return nil
+}
+
+// Resume lets a paused job continue
+func (m *Manager) Resume(bookID string) error {
+	job, ok := m.Get(bookID)
+	if !ok {
+		return ErrNotRunning
+	}
+	job.unpause()
+	return nil
+}
+
+// Cancel stops a book's job, aborting any request in flight. The job stays
+// registered until its work has wound down and it is finished.
+func (m *Manager) Cancel(bookID string) error {
+	job, ok := m.Get(bookID)
+	if !ok {
+		return ErrNotRunning
+	}
+	job.cancel()
+	return nil
+}
@@ -0,0 +1,147 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitAsync runs job.Wait in the background and returns its result channel
+func waitAsync(job *Job) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- job.Wait() }()
+	return done
+}
+
+func expectBlocked(t *testing.T, done <-chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		t.Fatalf("Wait returned %v while paused", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func expectDone(t *testing.T, done <-chan error, want error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		if !errors.Is(err, want) {
+			t.Fatalf("Wait = %v, want %v", err, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait still blocked")
+	}
+}
+
+func TestStartAndFinish(t *testing.T) {
+	m := NewManager()
+
+	job, err := m.Start("book", KindProcessing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Kind != KindProcessing || job.BookID != "book" {
+		t.Errorf("job = %+v", job)
+	}
+	// A book runs one job at a time whatever its kind
+	if _, err := m.Start("book", KindRegeneration); !errors.Is(err, ErrRunning) {
+		t.Errorf("second Start = %v, want ErrRunning", err)
+	}
+	if got, ok := m.Get("book"); !ok || got != job {
+		t.Errorf("Get = %v, %v", got, ok)
+	}
+
+	m.Finish(job)
+	if _, ok := m.Get("book"); ok {
+		t.Error("job still registered after Finish")
+	}
+	if job.Context().Err() == nil {
+		t.Error("finished job's context not canceled")
+	}
+
+	next, err := m.Start("book", KindRegeneration)
+	if err != nil {
+		t.Fatalf("Start after Finish: %v", err)
+	}
+	// Finishing a stale job leaves the book's new one alone
+	m.Finish(job)
+	if got, _ := m.Get("book"); got != next {
+		t.Error("stale Finish unregistered the new job")
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	m := NewManager()
+	job, _ := m.Start("book", KindProcessing)
+	defer m.Finish(job)
+
+	if err := job.Wait(); err != nil {
+		t.Fatalf("Wait on running job = %v", err)
+	}
+
+	if err := m.Pause("book"); err != nil {
+		t.Fatal(err)
+	}
+	if !job.Paused() {
+		t.Error("Paused = false after Pause")
+	}
+	// Pausing twice is harmless
+	if err := m.Pause("book"); err != nil {
+		t.Fatal(err)
+	}
+	done := waitAsync(job)
+	expectBlocked(t, done)
+
+	if err := m.Resume("book"); err != nil {
+		t.Fatal(err)
+	}
+	expectDone(t, done, nil)
+	if job.Paused() {
+		t.Error("Paused = true after Resume")
+	}
+	if err := m.Resume("book"); err != nil {
+		t.Errorf("Resume of running job = %v", err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	m := NewManager()
+	job, _ := m.Start("book", KindProcessing)
+	defer m.Finish(job)
+
+	m.Pause("book")
+	done := waitAsync(job)
+	expectBlocked(t, done)
+
+	// Canceling releases a paused job
+	if err := m.Cancel("book"); err != nil {
+		t.Fatal(err)
+	}
+	expectDone(t, done, context.Canceled)
+	if err := job.Wait(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait after Cancel = %v", err)
+	}
+
+	// The job stays registered until it is finished
+	if _, ok := m.Get("book"); !ok {
+		t.Error("canceled job unregistered before Finish")
+	}
+	if _, err := m.Start("book", KindProcessing); !errors.Is(err, ErrRunning) {
+		t.Errorf("Start while winding down = %v, want ErrRunning", err)
+	}
+}
+
+func TestNotRunning(t *testing.T) {
+	m := NewManager()
+	for name, call := range map[string]func(string) error{
+		"Pause":  m.Pause,
+		"Resume": m.Resume,
+		"Cancel": m.Cancel,
+	} {
+		if err := call("missing"); !errors.Is(err, ErrNotRunning) {
+			t.Errorf("%s = %v, want ErrNotRunning", name, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package media
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const alphabet = "abcdefghijklmnopqrstuvwxyz"
+
+func TestServeFileRanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "segment.mp3")
+	if err := os.WriteFile(path, []byte(alphabet), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/audio/segment.mp3", nil)
+		for name, value := range header {
+			r.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		ServeFile(w, r, path, "public, max-age=60")
+		return w
+	}
+	etag := serve(nil).Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+
+	tests := []struct {
+		name         string
+		header       map[string]string
+		status       int
+		contentRange string
+		body         string
+	}{
+		{"whole file", nil, http.StatusOK, "", alphabet},
+		{"closed range", map[string]string{"Range": "bytes=2-5"}, http.StatusPartialContent, "bytes 2-5/26", "cdef"},
+		{"open-ended", map[string]string{"Range": "bytes=20-"}, http.StatusPartialContent, "bytes 20-25/26", "uvwxyz"},
+		{"suffix", map[string]string{"Range": "bytes=-3"}, http.StatusPartialContent, "bytes 23-25/26", "xyz"},
+		{"suffix longer than file", map[string]string{"Range": "bytes=-100"}, http.StatusPartialContent, "bytes 0-25/26", alphabet},
+		{"end past the file", map[string]string{"Range": "bytes=24-100"}, http.StatusPartialContent, "bytes 24-25/26", "yz"},
+		{"start past the file", map[string]string{"Range": "bytes=26-"}, http.StatusRequestedRangeNotSatisfiable, "bytes */26", ""},
+		{"range past the file", map[string]string{"Range": "bytes=30-40"}, http.StatusRequestedRangeNotSatisfiable, "bytes */26", ""},
+		{"matching If-Range", map[string]string{"Range": "bytes=0-1", "If-Range": etag}, http.StatusPartialContent, "bytes 0-1/26", "ab"},
+		{"stale If-Range", map[string]string{"Range": "bytes=0-1", "If-Range": `"stale"`}, http.StatusOK, "", alphabet},
+		{"If-None-Match", map[string]string{"If-None-Match": etag}, http.StatusNotModified, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.header)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("Content-Range"); got != tt.contentRange {
+				t.Errorf("Content-Range = %q, want %q", got, tt.contentRange)
+			}
+			if tt.status == http.StatusRequestedRangeNotSatisfiable {
+				return
+			}
+			if got := w.Body.String(); got != tt.body {
+				t.Errorf("body = %q, want %q", got, tt.body)
+			}
+			if got := w.Header().Get("ETag"); got != etag {
+				t.Errorf("ETag = %q, want %q", got, etag)
+			}
+			if got := w.Header().Get("Content-Type"); tt.status != http.StatusNotModified && got != "audio/mpeg" {
+				t.Errorf("Content-Type = %q", got)
+			}
+			if got := w.Header().Get("Cache-Control"); got != "public, max-age=60" {
+				t.Errorf("Cache-Control = %q", got)
+			}
+		})
+	}
+}
+
+func TestServeFileMissing(t *testing.T) {
+	w := httptest.NewRecorder()
+	ServeFile(w, httptest.NewRequest("GET", "/audio/x.mp3", nil), filepath.Join(t.TempDir(), "x.mp3"), "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+}
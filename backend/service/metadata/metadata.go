@@ -0,0 +1,164 @@
+package metadata
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"backend/domain/models"
+)
+
+// Field limits, in characters
+const (
+	MaxTitleLength       = 500
+	MaxAuthorLength      = 300
+	MaxSeriesLength      = 300
+	MaxDescriptionLength = 10000
+)
+
+// languageTag matches BCP 47 style tags such as en, pt-BR or zh-Hant-TW
+var languageTag = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// Patch holds the metadata fields to change. Nil fields are left as they are.
+type Patch struct {
+	Title       *string `json:"title"`
+	Author      *string `json:"author"`
+	Language    *string `json:"language"`
+	Description *string `json:"description"`
+	Series      *string `json:"series"`
+	ISBN        *string `json:"isbn"`
+}
+
+// ValidationError describes a field that failed validation
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s %s", e.Field, e.Message)
+}
+
+// Apply validates the patch and writes its normalized fields to book. The
+// book is left unchanged if any field is invalid.
+func (p Patch) Apply(book *models.Book) error {
+	updated := *book
+
+	if p.Title != nil {
+		title := strings.TrimSpace(*p.Title)
+		if title == "" {
+			return &ValidationError{"title", "must not be empty"}
+		}
+		if err := checkLength("title", title, MaxTitleLength); err != nil {
+			return err
+		}
+		updated.Title = title
+	}
+	if p.Author != nil {
+		author := strings.TrimSpace(*p.Author)
+		if err := checkLength("author", author, MaxAuthorLength); err != nil {
+			return err
+		}
+		updated.Author = author
+	}
+	if p.Language != nil {
+		language, err := NormalizeLanguage(*p.Language)
+		if err != nil {
+			return err
+		}
+		updated.Language = language
+	}
+	if p.Description != nil {
+		description := strings.TrimSpace(*p.Description)
+		if err := checkLength("description", description, MaxDescriptionLength); err != nil {
+			return err
+		}
+		updated.Description = description
+	}
+	if p.Series != nil {
+		series := strings.TrimSpace(*p.Series)
+		if err := checkLength("series", series, MaxSeriesLength); err != nil {
+			return err
+		}
+		updated.Series = series
+	}
+	if p.ISBN != nil {
+		isbn, err := NormalizeISBN(*p.ISBN)
+		if err != nil {
+			return err
+		}
+		updated.ISBN = isbn
+	}
+
+	*book = updated
+	return nil
+}
+
+// NormalizeLanguage checks a language tag and returns it with a lowercase
+// primary subtag
+func NormalizeLanguage(tag string) (string, error) {
+	tag = strings.TrimSpace(tag)
+	if !languageTag.MatchString(tag) {
+		return "", &ValidationError{"language", "must be a language tag such as en or pt-BR"}
+	}
+	parts := strings.SplitN(tag, "-", 2)
+	parts[0] = strings.ToLower(parts[0])
+	return strings.Join(parts, "-"), nil
+}
+
+// NormalizeISBN checks an ISBN-10 or ISBN-13, ignoring spaces and hyphens,
+// and returns its digits. An empty ISBN clears it.
+func NormalizeISBN(isbn string) (string, error) {
+	digits := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(isbn)))
+	switch {
+	case digits == "":
+		return "", nil
+	case len(digits) == 10 && validISBN10(digits):
+		return digits, nil
+	case len(digits) == 13 && validISBN13(digits):
+		return digits, nil
+	}
+	return "", &ValidationError{"isbn", "must be a valid ISBN-10 or ISBN-13"}
+}
+
+// validISBN10 checks the weighted mod 11 checksum, where a final X stands for 10
+func validISBN10(s string) bool {
+	sum := 0
+	for i, c := range s {
+		var d int
+		switch {
+		case c >= '0' && c <= '9':
+			d = int(c - '0')
+		case c == 'X' && i == 9:
+			d = 10
+		default:
+			return false
+		}
+		sum += (10 - i) * d
+	}
+	return sum%11 == 0
+}
+
+// validISBN13 checks the alternating 1 and 3 weighted mod 10 checksum
+func validISBN13(s string) bool {
+	sum := 0
+	for i, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+func checkLength(field, value string, max int) error {
+	if utf8.RuneCountInString(value) > max {
+		return &ValidationError{field, fmt.Sprintf("must be at most %d characters", max)}
+	}
+	return nil
+}
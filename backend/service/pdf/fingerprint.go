@@ -0,0 +1,31 @@
+package pdf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TextFingerprint returns the SHA-256 of a document's text with case,
+// whitespace and punctuation removed, so that re-encoded copies of the same
+// document match. Documents without text have no fingerprint.
+func TextFingerprint(pages []PageText) string {
+	h := sha256.New()
+	var buf [4]byte
+	empty := true
+	for _, page := range pages {
+		for _, r := range page.Text {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				continue
+			}
+			n := utf8.EncodeRune(buf[:], unicode.ToLower(r))
+			h.Write(buf[:n])
+			empty = false
+		}
+	}
+	if empty {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -54,15 +54,36 @@ func ProcessPDF(file io.Reader, filename string) (*models.Book, error) {
 	return book, nil
 }
 
+// PageText is the plain text of a single PDF page
+type PageText struct {
+	PageNumber int
+	Text       string
+}
+
 // ExtractText extracts text from a PDF file page by page
 func ExtractText(filePath string) ([]string, error) {
+	pages, err := ExtractPages(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]string, len(pages))
+	for i, page := range pages {
+		segments[i] = page.Text
+	}
+
+	return segments, nil
+}
+
+// ExtractPages extracts text from a PDF file along with the page each text came from
+func ExtractPages(filePath string) ([]PageText, error) {
 	pdfFile, reader, err := pdf.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("error opening PDF: %v", err)
 	}
 	defer pdfFile.Close()
 
-	var segments []string
+	var pages []PageText
 	for pageNum := 1; pageNum <= reader.NumPage(); pageNum++ {
 		page := reader.Page(pageNum)
 		if page.V.IsNull() {
@@ -74,8 +95,8 @@ func ExtractText(filePath string) ([]string, error) {
 			return nil, fmt.Errorf("error extracting text from page %d: %v", pageNum, err)
 		}
 
-		segments = append(segments, text)
+		pages = append(pages, PageText{PageNumber: pageNum, Text: text})
 	}
 
-	return segments, nil
+	return pages, nil
 }
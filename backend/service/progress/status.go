@@ -0,0 +1,199 @@
+package progress
+
+import (
+	"math"
+	"time"
+
+	"backend/domain/models"
+)
+
+// SegmentCounts counts a book's segments by status. Skipped segments are
+// counted only as skipped, whatever their status.
+type SegmentCounts struct {
+	Total      int `json:"total"`
+	Pending    int `json:"pending"`
+	Processing int `json:"processing"`
+	Completed  int `json:"completed"`
+	Error      int `json:"error"`
+	Skipped    int `json:"skipped"`
+}
+
+// CountSegments tallies segments by status
+func CountSegments(segments []models.AudioSegment) SegmentCounts {
+	counts := SegmentCounts{Total: len(segments)}
+	for _, segment := range segments {
+		if segment.Skip {
+			counts.Skipped++
+			continue
+		}
+		switch segment.Status {
+		case models.SegmentStatusPending:
+			counts.Pending++
+		case models.SegmentStatusProcessing:
+			counts.Processing++
+		case models.SegmentStatusCompleted:
+			counts.Completed++
+		case models.SegmentStatusError:
+			counts.Error++
+		}
+	}
+	return counts
+}
+
+// Percent returns the share of narrated segments that are completed, rounded
+// to one decimal. A book with nothing to narrate is complete.
+func (c SegmentCounts) Percent() float64 {
+	narrated := c.Total - c.Skipped
+	if narrated == 0 {
+		return 100
+	}
+	return math.Round(float64(c.Completed)/float64(narrated)*1000) / 10
+}
+
+// Throughput is the synthesis rate of the current or most recent synthesizing stage
+type Throughput struct {
+	SegmentsPerMinute     float64 `json:"segmentsPerMinute"`
+	AudioSecondsPerMinute float64 `json:"audioSecondsPerMinute"`
+}
+
+// LastError is the most recent failure of a stage or a segment
+type LastError struct {
+	Message   string    `json:"message"`
+	Stage     string    `json:"stage,omitempty"`
+	SegmentID string    `json:"segmentId,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// TimelineEntry is one stage of the processing timeline
+type TimelineEntry struct {
+	Stage     string     `json:"stage"`
+	StartedAt time.Time  `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt"`
+	Duration  float64    `json:"duration"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Status is a detailed report of a book's processing
+type Status struct {
+	ID         string        `json:"id"`
+	Status     string        `json:"status"`
+	Stage      string        `json:"stage,omitempty"`
+	Segments   SegmentCounts `json:"segments"`
+	Percent    float64       `json:"percent"`
+	Throughput *Throughput   `json:"throughput,omitempty"`
+	// ETA is the estimated number of seconds until synthesis finishes
+	ETA                 *float64        `json:"eta,omitempty"`
+	EstimatedCompletion *time.Time      `json:"estimatedCompletion,omitempty"`
+	LastError           *LastError      `json:"lastError"`
+	Timeline            []TimelineEntry `json:"timeline"`
+}
+
+// Summarize reports a book's processing status at the time now from its
+// segments and recorded stages
+func Summarize(book *models.Book, segments []models.AudioSegment, stages []models.BookStage, now time.Time) *Status {
+	counts := CountSegments(segments)
+	status := &Status{
+		ID:       book.ID,
+		Status:   book.Status,
+		Segments: counts,
+		Percent:  counts.Percent(),
+		Timeline: make([]TimelineEntry, 0, len(stages)),
+	}
+
+	var synthesis *models.BookStage
+	for i := range stages {
+		stage := &stages[i]
+		end := now
+		if stage.EndedAt != nil {
+			end = *stage.EndedAt
+		} else {
+			status.Stage = stage.Stage
+		}
+
+		status.Timeline = append(status.Timeline, TimelineEntry{
+			Stage:     stage.Stage,
+			StartedAt: stage.StartedAt,
+			EndedAt:   stage.EndedAt,
+			Duration:  math.Round(end.Sub(stage.StartedAt).Seconds()*10) / 10,
+			Error:     stage.Error,
+		})
+
+		if stage.Stage == models.StageSynthesizing {
+			synthesis = stage
+		}
+		if stage.Error != "" && stage.EndedAt != nil {
+			status.LastError = latestError(status.LastError, &LastError{
+				Message: stage.Error,
+				Stage:   stage.Stage,
+				At:      *stage.EndedAt,
+			})
+		}
+	}
+
+	for _, segment := range segments {
+		if segment.Status == models.SegmentStatusError && segment.LastError != "" {
+			status.LastError = latestError(status.LastError, &LastError{
+				Message:   segment.LastError,
+				SegmentID: segment.ID,
+				At:        segment.UpdatedAt,
+			})
+		}
+	}
+
+	if synthesis != nil {
+		status.Throughput = throughput(synthesis, segments, now)
+	}
+
+	// Only a running synthesis can be extrapolated
+	remaining := counts.Pending + counts.Processing
+	if status.Stage == models.StageSynthesizing && book.Status != models.BookStatusPaused &&
+		status.Throughput != nil && status.Throughput.SegmentsPerMinute > 0 && remaining > 0 {
+		eta := math.Round(float64(remaining) / status.Throughput.SegmentsPerMinute * 60)
+		completion := now.Add(time.Duration(eta) * time.Second)
+		status.ETA = &eta
+		status.EstimatedCompletion = &completion
+	}
+
+	return status
+}
+
+// throughput measures the segments completed during a synthesizing stage
+func throughput(stage *models.BookStage, segments []models.AudioSegment, now time.Time) *Throughput {
+	end := now
+	if stage.EndedAt != nil {
+		end = *stage.EndedAt
+	}
+	minutes := end.Sub(stage.StartedAt).Minutes()
+	if minutes <= 0 {
+		return nil
+	}
+
+	var completed int
+	var audioSeconds float64
+	for _, segment := range segments {
+		if segment.Skip || segment.Status != models.SegmentStatusCompleted {
+			continue
+		}
+		if segment.UpdatedAt.Before(stage.StartedAt) || segment.UpdatedAt.After(end) {
+			continue
+		}
+		completed++
+		audioSeconds += segment.Duration
+	}
+	if completed == 0 {
+		return nil
+	}
+
+	return &Throughput{
+		SegmentsPerMinute:     math.Round(float64(completed)/minutes*100) / 100,
+		AudioSecondsPerMinute: math.Round(audioSeconds/minutes*10) / 10,
+	}
+}
+
+// latestError returns whichever of two errors happened last
+func latestError(current, candidate *LastError) *LastError {
+	if current == nil || candidate.At.After(current.At) {
+		return candidate
+	}
+	return current
+}
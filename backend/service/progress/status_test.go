@@ -0,0 +1,140 @@
+package progress
+
+import (
+	"testing"
+	"time"
+
+	"backend/domain/models"
+)
+
+var t0 = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func at(minutes int) time.Time {
+	return t0.Add(time.Duration(minutes) * time.Minute)
+}
+
+func ended(minutes int) *time.Time {
+	end := at(minutes)
+	return &end
+}
+
+// synthesizing returns the stages and segments of a book ten minutes into
+// synthesis, with one segment completed before it started
+func synthesizing() ([]models.BookStage, []models.AudioSegment) {
+	stages := []models.BookStage{
+		{Stage: models.StageDownloading, StartedAt: at(0), EndedAt: ended(1)},
+		{Stage: models.StageExtracting, StartedAt: at(1), EndedAt: ended(2), Error: "retried page 4"},
+		{Stage: models.StageSynthesizing, StartedAt: at(2)},
+	}
+	segment := func(id, status string, updated int) models.AudioSegment {
+		return models.AudioSegment{ID: id, Status: status, Duration: 30, UpdatedAt: at(updated)}
+	}
+	segments := []models.AudioSegment{
+		segment("s1", models.SegmentStatusCompleted, 1),
+		segment("s2", models.SegmentStatusCompleted, 4),
+		segment("s3", models.SegmentStatusCompleted, 5),
+		segment("s4", models.SegmentStatusCompleted, 6),
+		segment("s5", models.SegmentStatusCompleted, 7),
+		segment("s6", models.SegmentStatusError, 8),
+		segment("s7", models.SegmentStatusProcessing, 9),
+		segment("s8", models.SegmentStatusPending, 0),
+		segment("s9", models.SegmentStatusPending, 0),
+		segment("s10", models.SegmentStatusPending, 0),
+	}
+	segments[5].LastError = "provider timeout"
+	segments[9].Skip = true
+	return stages, segments
+}
+
+func TestSummarize(t *testing.T) {
+	stages, segments := synthesizing()
+	book := &models.Book{ID: "b1", Status: models.BookStatusProcessing}
+
+	status := Summarize(book, segments, stages, at(12))
+
+	want := SegmentCounts{Total: 10, Pending: 2, Processing: 1, Completed: 5, Error: 1, Skipped: 1}
+	if status.Segments != want {
+		t.Errorf("counts = %+v, want %+v", status.Segments, want)
+	}
+	if status.Percent != 55.6 {
+		t.Errorf("percent = %v, want 55.6", status.Percent)
+	}
+	if status.Stage != models.StageSynthesizing {
+		t.Errorf("stage = %q", status.Stage)
+	}
+
+	// Four segments and two minutes of audio in ten minutes of synthesis
+	if status.Throughput == nil || *status.Throughput != (Throughput{SegmentsPerMinute: 0.4, AudioSecondsPerMinute: 12}) {
+		t.Errorf("throughput = %+v", status.Throughput)
+	}
+	if status.ETA == nil || *status.ETA != 450 {
+		t.Errorf("ETA = %v, want 450", status.ETA)
+	}
+	if status.EstimatedCompletion == nil || !status.EstimatedCompletion.Equal(at(12).Add(450*time.Second)) {
+		t.Errorf("estimated completion = %v", status.EstimatedCompletion)
+	}
+
+	if status.LastError == nil || status.LastError.SegmentID != "s6" || status.LastError.Message != "provider timeout" {
+		t.Errorf("last error = %+v, want the segment's", status.LastError)
+	}
+
+	if len(status.Timeline) != 3 {
+		t.Fatalf("timeline = %+v", status.Timeline)
+	}
+	for i, want := range []float64{60, 60, 600} {
+		if got := status.Timeline[i].Duration; got != want {
+			t.Errorf("%s duration = %v, want %v", status.Timeline[i].Stage, got, want)
+		}
+	}
+	if status.Timeline[1].Error != "retried page 4" || status.Timeline[2].EndedAt != nil {
+		t.Errorf("timeline = %+v", status.Timeline)
+	}
+}
+
+func TestSummarizeWithoutETA(t *testing.T) {
+	stages, segments := synthesizing()
+
+	// A paused synthesis is not extrapolated
+	paused := Summarize(&models.Book{ID: "b1", Status: models.BookStatusPaused}, segments, stages, at(12))
+	if paused.ETA != nil || paused.EstimatedCompletion != nil {
+		t.Errorf("paused ETA = %v, completion %v", paused.ETA, paused.EstimatedCompletion)
+	}
+	if paused.Throughput == nil {
+		t.Error("paused book lost its throughput")
+	}
+
+	// Nor is a finished one, whose throughput is measured up to its end
+	stages[2].EndedAt = ended(7)
+	done := Summarize(&models.Book{ID: "b1", Status: models.BookStatusReady}, segments, stages, at(60))
+	if done.ETA != nil || done.Stage != "" {
+		t.Errorf("finished status = %+v", done)
+	}
+	if done.Throughput == nil || done.Throughput.SegmentsPerMinute != 0.8 {
+		t.Errorf("finished throughput = %+v, want 0.8 segments a minute", done.Throughput)
+	}
+
+	// A stage failure after the segment's is the last error
+	stages = append(stages, models.BookStage{Stage: models.StageSynthesizing, StartedAt: at(8), EndedAt: ended(9), Error: "quota exceeded"})
+	failed := Summarize(&models.Book{ID: "b1", Status: models.BookStatusError}, segments, stages, at(60))
+	if failed.LastError == nil || failed.LastError.Stage != models.StageSynthesizing || failed.LastError.SegmentID != "" {
+		t.Errorf("last error = %+v, want the stage's", failed.LastError)
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		counts SegmentCounts
+		want   float64
+	}{
+		{SegmentCounts{}, 100},
+		{SegmentCounts{Total: 2, Skipped: 2}, 100},
+		{SegmentCounts{Total: 3, Completed: 1}, 33.3},
+		{SegmentCounts{Total: 4, Completed: 2, Skipped: 1}, 66.7},
+		{SegmentCounts{Total: 4, Completed: 4}, 100},
+	}
+	for _, tt := range tests {
+		if got := tt.counts.Percent(); got != tt.want {
+			t.Errorf("%+v.Percent() = %v, want %v", tt.counts, got, tt.want)
+		}
+	}
+}
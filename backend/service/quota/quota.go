@@ -0,0 +1,207 @@
+package quota
+
+import (
+	"fmt"
+	"time"
+
+	"backend/domain/models"
+	"backend/repository"
+
+	"github.com/google/uuid"
+)
+
+// Quota resources
+const (
+	ResourceStorage    = "storage"
+	ResourceBooks      = "books"
+	ResourceCharacters = "characters"
+)
+
+// Limits caps what a user may consume. A zero limit is unlimited.
+type Limits struct {
+	StorageBytes      int64 `json:"storageBytes"`
+	Books             int64 `json:"books"`
+	MonthlyCharacters int64 `json:"monthlyCharacters"`
+}
+
+// Metric is the consumption of one resource against its limit
+type Metric struct {
+	Used      int64  `json:"used"`
+	Limit     int64  `json:"limit"`
+	Remaining *int64 `json:"remaining,omitempty"` // omitted when unlimited
+}
+
+// Usage is a user's consumption in the current period
+type Usage struct {
+	UserID            string    `json:"userId"`
+	StorageBytes      Metric    `json:"storageBytes"`
+	Books             Metric    `json:"books"`
+	MonthlyCharacters Metric    `json:"monthlyCharacters"`
+	PeriodStart       time.Time `json:"periodStart"`
+	PeriodEnd         time.Time `json:"periodEnd"`
+}
+
+// ExceededError is returned when an action would take a user over a limit
+type ExceededError struct {
+	Resource  string
+	Used      int64
+	Limit     int64
+	Requested int64
+}
+
+func (e *ExceededError) Error() string {
+	switch e.Resource {
+	case ResourceStorage:
+		return fmt.Sprintf("storage quota exceeded: %d of %d bytes used", e.Used, e.Limit)
+	case ResourceBooks:
+		return fmt.Sprintf("book quota exceeded: %d of %d books", e.Used, e.Limit)
+	}
+	return fmt.Sprintf("monthly synthesis quota exceeded: %d of %d characters used, %d requested", e.Used, e.Limit, e.Requested)
+}
+
+// Enforcer checks and records per-user consumption
+type Enforcer struct {
+	db       repository.Usage
+	defaults Limits
+}
+
+// NewEnforcer creates an Enforcer applying defaults to users without overrides
+func NewEnforcer(db repository.Usage, defaults Limits) *Enforcer {
+	return &Enforcer{db: db, defaults: defaults}
+}
+
+// Limits returns the limits that apply to a user
+func (e *Enforcer) Limits(userID string) (Limits, error) {
+	limits := e.defaults
+
+	override, err := e.db.GetUserQuota(userID)
+	if err != nil {
+		return limits, err
+	}
+	if override == nil {
+		return limits, nil
+	}
+	if override.StorageBytes != nil {
+		limits.StorageBytes = *override.StorageBytes
+	}
+	if override.Books != nil {
+		limits.Books = *override.Books
+	}
+	if override.MonthlyCharacters != nil {
+		limits.MonthlyCharacters = *override.MonthlyCharacters
+	}
+	return limits, nil
+}
+
+// Usage returns a user's consumption as of now
+func (e *Enforcer) Usage(userID string, now time.Time) (*Usage, error) {
+	limits, err := e.Limits(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	storageBytes, books, err := e.db.GetStorageUsage(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := Period(now)
+	characters, err := e.db.GetSynthesisUsage(userID, start)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Usage{
+		UserID:            userID,
+		StorageBytes:      metric(storageBytes, limits.StorageBytes),
+		Books:             metric(books, limits.Books),
+		MonthlyCharacters: metric(characters, limits.MonthlyCharacters),
+		PeriodStart:       start,
+		PeriodEnd:         end,
+	}, nil
+}
+
+// SetOverride creates or replaces a user's quota overrides
+func (e *Enforcer) SetOverride(quota *models.UserQuota) error {
+	return e.db.SaveUserQuota(quota)
+}
+
+// CheckUpload returns an ExceededError if the user cannot add another book
+// whose file takes the given number of bytes
+func (e *Enforcer) CheckUpload(userID string, bytes int64) error {
+	usage, err := e.Usage(userID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if m := usage.Books; m.Limit > 0 && m.Used >= m.Limit {
+		return &ExceededError{Resource: ResourceBooks, Used: m.Used, Limit: m.Limit, Requested: 1}
+	}
+	if m := usage.StorageBytes; m.Limit > 0 && m.Used+bytes > m.Limit {
+		return &ExceededError{Resource: ResourceStorage, Used: m.Used, Limit: m.Limit, Requested: bytes}
+	}
+	return nil
+}
+
+// CheckSynthesis returns an ExceededError if synthesizing the given number
+// of characters would exceed the user's monthly quota, or if they are out
+// of storage for the audio
+func (e *Enforcer) CheckSynthesis(userID string, characters int64) error {
+	usage, err := e.Usage(userID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if m := usage.MonthlyCharacters; m.Limit > 0 && m.Used+characters > m.Limit {
+		return &ExceededError{Resource: ResourceCharacters, Used: m.Used, Limit: m.Limit, Requested: characters}
+	}
+	if m := usage.StorageBytes; m.Limit > 0 && m.Used >= m.Limit {
+		return &ExceededError{Resource: ResourceStorage, Used: m.Used, Limit: m.Limit}
+	}
+	return nil
+}
+
+// CheckStorage returns an ExceededError if storing the given number of
+// bytes would take the user over their storage quota
+func (e *Enforcer) CheckStorage(userID string, bytes int64) error {
+	usage, err := e.Usage(userID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if m := usage.StorageBytes; m.Limit > 0 && m.Used+bytes > m.Limit {
+		return &ExceededError{Resource: ResourceStorage, Used: m.Used, Limit: m.Limit, Requested: bytes}
+	}
+	return nil
+}
+
+// RecordSynthesis records the characters of a segment sent for synthesis
+func (e *Enforcer) RecordSynthesis(userID string, segment *models.AudioSegment, characters int64) error {
+	return e.db.SaveSynthesisUsage(&models.SynthesisUsage{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		BookID:     segment.BookID,
+		SegmentID:  segment.ID,
+		Characters: characters,
+		CreatedAt:  time.Now().UTC(), // compared against UTC period starts
+	})
+}
+
+// Period returns the calendar month, in UTC, that contains t
+func Period(t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+func metric(used, limit int64) Metric {
+	m := Metric{Used: used, Limit: limit}
+	if limit > 0 {
+		remaining := limit - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		m.Remaining = &remaining
+	}
+	return m
+}
@@ -0,0 +1,169 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"backend/domain/models"
+)
+
+// fakeUsage is a repository.Usage with fixed consumption
+type fakeUsage struct {
+	storage    int64
+	books      int64
+	characters int64
+	since      time.Time
+	quotas     map[string]*models.UserQuota
+}
+
+func (f *fakeUsage) SaveSynthesisUsage(*models.SynthesisUsage) error { return nil }
+
+func (f *fakeUsage) GetSynthesisUsage(userID string, since time.Time) (int64, error) {
+	f.since = since
+	return f.characters, nil
+}
+
+func (f *fakeUsage) GetStorageUsage(userID string) (int64, int64, error) {
+	return f.storage, f.books, nil
+}
+
+func (f *fakeUsage) GetUserQuota(userID string) (*models.UserQuota, error) {
+	return f.quotas[userID], nil
+}
+
+func (f *fakeUsage) SaveUserQuota(quota *models.UserQuota) error {
+	if f.quotas == nil {
+		f.quotas = map[string]*models.UserQuota{}
+	}
+	f.quotas[quota.UserID] = quota
+	return nil
+}
+
+func exceeded(t *testing.T, err error, resource string) {
+	t.Helper()
+	var e *ExceededError
+	if !errors.As(err, &e) {
+		t.Fatalf("err = %v, want ExceededError", err)
+	}
+	if e.Resource != resource {
+		t.Errorf("resource = %s, want %s", e.Resource, resource)
+	}
+}
+
+func TestCheckStorage(t *testing.T) {
+	e := NewEnforcer(&fakeUsage{storage: 900}, Limits{StorageBytes: 1000})
+
+	if err := e.CheckStorage("u", 100); err != nil {
+		t.Errorf("exactly at the limit: %v", err)
+	}
+	exceeded(t, e.CheckStorage("u", 101), ResourceStorage)
+}
+
+func TestCheckUpload(t *testing.T) {
+	tests := []struct {
+		name     string
+		usage    fakeUsage
+		limits   Limits
+		bytes    int64
+		resource string
+	}{
+		{"unlimited", fakeUsage{storage: 1 << 40, books: 1000}, Limits{}, 1 << 30, ""},
+		{"fits exactly", fakeUsage{storage: 900, books: 1}, Limits{StorageBytes: 1000, Books: 2}, 100, ""},
+		{"file over storage", fakeUsage{storage: 999}, Limits{StorageBytes: 1000}, 2, ResourceStorage},
+		{"at book limit", fakeUsage{books: 2}, Limits{Books: 2}, 1, ResourceBooks},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage := tt.usage
+			err := NewEnforcer(&usage, tt.limits).CheckUpload("u", tt.bytes)
+			if tt.resource == "" {
+				if err != nil {
+					t.Errorf("CheckUpload: %v", err)
+				}
+				return
+			}
+			exceeded(t, err, tt.resource)
+		})
+	}
+}
+
+func TestCheckSynthesis(t *testing.T) {
+	e := NewEnforcer(&fakeUsage{characters: 400}, Limits{MonthlyCharacters: 500})
+
+	if err := e.CheckSynthesis("u", 100); err != nil {
+		t.Errorf("exactly at the limit: %v", err)
+	}
+	err := e.CheckSynthesis("u", 101)
+	exceeded(t, err, ResourceCharacters)
+	if e := err.(*ExceededError); e.Requested != 101 || e.Used != 400 {
+		t.Errorf("error = %+v", e)
+	}
+}
+
+func TestOverride(t *testing.T) {
+	usage := &fakeUsage{storage: 500, books: 3}
+	e := NewEnforcer(usage, Limits{StorageBytes: 1000, Books: 3, MonthlyCharacters: 10})
+
+	exceeded(t, e.CheckUpload("vip", 0), ResourceBooks)
+
+	books, unlimited := int64(10), int64(0)
+	if err := e.SetOverride(&models.UserQuota{UserID: "vip", Books: &books, StorageBytes: &unlimited}); err != nil {
+		t.Fatal(err)
+	}
+	limits, err := e.Limits("vip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fields left nil keep the defaults
+	want := Limits{StorageBytes: 0, Books: 10, MonthlyCharacters: 10}
+	if limits != want {
+		t.Errorf("Limits = %+v, want %+v", limits, want)
+	}
+	if err := e.CheckUpload("vip", 1<<30); err != nil {
+		t.Errorf("CheckUpload with override: %v", err)
+	}
+	// Other users keep the defaults
+	exceeded(t, e.CheckUpload("other", 0), ResourceBooks)
+}
+
+func TestUsageMonthlyWindow(t *testing.T) {
+	usage := &fakeUsage{storage: 1200, characters: 30}
+	e := NewEnforcer(usage, Limits{StorageBytes: 1000, MonthlyCharacters: 100})
+
+	now := time.Date(2024, time.February, 29, 23, 30, 0, 0, time.FixedZone("", -2*60*60))
+	u, err := e.Usage("u", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 23:30 at UTC-2 is already March in UTC
+	start := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+	if !u.PeriodStart.Equal(start) || !u.PeriodEnd.Equal(end) {
+		t.Errorf("period = %v to %v, want %v to %v", u.PeriodStart, u.PeriodEnd, start, end)
+	}
+	if !usage.since.Equal(start) {
+		t.Errorf("synthesis usage counted since %v, want %v", usage.since, start)
+	}
+	if m := u.MonthlyCharacters; m.Remaining == nil || *m.Remaining != 70 {
+		t.Errorf("remaining characters = %v, want 70", m.Remaining)
+	}
+	// Remaining never goes negative
+	if m := u.StorageBytes; m.Remaining == nil || *m.Remaining != 0 {
+		t.Errorf("remaining storage = %v, want 0", m.Remaining)
+	}
+	if u.Books.Remaining != nil {
+		t.Errorf("unlimited books remaining = %d, want omitted", *u.Books.Remaining)
+	}
+}
+
+func TestPeriod(t *testing.T) {
+	start, end := Period(time.Date(2023, time.December, 15, 12, 0, 0, 0, time.UTC))
+	if want := time.Date(2023, time.December, 1, 0, 0, 0, 0, time.UTC); !start.Equal(want) {
+		t.Errorf("start = %v, want %v", start, want)
+	}
+	if want := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC); !end.Equal(want) {
+		t.Errorf("end = %v, want %v", end, want)
+	}
+}
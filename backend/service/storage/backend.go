@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"backend/config"
+)
+
+// ErrNotFound is returned when a key does not exist in a backend
+var ErrNotFound = errors.New("object not found")
+
+// Object describes a stored object
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+	ETag        string
+}
+
+// Backend stores objects under slash-separated keys such as "audio/x.mp3"
+type Backend interface {
+	// Put stores the contents of r under key, replacing any existing object
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Get opens an object for reading. The caller must close the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, *Object, error)
+	// Stat returns an object's metadata
+	Stat(ctx context.Context, key string) (*Object, error)
+	// Delete removes an object. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns every object whose key starts with prefix
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// URL returns the address an object is served from
+	URL(key string) string
+}
+
+// NewBackend creates the backend selected by STORAGE_BACKEND
+func NewBackend(cfg *config.Config) (Backend, error) {
+	switch strings.ToLower(cfg.StorageBackend) {
+	case "", "local":
+		return NewLocalBackend(cfg.UploadDir)
+	case "s3":
+		return NewS3Backend(S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+			PublicURL: cfg.S3PublicURL,
+		})
+	case "uploadthing":
+		return NewUploadThingBackend(UploadThingConfig{
+			UploadURL: cfg.UploadThingURL,
+			APIURL:    cfg.UploadThingAPIURL,
+			Token:     cfg.UploadThingToken,
+			Secret:    cfg.UploadThingSecret,
+			AppID:     cfg.UploadThingAppID,
+		})
+	}
+	return nil, fmt.Errorf("unknown storage backend: %s", cfg.StorageBackend)
+}
+
+// cleanKey normalizes a key and rejects ones that could escape the storage root
+func cleanKey(key string) (string, error) {
+	key = strings.TrimPrefix(strings.ReplaceAll(key, "\\", "/"), "/")
+	cleaned := path.Clean(key)
+	if key == "" || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("invalid storage key: %q", key)
+	}
+	return cleaned, nil
+}
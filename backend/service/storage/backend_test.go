@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCleanKey(t *testing.T) {
+	valid := map[string]string{
+		"audio/x.mp3":   "audio/x.mp3",
+		"/audio/x.mp3":  "audio/x.mp3",
+		"audio//x.mp3":  "audio/x.mp3",
+		"audio/./x.mp3": "audio/x.mp3",
+		"a/b/../x.mp3":  "a/x.mp3",
+		`covers\x.png`:  "covers/x.png",
+		"..foo/bar":     "..foo/bar",
+	}
+	for key, want := range valid {
+		got, err := cleanKey(key)
+		if err != nil || got != want {
+			t.Errorf("cleanKey(%q) = %q, %v; want %q", key, got, err, want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"/",
+		".",
+		"..",
+		"../x",
+		"/../x",
+		"a/../../b",
+		`..\x`,
+		`a\..\..\b`,
+	}
+	for _, key := range invalid {
+		if got, err := cleanKey(key); err == nil {
+			t.Errorf("cleanKey(%q) = %q, want an error", key, got)
+		}
+	}
+}
+
+func TestLocalBackendPath(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewLocalBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := b.Path("/audio/../covers/x.png")
+	if err != nil {
+		t.Fatalf("Path: %v", err)
+	}
+	if want := filepath.Join(dir, "covers", "x.png"); got != want {
+		t.Errorf("Path = %s, want %s", got, want)
+	}
+
+	for _, key := range []string{"../x", "a/../../x", `..\..\etc\passwd`, ""} {
+		if got, err := b.Path(key); err == nil {
+			t.Errorf("Path(%q) = %s, want an error", key, got)
+		}
+	}
+}
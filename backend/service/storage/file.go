@@ -1,104 +1,305 @@
 package storage
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"backend/service/media"
 
 	"github.com/google/uuid"
 )
 
-// FileStorage handles file operations
+// ErrRemoteFile is returned when a reference points at a remote URL that is
+// not managed by the storage backend
+var ErrRemoteFile = errors.New("file is stored remotely")
+
+// Key prefixes for each kind of stored file
+const (
+	AudioPrefix = "audio/"
+	CoverPrefix = "covers/"
+	PDFPrefix   = "pdfs/"
+)
+
+// FileStorage handles file operations. Files are written to a Backend under
+// stable keys; a local cache directory holds copies of remote PDFs for the
+// PDF parser.
 type FileStorage struct {
+	backend  Backend
+	signer   *Signer
 	baseDir  string
-	pdfDir   string
-	coverDir string
-	audioDir string
+	cacheDir string
 }
 
-// NewFileStorage creates a new FileStorage instance
-func NewFileStorage(baseDir string) (*FileStorage, error) {
+// NewFileStorage creates a new FileStorage instance writing to backend, with
+// working copies kept under baseDir. A nil signer disables signed media URLs.
+func NewFileStorage(baseDir string, backend Backend, signer *Signer) (*FileStorage, error) {
 	fs := &FileStorage{
+		backend:  backend,
+		signer:   signer,
 		baseDir:  baseDir,
-		pdfDir:   filepath.Join(baseDir, "pdfs"),
-		coverDir: filepath.Join(baseDir, "covers"),
-		audioDir: filepath.Join(baseDir, "audio"),
+		cacheDir: filepath.Join(baseDir, "cache"),
 	}
 
-	// Create directories if they don't exist
-	for _, dir := range []string{fs.pdfDir, fs.coverDir, fs.audioDir} {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return nil, fmt.Errorf("error creating directory %s: %v", dir, err)
-		}
+	if err := os.MkdirAll(fs.cacheDir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating directory %s: %v", fs.cacheDir, err)
 	}
 
 	return fs, nil
 }
 
-// SavePDF saves a PDF file and returns its path
-func (fs *FileStorage) SavePDF(file multipart.File, header *multipart.FileHeader) (string, error) {
-	// Generate unique filename
-	ext := filepath.Ext(header.Filename)
-	if !strings.EqualFold(ext, ".pdf") {
-		return "", fmt.Errorf("invalid file type: %s", ext)
+// Backend returns the backend files are stored in
+func (fs *FileStorage) Backend() Backend {
+	return fs.backend
+}
+
+// URL returns the address a stored file is served from
+func (fs *FileStorage) URL(key string) string {
+	return fs.backend.URL(key)
+}
+
+// Signing reports whether media is only served through signed URLs
+func (fs *FileStorage) Signing() bool {
+	return fs.signer != nil
+}
+
+// SignedURL returns a time-limited URL for a stored file, valid for ttl or
+// the signer's default when ttl is zero, along with its expiry. Without a
+// signer it returns the file's plain URL and a zero time.
+func (fs *FileStorage) SignedURL(key string, ttl time.Duration) (string, time.Time) {
+	if fs.signer == nil {
+		return fs.URL(key), time.Time{}
+	}
+	if ttl <= 0 {
+		ttl = fs.signer.TTL()
 	}
+	expires := time.Now().Add(ttl)
+	return fs.signer.Sign(key, expires), expires
+}
 
-	filename := uuid.New().String() + ext
-	filePath := filepath.Join(fs.pdfDir, filename)
+// SignedPath appends signature parameters to a route path served by this
+// server, such as /hls/book/segment.ts. Without a signer it returns p.
+func (fs *FileStorage) SignedPath(p string) string {
+	if fs.signer == nil {
+		return p
+	}
+	return p + "?" + fs.signer.Query(p, time.Now().Add(fs.signer.TTL())).Encode()
+}
 
-	// Create destination file
-	dst, err := os.Create(filePath)
-	if err != nil {
-		return "", fmt.Errorf("error creating file: %v", err)
+// VerifyURL checks the signature parameters of a request for a stored file,
+// or for a path signed by SignedPath, and returns when access expires
+func (fs *FileStorage) VerifyURL(key string, query url.Values) (time.Time, error) {
+	if fs.signer == nil {
+		return time.Time{}, ErrInvalidSignature
 	}
-	defer dst.Close()
+	return fs.signer.Verify(key, query, time.Now())
+}
 
-	// Copy file contents
-	if _, err := io.Copy(dst, file); err != nil {
-		return "", fmt.Errorf("error copying file: %v", err)
+// BookPDFKey returns the key of a book's source PDF
+func BookPDFKey(bookID string) string {
+	return PDFPrefix + bookID + ".pdf"
+}
+
+// SavePDF saves an uploaded PDF file and returns its key
+func (fs *FileStorage) SavePDF(ctx context.Context, file multipart.File, header *multipart.FileHeader) (string, error) {
+	ext := filepath.Ext(header.Filename)
+	if !strings.EqualFold(ext, ".pdf") {
+		return "", fmt.Errorf("invalid file type: %s", ext)
 	}
 
-	return filePath, nil
+	key := PDFPrefix + uuid.New().String() + strings.ToLower(ext)
+	if err := fs.backend.Put(ctx, key, file, "application/pdf"); err != nil {
+		return "", err
+	}
+	return key, nil
 }
 
-// SaveCover saves a cover image and returns its URL
-func (fs *FileStorage) SaveCover(file multipart.File, filename string) (string, error) {
-	// Generate unique filename
+// SaveCover saves a cover image and returns its key
+func (fs *FileStorage) SaveCover(ctx context.Context, file io.Reader, filename string) (string, error) {
 	ext := filepath.Ext(filename)
 	if !isValidImageExt(ext) {
 		return "", fmt.Errorf("invalid file type: %s", ext)
 	}
 
-	filename = uuid.New().String() + ext
-	filePath := filepath.Join(fs.coverDir, filename)
+	key := CoverPrefix + uuid.New().String() + strings.ToLower(ext)
+	if err := fs.backend.Put(ctx, key, file, media.ContentType(key)); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// SaveThumbnail saves a JPEG thumbnail of a cover next to it and returns its key
+func (fs *FileStorage) SaveThumbnail(ctx context.Context, coverKey string, width int, data []byte) (string, error) {
+	key := fmt.Sprintf("%s-%dw.jpg", strings.TrimSuffix(coverKey, path.Ext(coverKey)), width)
+	if err := fs.backend.Put(ctx, key, bytes.NewReader(data), "image/jpeg"); err != nil {
+		return "", fmt.Errorf("error writing thumbnail: %v", err)
+	}
+	return key, nil
+}
+
+// SaveAudio saves an audio file and returns its key
+func (fs *FileStorage) SaveAudio(ctx context.Context, data []byte, filename string, contentType string) (string, error) {
+	key := AudioPrefix + filename
+	if err := fs.backend.Put(ctx, key, bytes.NewReader(data), contentType); err != nil {
+		return "", fmt.Errorf("error writing audio file: %v", err)
+	}
+	return key, nil
+}
+
+// SaveBookPDF stores a book's source PDF and returns its key
+func (fs *FileStorage) SaveBookPDF(ctx context.Context, bookID string, r io.Reader) (string, error) {
+	key := BookPDFKey(bookID)
+
+	// Drop any cached copy of an earlier version
+	if cached, err := fs.cachePath(key); err == nil {
+		os.Remove(cached)
+	}
+
+	if err := fs.backend.Put(ctx, key, r, "application/pdf"); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Open opens a stored file for reading
+func (fs *FileStorage) Open(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	return fs.backend.Get(ctx, key)
+}
+
+// Stat returns a stored file's metadata
+func (fs *FileStorage) Stat(ctx context.Context, key string) (*Object, error) {
+	return fs.backend.Stat(ctx, key)
+}
+
+// List returns the stored files whose keys start with prefix
+func (fs *FileStorage) List(ctx context.Context, prefix string) ([]Object, error) {
+	return fs.backend.List(ctx, prefix)
+}
+
+// Delete removes a stored file. Missing files are not an error.
+func (fs *FileStorage) Delete(ctx context.Context, key string) error {
+	if cached, err := fs.cachePath(key); err == nil {
+		os.Remove(cached)
+	}
+	return fs.backend.Delete(ctx, key)
+}
+
+// LocalFile returns the path of a stored file if the backend keeps it on the local filesystem
+func (fs *FileStorage) LocalFile(key string) (string, bool) {
+	local, ok := fs.backend.(*LocalBackend)
+	if !ok {
+		return "", false
+	}
+	p, err := local.Path(key)
+	if err != nil {
+		return "", false
+	}
+	return p, true
+}
+
+// LocalPath returns a local path holding a stored file's contents, copying
+// files from remote backends into the cache directory on first use
+func (fs *FileStorage) LocalPath(ctx context.Context, key string) (string, error) {
+	if p, ok := fs.LocalFile(key); ok {
+		if _, err := os.Stat(p); err != nil {
+			if os.IsNotExist(err) {
+				return "", ErrNotFound
+			}
+			return "", err
+		}
+		return p, nil
+	}
 
-	// Create destination file
-	dst, err := os.Create(filePath)
+	cached, err := fs.cachePath(key)
 	if err != nil {
-		return "", fmt.Errorf("error creating file: %v", err)
+		return "", err
+	}
+	if _, err := os.Stat(cached); err == nil {
+		return cached, nil
 	}
-	defer dst.Close()
 
-	// Copy file contents
-	if _, err := io.Copy(dst, file); err != nil {
-		return "", fmt.Errorf("error copying file: %v", err)
+	rc, _, err := fs.backend.Get(ctx, key)
+	if err != nil {
+		return "", err
 	}
+	defer rc.Close()
 
-	return "/covers/" + filename, nil
+	cache := &LocalBackend{dir: fs.cacheDir}
+	if err := cache.Put(ctx, key, rc, ""); err != nil {
+		return "", err
+	}
+	return cached, nil
 }
 
-// SaveAudio saves an audio file and returns its URL
-func (fs *FileStorage) SaveAudio(data []byte, filename string) (string, error) {
-	filePath := filepath.Join(fs.audioDir, filename)
+// KeyFor maps a stored file reference to its storage key. References may be
+// keys, served URLs ("/audio/x.mp3"), legacy paths relative to the working
+// directory ("audio/x.mp3"), local paths under the storage directory, or URLs
+// of the storage backend. Other remote URLs return ErrRemoteFile.
+func (fs *FileStorage) KeyFor(ref string) (string, error) {
+	if ref == "" {
+		return "", os.ErrNotExist
+	}
 
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
-		return "", fmt.Errorf("error writing audio file: %v", err)
+	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+		base := fs.backend.URL("")
+		if strings.HasPrefix(base, "http") && strings.HasPrefix(ref, base) {
+			key, err := url.PathUnescape(strings.TrimPrefix(ref, base))
+			if err != nil {
+				return "", err
+			}
+			return cleanKey(key)
+		}
+		return "", ErrRemoteFile
+	}
+
+	trimmed := strings.TrimPrefix(filepath.ToSlash(ref), "/")
+	for _, prefix := range []string{AudioPrefix, CoverPrefix, PDFPrefix} {
+		if strings.HasPrefix(trimmed, prefix) {
+			return cleanKey(trimmed)
+		}
+	}
+
+	// Local paths written by older code, such as those returned by SavePDF
+	if rel, ok := fs.relative(ref); ok {
+		return cleanKey(rel)
+	}
+
+	return "", os.ErrNotExist
+}
+
+// relative returns a path relative to the storage directory if it lies inside it
+func (fs *FileStorage) relative(p string) (string, bool) {
+	base, err := filepath.Abs(fs.baseDir)
+	if err != nil {
+		return "", false
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(base, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
 	}
+	return filepath.ToSlash(rel), true
+}
 
-	return "/audio/" + filename, nil
+// cachePath returns where a remote file is cached locally
+func (fs *FileStorage) cachePath(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(fs.cacheDir, filepath.FromSlash(path.Clean(key))), nil
 }
 
 func isValidImageExt(ext string) bool {
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"backend/service/media"
+)
+
+// LocalBackend stores objects as files under a directory. Objects are served
+// by this server at "/" followed by their key.
+type LocalBackend struct {
+	dir string
+}
+
+// NewLocalBackend creates a backend rooted at dir
+func NewLocalBackend(dir string) (*LocalBackend, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating directory %s: %v", dir, err)
+	}
+	return &LocalBackend{dir: dir}, nil
+}
+
+// Path returns the file an object is stored in
+func (b *LocalBackend) Path(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(b.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes an object through a temporary file so readers never see a partial file
+func (b *LocalBackend) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	filePath, err := b.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("error creating directory: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing file: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("error setting file permissions: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return fmt.Errorf("error moving file: %v", err)
+	}
+
+	return nil
+}
+
+// Get opens an object's file
+func (b *LocalBackend) Get(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	filePath, err := b.Path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, ErrNotFound
+		}
+		return nil, nil, fmt.Errorf("error opening file: %v", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		if err == nil {
+			return nil, nil, ErrNotFound
+		}
+		return nil, nil, fmt.Errorf("error reading file: %v", err)
+	}
+	return f, fileObject(key, filePath, info), nil
+}
+
+// Stat returns an object's file metadata
+func (b *LocalBackend) Stat(ctx context.Context, key string) (*Object, error) {
+	filePath, err := b.Path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+	if info.IsDir() {
+		return nil, ErrNotFound
+	}
+
+	return fileObject(key, filePath, info), nil
+}
+
+// fileObject describes the file holding an object
+func fileObject(key, filePath string, info os.FileInfo) *Object {
+	return &Object{
+		Key:         key,
+		Size:        info.Size(),
+		ContentType: media.ContentType(filePath),
+		ModTime:     info.ModTime(),
+	}
+}
+
+// Delete removes an object's file
+func (b *LocalBackend) Delete(ctx context.Context, key string) error {
+	filePath, err := b.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error deleting file: %v", err)
+	}
+	return nil
+}
+
+// List walks the files under prefix. Temporary files of writes in progress are skipped.
+func (b *LocalBackend) List(ctx context.Context, prefix string) ([]Object, error) {
+	root := b.dir
+	if dir := path.Dir(prefix + "x"); dir != "." {
+		root = filepath.Join(b.dir, filepath.FromSlash(dir))
+	}
+
+	var objects []Object
+	err := filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".tmp") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(b.dir, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		objects = append(objects, *fileObject(key, filePath, info))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing files: %v", err)
+	}
+	return objects, nil
+}
+
+// URL returns the path this server serves an object at
+func (b *LocalBackend) URL(key string) string {
+	return "/" + key
+}
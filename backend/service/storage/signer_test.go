@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSignerDisabledWithoutSecret(t *testing.T) {
+	if s := NewSigner("", time.Hour); s != nil {
+		t.Errorf("NewSigner with no secret = %v, want nil", s)
+	}
+	if s := NewSigner("secret", 0); s.TTL() != time.Hour {
+		t.Errorf("default TTL = %v, want 1h", s.TTL())
+	}
+}
+
+func TestSignerRoundTrip(t *testing.T) {
+	s := NewSigner("secret", time.Hour)
+	now := time.Unix(1700000000, 0)
+	expires := now.Add(time.Minute)
+
+	signed := s.Sign("audio/a b.mp3", expires)
+	if !strings.HasPrefix(signed, MediaPrefix+"audio/a%20b.mp3?") {
+		t.Fatalf("Sign = %s", signed)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Verify("audio/a b.mp3", u.Query(), now)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !got.Equal(expires) {
+		t.Errorf("Verify expiry = %v, want %v", got, expires)
+	}
+	// A leading slash names the same key, so route paths verify too
+	if _, err := s.Verify("/audio/a b.mp3", u.Query(), now); err != nil {
+		t.Errorf("Verify with leading slash: %v", err)
+	}
+
+	if _, err := s.Verify("audio/a b.mp3", u.Query(), expires.Add(time.Second)); err != ErrExpiredURL {
+		t.Errorf("Verify after expiry = %v, want ErrExpiredURL", err)
+	}
+}
+
+func TestSignerRejectsTampering(t *testing.T) {
+	s := NewSigner("secret", time.Hour)
+	now := time.Unix(1700000000, 0)
+	query := s.Query("audio/a.mp3", now.Add(time.Minute))
+
+	later := url.Values{"expires": {"1800000000"}, "sig": {query.Get("sig")}}
+	badSig := url.Values{"expires": query["expires"], "sig": {strings.Repeat("0", 64)}}
+	notHex := url.Values{"expires": query["expires"], "sig": {"zz"}}
+	tests := []struct {
+		name  string
+		key   string
+		query url.Values
+	}{
+		{"other key", "audio/b.mp3", query},
+		{"extended expiry", "audio/a.mp3", later},
+		{"wrong signature", "audio/a.mp3", badSig},
+		{"malformed signature", "audio/a.mp3", notHex},
+		{"missing signature", "audio/a.mp3", url.Values{"expires": query["expires"]}},
+		{"missing expiry", "audio/a.mp3", url.Values{"sig": query["sig"]}},
+	}
+	for _, tt := range tests {
+		if _, err := s.Verify(tt.key, tt.query, now); err != ErrInvalidSignature {
+			t.Errorf("%s: Verify = %v, want ErrInvalidSignature", tt.name, err)
+		}
+	}
+
+	other := NewSigner("other", time.Hour)
+	if _, err := other.Verify("audio/a.mp3", query, now); err != ErrInvalidSignature {
+		t.Errorf("Verify with another secret = %v, want ErrInvalidSignature", err)
+	}
+}
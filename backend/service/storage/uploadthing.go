@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UploadThingConfig configures an UploadThing backend
+type UploadThingConfig struct {
+	// UploadURL receives multipart uploads
+	UploadURL string
+	// APIURL is the base of the REST API used to delete files
+	APIURL string
+	Token  string
+	Secret string
+	AppID  string
+}
+
+// UploadThingBackend stores objects in UploadThing. Each file is uploaded
+// with its storage key as the custom ID, so it can be addressed by key
+// without keeping UploadThing's own file keys.
+type UploadThingBackend struct {
+	cfg    UploadThingConfig
+	client *http.Client
+}
+
+// NewUploadThingBackend creates an UploadThing backend
+func NewUploadThingBackend(cfg UploadThingConfig) (*UploadThingBackend, error) {
+	if cfg.UploadURL == "" || cfg.AppID == "" {
+		return nil, fmt.Errorf("UPLOADTHING_URL and UPLOADTHING_APP_ID are required for the uploadthing storage backend")
+	}
+	return &UploadThingBackend{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// Put uploads an object as a multipart form
+func (b *UploadThingBackend) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	if err := writer.WriteField("customId", key); err != nil {
+		return fmt.Errorf("error creating form field: %v", err)
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, path.Base(key)))
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return fmt.Errorf("error creating form file: %v", err)
+	}
+	if _, err := io.Copy(part, r); err != nil {
+		return fmt.Errorf("error copying file: %v", err)
+	}
+	writer.Close()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", b.cfg.UploadURL, body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+b.cfg.Token)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error uploading to UploadThing: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("UploadThing error: %s", resp.Status)
+	}
+	return nil
+}
+
+// Get downloads an object from its file URL
+func (b *UploadThingBackend) Get(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	resp, err := b.fetch(ctx, "GET", key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Body, responseObject(key, resp), nil
+}
+
+// Stat returns an object's metadata
+func (b *UploadThingBackend) Stat(ctx context.Context, key string) (*Object, error) {
+	resp, err := b.fetch(ctx, "HEAD", key)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return responseObject(key, resp), nil
+}
+
+// Delete removes an object through the UploadThing API
+func (b *UploadThingBackend) Delete(ctx context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string][]string{"customIds": {key}})
+	if err != nil {
+		return fmt.Errorf("error encoding request: %v", err)
+	}
+
+	endpoint := strings.TrimSuffix(b.cfg.APIURL, "/") + "/v6/deleteFiles"
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Uploadthing-Api-Key", b.cfg.Secret)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error deleting from UploadThing: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("UploadThing error: %s", resp.Status)
+	}
+	return nil
+}
+
+// List pages through the app's files and returns those whose custom ID starts with prefix
+func (b *UploadThingBackend) List(ctx context.Context, prefix string) ([]Object, error) {
+	const pageSize = 500
+
+	var objects []Object
+	for offset := 0; ; offset += pageSize {
+		payload, err := json.Marshal(map[string]int{"limit": pageSize, "offset": offset})
+		if err != nil {
+			return nil, fmt.Errorf("error encoding request: %v", err)
+		}
+
+		endpoint := strings.TrimSuffix(b.cfg.APIURL, "/") + "/v6/listFiles"
+		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Uploadthing-Api-Key", b.cfg.Secret)
+
+		resp, err := b.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("error listing UploadThing files: %v", err)
+		}
+
+		var result struct {
+			HasMore bool `json:"hasMore"`
+			Files   []struct {
+				CustomID   string `json:"customId"`
+				Size       int64  `json:"size"`
+				UploadedAt int64  `json:"uploadedAt"`
+			} `json:"files"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("UploadThing error: %s", resp.Status)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error decoding file list: %v", err)
+		}
+
+		// Files uploaded outside this backend have no custom ID and are left alone
+		for _, f := range result.Files {
+			if f.CustomID == "" || !strings.HasPrefix(f.CustomID, prefix) {
+				continue
+			}
+			objects = append(objects, Object{
+				Key:     f.CustomID,
+				Size:    f.Size,
+				ModTime: time.UnixMilli(f.UploadedAt),
+			})
+		}
+		if !result.HasMore || len(result.Files) == 0 {
+			return objects, nil
+		}
+	}
+}
+
+// URL returns the file URL of an object, addressed by its custom ID
+func (b *UploadThingBackend) URL(key string) string {
+	return fmt.Sprintf("https://%s.ufs.sh/f/%s", b.cfg.AppID, url.PathEscape(key))
+}
+
+// fetch requests an object's file URL, mapping a 404 to ErrNotFound
+func (b *UploadThingBackend) fetch(ctx context.Context, method, key string) (*http.Response, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, b.URL(key), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting UploadThing file: %v", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("UploadThing error: %s", resp.Status)
+}
+
+// responseObject reads an object's metadata from response headers
+func responseObject(key string, resp *http.Response) *Object {
+	obj := &Object{
+		Key:         key,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        resp.Header.Get("ETag"),
+	}
+	obj.Size, _ = strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	obj.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return obj
+}
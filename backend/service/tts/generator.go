@@ -2,39 +2,51 @@ package tts
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"backend/config"
-	"backend/domain/models"
-	"backend/repository/sqlite"
-
-	"github.com/google/uuid"
 )
 
-// Generator handles text-to-speech generation
+// Generator handles text-to-speech generation. It only returns audio;
+// callers store it through FileStorage.
 type Generator struct {
 	config *config.Config
-	db     *sqlite.DB
 }
 
 // NewGenerator creates a new TTS generator
-func NewGenerator(cfg *config.Config, db *sqlite.DB) *Generator {
-	return &Generator{
-		config: cfg,
-		db:     db,
-	}
+func NewGenerator(cfg *config.Config) *Generator {
+	return &Generator{config: cfg}
+}
+
+// VoiceSettings overrides the voice used for a synthesis request. Zero
+// values fall back to the model defaults.
+type VoiceSettings struct {
+	Voice    string  `json:"voice,omitempty"`
+	Speed    float64 `json:"speed,omitempty"`
+	Language string  `json:"language,omitempty"`
+}
+
+// DefaultVoiceSettings returns the voice settings used when none are given
+func (g *Generator) DefaultVoiceSettings() VoiceSettings {
+	return VoiceSettings{Language: g.config.TTSDefaultLang}
 }
 
 // GenerateAudio generates audio for the given text
 func (g *Generator) GenerateAudio(text string) ([]byte, error) {
+	return g.GenerateAudioWithSettings(context.Background(), text, g.DefaultVoiceSettings())
+}
+
+// GenerateAudioWithSettings generates audio for the given text using specific
+// voice settings. Canceling ctx aborts the request and cancels the prediction.
+func (g *Generator) GenerateAudioWithSettings(ctx context.Context, text string, settings VoiceSettings) ([]byte, error) {
 	text = strings.TrimSpace(text)
 	if text == "" {
 		return nil, fmt.Errorf("cannot generate audio for empty text")
@@ -43,15 +55,19 @@ func (g *Generator) GenerateAudio(text string) ([]byte, error) {
 	log.Printf("[TTS] Starting TTS generation for text length: %d", len(text))
 
 	// Generate TTS using the helper function
-	audioURL, err := g.generateTTS(text)
+	audioURL, err := g.generateTTS(ctx, text, settings)
 	if err != nil {
-		return nil, fmt.Errorf("error generating TTS: %v", err)
+		return nil, fmt.Errorf("error generating TTS: %w", err)
 	}
 
 	// Download the audio file
-	audioResp, err := http.Get(audioURL)
+	req, err := http.NewRequestWithContext(ctx, "GET", audioURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("error downloading audio: %v", err)
+		return nil, fmt.Errorf("error creating download request: %v", err)
+	}
+	audioResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading audio: %w", err)
 	}
 	defer audioResp.Body.Close()
 
@@ -59,16 +75,28 @@ func (g *Generator) GenerateAudio(text string) ([]byte, error) {
 }
 
 // generateTTS generates audio for the given text using Kokoro TTS
-func (g *Generator) generateTTS(text string) (string, error) {
+func (g *Generator) generateTTS(ctx context.Context, text string, settings VoiceSettings) (string, error) {
 	// Call Replicate API to generate audio
 	replicateURL := g.config.ReplicateAPIURL + "/predictions"
 
+	language := settings.Language
+	if language == "" {
+		language = "en"
+	}
+	input := map[string]interface{}{
+		"text":     text,
+		"language": language,
+	}
+	if settings.Voice != "" {
+		input["voice"] = settings.Voice
+	}
+	if settings.Speed > 0 {
+		input["speed"] = settings.Speed
+	}
+
 	requestBody := map[string]interface{}{
 		"version": g.config.KokoroModelVersion,
-		"input": map[string]interface{}{
-			"text":     text,
-			"language": "en",
-		},
+		"input":   input,
 	}
 
 	jsonData, err := json.Marshal(requestBody)
@@ -77,7 +105,7 @@ func (g *Generator) generateTTS(text string) (string, error) {
 	}
 
 	// Create initial prediction
-	req, err := http.NewRequest("POST", replicateURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", replicateURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", fmt.Errorf("error creating request: %v", err)
 	}
@@ -88,7 +116,7 @@ func (g *Generator) generateTTS(text string) (string, error) {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error making request: %v", err)
+		return "", fmt.Errorf("error making request: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -104,9 +132,14 @@ func (g *Generator) generateTTS(text string) (string, error) {
 	// Poll for completion
 	maxAttempts := 60 // 2 minutes total
 	for i := 0; i < maxAttempts; i++ {
-		time.Sleep(2 * time.Second)
+		select {
+		case <-time.After(2 * time.Second):
+		case <-ctx.Done():
+			g.cancelPrediction(replicateURL, prediction.ID)
+			return "", ctx.Err()
+		}
 
-		req, err = http.NewRequest("GET", replicateURL+"/"+prediction.ID, nil)
+		req, err = http.NewRequestWithContext(ctx, "GET", replicateURL+"/"+prediction.ID, nil)
 		if err != nil {
 			return "", fmt.Errorf("error creating poll request: %v", err)
 		}
@@ -114,6 +147,10 @@ func (g *Generator) generateTTS(text string) (string, error) {
 
 		resp, err = client.Do(req)
 		if err != nil {
+			if ctx.Err() != nil {
+				g.cancelPrediction(replicateURL, prediction.ID)
+				return "", ctx.Err()
+			}
 			return "", fmt.Errorf("error polling prediction: %v", err)
 		}
 
@@ -148,68 +185,26 @@ func (g *Generator) generateTTS(text string) (string, error) {
 	return "", fmt.Errorf("prediction timed out after %d attempts", maxAttempts)
 }
 
-// ProcessAudioSegment processes a text segment and generates audio
-func (g *Generator) ProcessAudioSegment(segment *models.AudioSegment) ([]byte, error) {
-	// Get Kokoro model version from environment
-	modelVersion := os.Getenv("KOKORO_MODEL_VERSION")
-	if modelVersion == "" {
-		return nil, fmt.Errorf("KOKORO_MODEL_VERSION not set")
+// cancelPrediction asks Replicate to stop a prediction that is no longer needed
+func (g *Generator) cancelPrediction(replicateURL, predictionID string) {
+	if predictionID == "" {
+		return
 	}
 
-	// Generate audio
-	audioData, err := g.GenerateAudio(segment.Content)
-	if err != nil {
-		return nil, fmt.Errorf("error generating audio: %v", err)
-	}
-
-	// Save audio file
-	audioFileName := fmt.Sprintf("tts-%s.mp3", segment.ID)
-	audioPath := fmt.Sprintf("/audio/%s", audioFileName)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	// Update segment
-	segment.AudioURL = audioPath
-	segment.Status = "completed"
-	segment.UpdatedAt = time.Now()
-
-	return audioData, nil
-}
-
-// ProcessTextToSpeech processes all audio segments for a book
-func (g *Generator) ProcessTextToSpeech(book *models.Book) error {
-	segments, err := g.db.GetAudioSegments(book.ID)
+	req, err := http.NewRequestWithContext(ctx, "POST", replicateURL+"/"+predictionID+"/cancel", nil)
 	if err != nil {
-		return fmt.Errorf("error getting audio segments: %v", err)
+		return
 	}
+	req.Header.Set("Authorization", "Token "+os.Getenv("REPLICATE_API_TOKEN"))
 
-	for _, segment := range segments {
-		if segment.Status != "pending" {
-			continue
-		}
-
-		audioData, err := g.GenerateAudio(segment.Content)
-		if err != nil {
-			segment.Status = "error"
-			g.db.UpdateAudioSegment(&segment)
-			continue
-		}
-
-		// Save audio to temporary file for immediate playback
-		audioFileName := fmt.Sprintf("tts-%s.mp3", uuid.New().String())
-		audioPath := filepath.Join(g.config.UploadDir, "audio", audioFileName)
-		if err := os.WriteFile(audioPath, audioData, 0644); err != nil {
-			segment.Status = "error"
-			g.db.UpdateAudioSegment(&segment)
-			continue
-		}
-
-		// Update segment with local URL
-		segment.AudioURL = "/audio/" + audioFileName
-		segment.Status = "completed"
-		segment.UpdatedAt = time.Now()
-		if err := g.db.UpdateAudioSegment(&segment); err != nil {
-			continue
-		}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("[TTS] Error canceling prediction %s: %v", predictionID, err)
+		return
 	}
-
-	return nil
+	resp.Body.Close()
+	log.Printf("[TTS] Canceled prediction %s", predictionID)
 }